@@ -0,0 +1,455 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+func init() {
+	register(
+		&Command{name: "acl", handler: acl, arity: -2, help: aclHelp},
+	)
+}
+
+// aclHelp is the reply to ACL HELP.
+var aclHelp = []string{
+	"DELUSER <username> [<username> ...]",
+	"    Delete a list of users.",
+	"GETUSER <username>",
+	"    Get the user's details.",
+	"LIST",
+	"    Show users details in config file format.",
+	"SETUSER <username> <attribute> ...",
+	"    Create or modify a user with the specified attributes.",
+	"WHOAMI",
+	"    Return the current connection username.",
+}
+
+// aclCategories maps the command categories usable in ACL rules, as in
+// +@read, to the test selecting their commands.
+var aclCategories = map[string]func(cmd *Command) bool{
+	"all":   func(*Command) bool { return true },
+	"read":  func(cmd *Command) bool { return cmd.hasKeys() && !cmd.isWrite },
+	"write": func(cmd *Command) bool { return cmd.isWrite },
+	"fast":  func(cmd *Command) bool { return cmd.fast },
+	"slow":  func(cmd *Command) bool { return !cmd.fast },
+}
+
+// aclUser is a user clients can authenticate as, and the commands and keys it
+// may use.
+type aclUser struct {
+	name    string
+	enabled bool
+
+	// nopass lets the user authenticate with any password. Otherwise
+	// passwords holds the hex SHA-256 digests of the accepted ones.
+	nopass    bool
+	passwords []string
+
+	// allowed holds the names of the commands the user may run, as built by
+	// the command rules in cmdRules, kept to describe the user.
+	allowed  map[string]bool
+	cmdRules []string
+
+	// keys holds the glob patterns of the keys the user may access.
+	keys []string
+}
+
+// ACL holds the users of the server. They are modified in place, under mu,
+// so that clients authenticated as a user see its changes right away.
+type ACL struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+}
+
+// newACL returns an ACL holding the default user, which may do anything and
+// requires password if it isn't empty, like requirepass.
+func newACL(password string) *ACL {
+	a := &ACL{users: map[string]*aclUser{
+		"default": {name: "default", enabled: true, keys: []string{"*"}},
+	}}
+	_ = a.users["default"].applyRule("allcommands")
+	a.setRequirePass(password)
+	return a
+}
+
+// hashPassword returns the hex SHA-256 digest pass is stored as.
+func hashPassword(pass string) string {
+	sum := sha256.Sum256([]byte(pass))
+	return hex.EncodeToString(sum[:])
+}
+
+// clone returns a deep copy of u.
+func (u *aclUser) clone() *aclUser {
+	cp := *u
+	cp.passwords = slices.Clone(u.passwords)
+	cp.cmdRules = slices.Clone(u.cmdRules)
+	cp.keys = slices.Clone(u.keys)
+	cp.allowed = make(map[string]bool, len(u.allowed))
+	for name := range u.allowed {
+		cp.allowed[name] = true
+	}
+	return &cp
+}
+
+// applyRule applies the ACL SETUSER rule to u, returning why it is invalid
+// if it is.
+func (u *aclUser) applyRule(rule string) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.nopass, u.passwords = true, nil
+	case lower == "resetpass":
+		u.nopass, u.passwords = false, nil
+	case lower == "allkeys":
+		u.keys = []string{"*"}
+	case lower == "resetkeys":
+		u.keys = nil
+	case lower == "allcommands":
+		return u.applyRule("+@all")
+	case lower == "nocommands":
+		return u.applyRule("-@all")
+	case lower == "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "nocommands", "off"} {
+			_ = u.applyRule(r)
+		}
+	case rule[0] == '>' || rule[0] == '<':
+		return u.applyPassword(rule[0], hashPassword(rule[1:]))
+	case rule[0] == '#' || rule[0] == '!':
+		hash := rule[1:]
+		if len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "" {
+			return fmt.Errorf("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		return u.applyPassword(rule[0], hash)
+	case rule[0] == '~':
+		u.keys = append(u.keys, rule[1:])
+	case rule[0] == '+' || rule[0] == '-':
+		return u.applyCommandRule(rule[0] == '+', lower[1:])
+	default:
+		return fmt.Errorf("Syntax error")
+	}
+	return nil
+}
+
+// applyPassword adds, for the > and # rules, or removes the password hash to
+// the passwords of u.
+func (u *aclUser) applyPassword(op byte, hash string) error {
+	i := slices.Index(u.passwords, hash)
+	switch op {
+	case '>', '#':
+		if i < 0 {
+			u.passwords = append(u.passwords, hash)
+		}
+		u.nopass = false
+	default:
+		if i < 0 {
+			return fmt.Errorf("The password you are trying to remove from the user does not exist")
+		}
+		u.passwords = slices.Delete(u.passwords, i, i+1)
+	}
+	return nil
+}
+
+// applyCommandRule allows, or disallows, the command or @category name.
+func (u *aclUser) applyCommandRule(allow bool, name string) error {
+	var selected []string
+	if category, ok := strings.CutPrefix(name, "@"); ok {
+		in, ok := aclCategories[category]
+		if !ok {
+			return fmt.Errorf("Unknown command category")
+		}
+		for cmdName, cmd := range commands {
+			if in(cmd) {
+				selected = append(selected, cmdName)
+			}
+		}
+	} else {
+		if _, ok := commands[name]; !ok {
+			return fmt.Errorf("Unknown command")
+		}
+		selected = []string{name}
+	}
+	if u.allowed == nil {
+		u.allowed = make(map[string]bool)
+	}
+	for _, cmdName := range selected {
+		if allow {
+			u.allowed[cmdName] = true
+		} else {
+			delete(u.allowed, cmdName)
+		}
+	}
+
+	rule := "-" + name
+	if allow {
+		rule = "+" + name
+	}
+	if name == "@all" {
+		// Everything before is overridden.
+		u.cmdRules = nil
+		if !allow {
+			return nil
+		}
+	}
+	u.cmdRules = append(u.cmdRules, rule)
+	return nil
+}
+
+// rules returns the rules that recreate u, as shown by ACL LIST.
+func (u *aclUser) rules() []string {
+	rules := []string{"off"}
+	if u.enabled {
+		rules[0] = "on"
+	}
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, hash := range u.passwords {
+		rules = append(rules, "#"+hash)
+	}
+	for _, pattern := range u.keys {
+		rules = append(rules, "~"+pattern)
+	}
+	if len(u.keys) == 0 {
+		rules = append(rules, "resetkeys")
+	}
+	return append(rules, u.commandRules())
+}
+
+// commandRules returns the command rules of u as a single string.
+func (u *aclUser) commandRules() string {
+	if len(u.cmdRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.cmdRules, " ")
+}
+
+// checkPassword reports whether pass is a password of u.
+func (u *aclUser) checkPassword(pass string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := []byte(hashPassword(pass))
+	ok := false
+	for _, h := range u.passwords {
+		if subtle.ConstantTimeCompare(hash, []byte(h)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// authenticate returns the user named name if it is enabled and pass is one
+// of its passwords, or nil.
+func (a *ACL) authenticate(name, pass string) *aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u := a.users[name]
+	if u == nil || !u.enabled || !u.checkPassword(pass) {
+		return nil
+	}
+	return u
+}
+
+// defaultUser returns the default user, which new clients act as.
+func (a *ACL) defaultUser() *aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.users["default"]
+}
+
+// authRequired reports whether clients have to authenticate before running
+// commands, which they don't while the default user is enabled and takes no
+// password.
+func (a *ACL) authRequired() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	def := a.users["default"]
+	return !def.enabled || !def.nopass
+}
+
+// defaultNoPass reports whether the default user takes no password, making
+// AUTH with a single argument pointless.
+func (a *ACL) defaultNoPass() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.users["default"].nopass
+}
+
+// setRequirePass makes password the only password of the default user, or
+// lets it in without one if password is empty, as CONFIG SET requirepass
+// does.
+func (a *ACL) setRequirePass(password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	def := a.users["default"]
+	if password == "" {
+		_ = def.applyRule("nopass")
+		return
+	}
+	_ = def.applyRule("resetpass")
+	_ = def.applyRule(">" + password)
+}
+
+// check returns the NOPERM error replied to user running the invocation v of
+// cmd if the user may not run it or access its keys, or nil. A nil user, the
+// AOF replay pseudo client, may do anything.
+func (a *ACL) check(user *aclUser, cmd *Command, v *Value) *Value {
+	if user == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if !user.allowed[cmd.name] {
+		return newError("NOPERM User %s has no permissions to run the '%s' command", user.name, cmd.name)
+	}
+	for _, key := range cmd.keyArgs(v) {
+		if !slices.ContainsFunc(user.keys, func(pattern string) bool {
+			return globMatch(pattern, key)
+		}) {
+			return newError("NOPERM No permissions to access a key")
+		}
+	}
+	return nil
+}
+
+// acl implements ACL SETUSER username [rule ...], ACL GETUSER username,
+// ACL LIST, ACL WHOAMI and ACL DELUSER username [username ...].
+func acl(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[2:])
+	a := rg.acl
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "SETUSER" && len(args) >= 1:
+		return a.setUser(args[0], args[1:])
+	case sub == "GETUSER" && len(args) == 1:
+		return a.getUser(args[0])
+	case sub == "LIST" && len(args) == 0:
+		a.mu.RLock()
+		defer a.mu.RUnlock()
+
+		names := make([]string, 0, len(a.users))
+		for name := range a.users {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		vals := make([]Value, len(names))
+		for i, name := range names {
+			vals[i] = Value{Type: Bulk, Bulk: "user " + name + " " + strings.Join(a.users[name].rules(), " ")}
+		}
+		return newArray(vals)
+	case sub == "WHOAMI" && len(args) == 0:
+		return newBulk(c.user.name)
+	case sub == "DELUSER" && len(args) >= 1:
+		return rg.delUsers(c, args)
+	default:
+		return unknownSubcommand("acl", v.Array[1].Bulk)
+	}
+}
+
+// setUser implements ACL SETUSER, creating the user name if needed, disabled
+// and allowed nothing, and applying rules to it. Either every rule applies or
+// the user is left unchanged.
+func (a *ACL) setUser(name string, rules []string) *Value {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u := a.users[name]
+	updated := &aclUser{name: name}
+	if u != nil {
+		updated = u.clone()
+	}
+	for _, rule := range rules {
+		if rule == "" {
+			return newError("ERR Error in ACL SETUSER modifier '': Syntax error")
+		}
+		if err := updated.applyRule(rule); err != nil {
+			return newError("ERR Error in ACL SETUSER modifier '%s': %v", rule, err)
+		}
+	}
+	if u == nil {
+		a.users[name] = updated
+	} else {
+		*u = *updated
+	}
+	return newOK()
+}
+
+// getUser implements ACL GETUSER, describing the user name, or replying with
+// a null if there is none.
+func (a *ACL) getUser(name string) *Value {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	u := a.users[name]
+	if u == nil {
+		return newNull()
+	}
+	var flags []string
+	if u.enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	keys := make([]string, len(u.keys))
+	for i, pattern := range u.keys {
+		keys[i] = "~" + pattern
+	}
+	return newMap([]Value{
+		{Type: Bulk, Bulk: "flags"}, *newArray(bulkValues(flags)),
+		{Type: Bulk, Bulk: "passwords"}, *newArray(bulkValues(u.passwords)),
+		{Type: Bulk, Bulk: "commands"}, {Type: Bulk, Bulk: u.commandRules()},
+		{Type: Bulk, Bulk: "keys"}, {Type: Bulk, Bulk: strings.Join(keys, " ")},
+		{Type: Bulk, Bulk: "channels"}, {Type: Bulk, Bulk: "&*"},
+	})
+}
+
+// delUsers implements ACL DELUSER, deleting the given users and
+// disconnecting the clients authenticated as them. It replies with the
+// number of users deleted.
+func (rg *RedisGo) delUsers(c *Client, names []string) *Value {
+	if slices.Contains(names, "default") {
+		return newError("ERR The 'default' user cannot be removed")
+	}
+	deleted := make(map[*aclUser]bool)
+	rg.acl.mu.Lock()
+	for _, name := range names {
+		if u := rg.acl.users[name]; u != nil {
+			deleted[u] = true
+			delete(rg.acl.users, name)
+		}
+	}
+	rg.acl.mu.Unlock()
+
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	for _, cl := range rg.clients {
+		if !deleted[cl.user] {
+			continue
+		}
+		if cl == c {
+			c.closeAfterReply = true
+		} else {
+			_ = cl.conn.Close()
+		}
+	}
+	return newInteger(int64(len(deleted)))
+}
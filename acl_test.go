@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestACLReadOnlyUser(t *testing.T) {
+	rg := newTestServer(t)
+	admin, reader := dial(t, rg), dial(t, rg)
+	admin.do("set", "k", "v")
+	if reply := admin.do("acl", "setuser", "reader", "on", ">secret", "~*", "+@read"); reply.Str != "OK" {
+		t.Fatalf("ACL SETUSER = %v, want OK", reply)
+	}
+	if reply := reader.do("auth", "reader", "secret"); reply.Str != "OK" {
+		t.Fatalf("AUTH reader = %v, want OK", reply)
+	}
+	if reply := reader.do("get", "k"); reply.Bulk != "v" {
+		t.Fatalf("GET k as reader = %v, want v", reply)
+	}
+	const errDenied = "NOPERM User reader has no permissions to run the 'set' command"
+	if reply := reader.do("set", "k", "other"); reply.Type != Error || reply.Err != errDenied {
+		t.Fatalf("SET k as reader = %v, want %q", reply, errDenied)
+	}
+	if reply := admin.do("get", "k"); reply.Bulk != "v" {
+		t.Fatalf("GET k after the denied SET = %v, want v", reply)
+	}
+}
+
+func TestACLKeyPatterns(t *testing.T) {
+	rg := newTestServer(t)
+	admin, user := dial(t, rg), dial(t, rg)
+	admin.do("acl", "setuser", "app", "on", ">secret", "~app:*", "+@all")
+	user.do("auth", "app", "secret")
+
+	if reply := user.do("set", "app:1", "v"); reply.Str != "OK" {
+		t.Fatalf("SET app:1 = %v, want OK", reply)
+	}
+	const errDenied = "NOPERM No permissions to access a key"
+	if reply := user.do("set", "other", "v"); reply.Type != Error || reply.Err != errDenied {
+		t.Fatalf("SET other = %v, want %q", reply, errDenied)
+	}
+	// Every key of a command must match, not only the first.
+	if reply := user.do("mget", "app:1", "other"); reply.Type != Error || reply.Err != errDenied {
+		t.Fatalf("MGET app:1 other = %v, want %q", reply, errDenied)
+	}
+}
@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "bgrewriteaof", handler: bgrewriteaof, arity: 1},
+	)
+}
+
+// Aof is the append only file. Every write command that succeeds is recorded
+// in it in RESP form, so that replaying the file rebuilds the dataset.
+type Aof struct {
+	// mu serializes appends and flushes. While the AOF is enabled, dispatch
+	// also holds it for the whole execution of a write command so that the
+	// file records writes in the order they were applied.
+	mu     sync.Mutex
+	file   *os.File
+	writer *Writer
+	fsync  FSyncMode
+
+	// db is the database the last recorded command ran against, or -1 if
+	// none has been recorded yet by this process.
+	db int
+
+	// rewriteBuf collects the commands appended while a rewrite is running,
+	// nil otherwise. They are added to the rewritten file before it replaces
+	// the current one so that nothing is lost.
+	rewriteBuf *bytes.Buffer
+}
+
+// NewAof opens the append only file at path for appending, creating it if it
+// doesn't exist.
+func NewAof(path string, fsync FSyncMode) (*Aof, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open aof file %q: %w", path, err)
+	}
+	return &Aof{
+		file:   f,
+		writer: NewWriter(f),
+		fsync:  fsync,
+		db:     -1,
+	}, nil
+}
+
+// loadAof rebuilds the dataset by replaying the append only file at path
+// through the dispatcher on behalf of a pseudo client. A command cut short at
+// the end of the file, as left behind by a crash mid-write, is truncated away
+// with a warning; any other malformed content fails the load. loadAof must
+// run before the AOF is opened for appending so that replayed commands are
+// not recorded a second time.
+func (rg *RedisGo) loadAof(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat aof file %q: %w", path, err)
+	}
+	lim := rg.conf.protoLimits()
+	cr := &countingReader{r: f}
+	br := bufio.NewReader(cr)
+
+	rg.loading = true
+	defer func() { rg.loading = false }()
+
+	c := &Client{authenticated: true}
+	var loaded int
+	var good int64    // good is the offset just past the last complete command
+	var txStart int64 // txStart is the offset of the MULTI of an open transaction
+	for {
+		// Unlike clients, the AOF never holds inline commands.
+		if b, perr := br.Peek(1); perr == nil && b[0] != '*' {
+			err = fmt.Errorf("expected array, got %q", b)
+			break
+		}
+		var v Value
+		err = v.readArray(br, lim)
+		if err != nil {
+			break
+		}
+		if !c.multi {
+			txStart = good
+		}
+		good = cr.n - int64(br.Buffered())
+		loaded++
+		if reply := rg.dispatch(c, &v); reply.Type == Error {
+			log.Printf("aof command %d failed on replay: %s", loaded, reply.Err)
+		}
+	}
+	if c.multi && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		// The queued commands were never applied; drop the transaction from
+		// the file too so that later appends don't end up inside it.
+		log.Printf("aof file %q ends with an unfinished transaction, discarding it", path)
+		good = txStart
+	}
+	switch {
+	case errors.Is(err, io.EOF) && good == info.Size():
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		log.Printf("aof file %q ends with an incomplete command, truncating it from %d to %d bytes",
+			path, info.Size(), good)
+		if err = os.Truncate(path, good); err != nil {
+			return fmt.Errorf("cannot truncate aof file %q: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("bad aof file format %q after %d commands: %w", path, loaded, err)
+	}
+	// Replayed commands were saved already, they don't count towards the
+	// save points.
+	rg.dirty.Store(0)
+	log.Printf("db loaded from append only file: %q, %d commands", path, loaded)
+	return nil
+}
+
+// countingReader counts the bytes read through it, letting loadAof work out
+// the file offset of the last complete command.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// aofPath returns the path of the AOF configured by dir and appendfilename.
+func (rg *RedisGo) aofPath() string {
+	return filepath.Join(rg.conf.dir, rg.conf.aofFn)
+}
+
+// append records cmds as executed against database db, preceded by a SELECT
+// if db differs from the previous command's. With always every append is
+// flushed and fsynced, with nofsync it is handed to the OS right away and
+// with everysec it stays buffered until the next sync. The caller must hold
+// mu.
+func (aof *Aof) append(db int, cmds []Value) error {
+	if db != aof.db {
+		cmds = append([]Value{newCommand("select", strconv.Itoa(db))}, cmds...)
+		aof.db = db
+	}
+	for i := range cmds {
+		if err := aof.writer.Write(&cmds[i]); err != nil {
+			return err
+		}
+	}
+	if aof.rewriteBuf != nil {
+		w := NewWriter(aof.rewriteBuf)
+		for i := range cmds {
+			_ = w.Write(&cmds[i])
+		}
+		_ = w.Flush()
+	}
+	switch aof.fsync {
+	case Always:
+		return aof.sync()
+	case NoFSync:
+		return aof.writer.Flush()
+	}
+	return nil
+}
+
+// log is append for commands recorded outside of execLogged, taking mu
+// itself. Failures are logged since the command has already run.
+func (aof *Aof) log(db int, cmds ...Value) {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	if err := aof.append(db, cmds); err != nil {
+		log.Printf("cannot append to aof: %v", err)
+	}
+}
+
+// sync flushes buffered commands and fsyncs the file. The caller must hold
+// mu.
+func (aof *Aof) sync() error {
+	if err := aof.writer.Flush(); err != nil {
+		return err
+	}
+	return aof.file.Sync()
+}
+
+// Size returns the current size of the AOF on disk, not counting commands
+// still buffered.
+func (aof *Aof) Size() (int64, error) {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	info, err := aof.file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("cannot stat aof file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// Close flushes and fsyncs any buffered commands and closes the file.
+func (aof *Aof) Close() error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	err := aof.sync()
+	if cerr := aof.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// aofSyncLoop flushes and fsyncs the AOF once a second for the everysec
+// policy until conf.quit is closed.
+func (rg *RedisGo) aofSyncLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.conf.quit:
+			return
+		case <-ticker.C:
+			rg.aof.mu.Lock()
+			if err := rg.aof.sync(); err != nil {
+				log.Printf("cannot sync aof: %v", err)
+			}
+			rg.aof.mu.Unlock()
+		}
+	}
+}
+
+// execLogged runs the write command in v while holding the AOF lock and
+// records it once it succeeds, or the commands the handler chose to propagate
+// in its place.
+func (rg *RedisGo) execLogged(c *Client, v *Value, cmd *Command) *Value {
+	rg.aof.mu.Lock()
+	defer rg.aof.mu.Unlock()
+
+	reply := cmd.handler(c, v, rg)
+	rg.flushExpired(true)
+	if reply.Type == Error {
+		return reply
+	}
+	cmds := c.propagate
+	if cmds == nil {
+		cmds = []Value{*v}
+	}
+	if len(cmds) > 0 {
+		if err := rg.aof.append(c.dbIndex, cmds); err != nil {
+			log.Printf("cannot append to aof: %v", err)
+		}
+	}
+	return reply
+}
+
+// aofRewriteCron checks once a second whether the AOF has grown enough since
+// the last rewrite to be rewritten automatically, as configured by
+// auto-aof-rewrite-percentage and auto-aof-rewrite-min-size. It runs until
+// conf.quit is closed.
+func (rg *RedisGo) aofRewriteCron() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.conf.quit:
+			return
+		case <-ticker.C:
+			if rg.inCompaction.Load() || !rg.aofRewriteDue() {
+				continue
+			}
+			log.Println("starting automatic rewriting of aof")
+			if err := rg.BgRewriteAof(); err != nil && !errors.Is(err, errRewriteInProgress) {
+				log.Printf("cannot start automatic aof rewrite: %v", err)
+			}
+		}
+	}
+}
+
+// aofRewriteDue reports whether the AOF is above the minimum size and has
+// grown by at least the configured percentage over its base size.
+func (rg *RedisGo) aofRewriteDue() bool {
+	rg.conf.mu.RLock()
+	perc, minSize := rg.conf.aofRewritePerc, rg.conf.aofRewriteMinSize
+	rg.conf.mu.RUnlock()
+
+	if perc == 0 {
+		return false
+	}
+	size, err := rg.aof.Size()
+	if err != nil || uint64(size) < minSize {
+		return false
+	}
+	base := max(rg.aofStats.baseSize.Load(), 1)
+	return (size-base)*100/base >= int64(perc)
+}
+
+// errRewriteInProgress is returned when an AOF rewrite is requested while
+// another one is still running.
+var errRewriteInProgress = errors.New("background append only file rewriting already in progress")
+
+// aofItemsPerCmd caps the number of elements the rewrite packs into a single
+// command, so that huge keys don't turn into huge commands.
+const aofItemsPerCmd = 64
+
+// BgRewriteAof compacts the AOF on a new goroutine into the minimal set of
+// commands that rebuilds the current dataset. The dataset is copied before
+// BgRewriteAof returns; commands appended while the copy is being written out
+// are buffered and added to the new file before it replaces the old one.
+func (rg *RedisGo) BgRewriteAof() error {
+	if rg.aof == nil {
+		return errors.New("append only file is disabled")
+	}
+	if !rg.inCompaction.CompareAndSwap(false, true) {
+		return errRewriteInProgress
+	}
+	aof := rg.aof
+	start := time.Now()
+	aof.mu.Lock()
+	dbs := rg.cloneDbs()
+	aof.rewriteBuf = new(bytes.Buffer)
+	// The rewritten file ends in whatever database it wrote last, so the
+	// first buffered command has to select its own.
+	aof.db = -1
+	aof.mu.Unlock()
+	rg.sampleLatency("fork", time.Since(start))
+
+	go func() {
+		defer rg.inCompaction.Store(false)
+
+		if err := rg.rewriteAof(dbs); err != nil {
+			log.Printf("background aof rewrite failed: %v", err)
+			aof.mu.Lock()
+			aof.rewriteBuf = nil
+			aof.mu.Unlock()
+			return
+		}
+		rg.aofStats.rewrites.Add(1)
+		log.Println("background aof rewrite terminated with success")
+	}()
+	return nil
+}
+
+// rewriteAof writes dbs to a temporary file, then, holding the AOF lock,
+// appends the commands buffered meanwhile and swaps the file in place of the
+// current AOF.
+func (rg *RedisGo) rewriteAof(dbs []map[string]*Item) error {
+	path := rg.aofPath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return fmt.Errorf("cannot create temp aof file: %w", err)
+	}
+	swapped := false
+	defer func() {
+		if !swapped {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	w := NewWriter(tmp)
+	if err = writeDataset(w, dbs); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write temp aof file: %w", err)
+	}
+
+	aof := rg.aof
+	start := time.Now()
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	// Write commands wait for the buffered ones to be written and the file
+	// swapped.
+	defer func() { rg.sampleLatency("aof-rewrite-diff-write", time.Since(start)) }()
+
+	_, err = aof.rewriteBuf.WriteTo(tmp)
+	aof.rewriteBuf = nil
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write temp aof file: %w", err)
+	}
+	// Flush what is pending for the old file first: it is already in the
+	// rewrite buffer, but the old file must not be left with half of it.
+	if err = aof.writer.Flush(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot rename temp aof file: %w", err)
+	}
+	// tmp now is the AOF; keep it open for appending in place of the old one.
+	swapped = true
+	_ = aof.file.Close()
+	aof.file = tmp
+	aof.writer = NewWriter(tmp)
+
+	if info, err := tmp.Stat(); err == nil {
+		rg.aofStats.baseSize.Store(info.Size())
+	}
+	return nil
+}
+
+// writeDataset writes the commands that rebuild dbs to w: a SELECT per
+// non-empty database, then one command per key, split every aofItemsPerCmd
+// elements, plus a PEXPIREAT for keys with an expiry.
+func writeDataset(w *Writer, dbs []map[string]*Item) error {
+	for i, store := range dbs {
+		if len(store) == 0 {
+			continue
+		}
+		sel := newCommand("select", strconv.Itoa(i))
+		if err := w.Write(&sel); err != nil {
+			return err
+		}
+		for key, item := range store {
+			if err := writeItem(w, key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeItem writes the commands that recreate item at key to w.
+func writeItem(w *Writer, key string, item *Item) error {
+	var err error
+	switch item.Kind {
+	case KindString:
+		cmd := newCommand("set", key, item.Value)
+		err = w.Write(&cmd)
+	case KindList:
+		err = writeChunked(w, "rpush", key, item.List, 1)
+	case KindHash:
+		args := make([]string, 0, 2*len(item.Hash))
+		for field, val := range item.Hash {
+			args = append(args, field, val)
+		}
+		err = writeChunked(w, "hset", key, args, 2)
+	case KindSet:
+		args := make([]string, 0, len(item.Set))
+		for member := range item.Set {
+			args = append(args, member)
+		}
+		err = writeChunked(w, "sadd", key, args, 1)
+	case KindZSet:
+		args := make([]string, 0, 2*item.ZSet.Len())
+		for _, e := range item.ZSet.Entries {
+			args = append(args, formatScore(e.Score), e.Member)
+		}
+		err = writeChunked(w, "zadd", key, args, 2)
+	case KindStream:
+		err = writeStream(w, key, item.Stream)
+	}
+	if err != nil || !item.hasExpiry() {
+		return err
+	}
+	cmd := newCommand("pexpireat", key, strconv.FormatInt(item.Expiration.UnixMilli(), 10))
+	return w.Write(&cmd)
+}
+
+// writeStream writes the commands that recreate the stream s at key to w:
+// an XADD per entry, then an XSETID if the last ID is past the last entry.
+// An empty stream is created by an XADD trimming its own entry away.
+func writeStream(w *Writer, key string, s *Stream) error {
+	last := s.LastID.String()
+	if s.Len() == 0 {
+		cmd := newCommand("xadd", key, "maxlen", "0", last, "", "")
+		return w.Write(&cmd)
+	}
+	for _, entry := range s.Entries {
+		cmd := newCommand(append([]string{"xadd", key, entry.ID.String()}, entry.Fields...)...)
+		if err := w.Write(&cmd); err != nil {
+			return err
+		}
+	}
+	if s.Entries[s.Len()-1].ID == s.LastID {
+		return nil
+	}
+	cmd := newCommand("xsetid", key, last)
+	return w.Write(&cmd)
+}
+
+// writeChunked writes name key args... to w as as many commands as needed to
+// keep each under aofItemsPerCmd elements, where an element spans width args.
+func writeChunked(w *Writer, name, key string, args []string, width int) error {
+	for len(args) > 0 {
+		n := min(len(args), aofItemsPerCmd*width)
+		cmd := newCommand(append([]string{name, key}, args[:n]...)...)
+		if err := w.Write(&cmd); err != nil {
+			return err
+		}
+		args = args[n:]
+	}
+	return nil
+}
+
+// bgrewriteaof implements BGREWRITEAOF.
+func bgrewriteaof(c *Client, v *Value, rg *RedisGo) *Value {
+	if err := rg.BgRewriteAof(); err != nil {
+		if errors.Is(err, errRewriteInProgress) {
+			return newError("ERR Background append only file rewriting already in progress")
+		}
+		return newError("ERR %v", err)
+	}
+	return newString("Background append only file rewriting started")
+}
+
+// newCommand builds a command array out of args as a client would send it.
+func newCommand(args ...string) Value {
+	return Value{Type: Array, Array: bulkValues(args)}
+}
+
+// propagateAs makes the command being executed be recorded in the AOF and
+// the replication stream as the command args instead, adding to any set
+// before. Handlers use it when replaying their command verbatim would not
+// reproduce its effect, such as a relative expiry or a random pop.
+func (c *Client) propagateAs(args ...string) {
+	c.propagate = append(c.propagate, newCommand(args...))
+}
+
+// propagateNone keeps the command being executed out of the AOF and the
+// replication stream, for write commands that ended up changing nothing.
+func (c *Client) propagateNone() {
+	c.propagate = []Value{}
+}
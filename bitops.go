@@ -0,0 +1,234 @@
+package main
+
+import (
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "setbit", handler: setBit, arity: 4, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "getbit", handler: getBit, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "bitcount", handler: bitCount, arity: -2, keys: oneKey},
+		&Command{name: "bitop", handler: bitOp, arity: -4, keys: keySpec{2, -1, 1}, isWrite: true, denyOOM: true},
+	)
+}
+
+// parseBitOffset parses the bit offset of SETBIT and GETBIT, which must fit
+// in a string of at most maxLen bytes, the proto-max-bulk-len.
+func parseBitOffset(arg string, maxLen int64) (int64, *Value) {
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 || offset>>3 >= maxLen {
+		return 0, newError("ERR bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+// bitAt returns the bit at offset in str, counting from the most significant
+// bit of the first byte; bits past the end of str are 0.
+func bitAt(str string, offset int64) int64 {
+	i := offset >> 3
+	if i >= int64(len(str)) {
+		return 0
+	}
+	return int64(str[i]>>(7-offset&7)) & 1
+}
+
+// setBit implements SETBIT key offset value, growing the string with zero
+// bytes as needed, and replies with the bit previously stored at offset.
+func setBit(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	offset, errv := parseBitOffset(v.Array[2].Bulk, rg.conf.protoLimits().maxBulkLen)
+	if errv != nil {
+		return errv
+	}
+	var bit byte
+	switch v.Array[3].Bulk {
+	case "0":
+	case "1":
+		bit = 1
+	default:
+		return newError("ERR bit is not an integer or out of range")
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	item := &Item{}
+	var buf []byte
+	if old != nil {
+		buf, item.Expiration = []byte(old.Value), old.Expiration
+	}
+	prev := bitAt(string(buf), offset)
+	if need := int(offset>>3) + 1; need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	shift := 7 - offset&7
+	buf[offset>>3] = buf[offset>>3]&^(1<<shift) | bit<<shift
+
+	item.Value = string(buf)
+	db.put(key, item)
+	db.notify(notifyString, "setbit", key)
+	return newInteger(prev)
+}
+
+// getBit implements GETBIT key offset.
+func getBit(c *Client, v *Value, rg *RedisGo) *Value {
+	offset, errv := parseBitOffset(v.Array[2].Bulk, rg.conf.protoLimits().maxBulkLen)
+	if errv != nil {
+		return errv
+	}
+	item, ok := rg.db(c).Get(v.Array[1].Bulk)
+	if !ok {
+		return newInteger(0)
+	}
+	if item.Kind != KindString {
+		return newError(errWrongType)
+	}
+	return newInteger(bitAt(item.Value, offset))
+}
+
+// bitCount implements BITCOUNT key [start end [BYTE|BIT]], counting the set
+// bits of the string, or of those between the inclusive offsets start and
+// end, given in bytes unless BIT is specified. Negative offsets count back
+// from the end as in GETRANGE.
+func bitCount(c *Client, v *Value, rg *RedisGo) *Value {
+	args := v.Array[2:]
+	var start, end int64
+	inBits := false
+	switch len(args) {
+	case 0:
+		start, end = 0, -1
+	case 2, 3:
+		var err1, err2 error
+		start, err1 = strconv.ParseInt(args[0].Bulk, 10, 64)
+		end, err2 = strconv.ParseInt(args[1].Bulk, 10, 64)
+		if err1 != nil || err2 != nil {
+			return newError(errNotInt)
+		}
+		if len(args) == 3 {
+			switch strings.ToUpper(args[2].Bulk) {
+			case "BYTE":
+			case "BIT":
+				inBits = true
+			default:
+				return newError(errSyntax)
+			}
+		}
+	default:
+		return newError(errSyntax)
+	}
+	item, ok := rg.db(c).Get(v.Array[1].Bulk)
+	if !ok {
+		return newInteger(0)
+	}
+	if item.Kind != KindString {
+		return newError(errWrongType)
+	}
+	str := item.Value
+	if !inBits {
+		from, to, ok := normRange(start, end, len(str))
+		if !ok {
+			return newInteger(0)
+		}
+		return newInteger(popCount(str[from : to+1]))
+	}
+	from, to, ok := normRange(start, end, len(str)*8)
+	if !ok {
+		return newInteger(0)
+	}
+	// Count the whole bytes in between, then the bits of the partial bytes
+	// at either end.
+	var n int64
+	for off := int64(from); off <= int64(to); {
+		if off&7 == 0 && off+7 <= int64(to) {
+			n += int64(bits.OnesCount8(str[off>>3]))
+			off += 8
+			continue
+		}
+		n += bitAt(str, off)
+		off++
+	}
+	return newInteger(n)
+}
+
+// bitOp implements BITOP AND|OR|XOR|NOT destkey key [key ...], storing the
+// result of the operation over the source strings at destkey and replying
+// with its length. Shorter strings are padded with zero bytes, missing keys
+// count as empty strings and an empty result deletes destkey.
+func bitOp(c *Client, v *Value, rg *RedisGo) *Value {
+	op := strings.ToUpper(v.Array[1].Bulk)
+	dest, srcKeys := v.Array[2].Bulk, bulkArgs(v.Array[3:])
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(srcKeys) != 1 {
+			return newError("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return newError(errSyntax)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(append([]string{dest}, srcKeys...)...)
+	defer unlock()
+
+	srcs := make([]string, len(srcKeys))
+	size := 0
+	for i, key := range srcKeys {
+		item, errv := db.getTyped(key, KindString)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		srcs[i] = item.Value
+		size = max(size, len(item.Value))
+	}
+	if size == 0 {
+		if db.remove(dest) {
+			db.notify(notifyGeneric, "del", dest)
+		}
+		return newInteger(0)
+	}
+	res := make([]byte, size)
+	copy(res, srcs[0])
+	for _, src := range srcs[1:] {
+		for i := range res {
+			var b byte
+			if i < len(src) {
+				b = src[i]
+			}
+			switch op {
+			case "AND":
+				res[i] &= b
+			case "OR":
+				res[i] |= b
+			case "XOR":
+				res[i] ^= b
+			}
+		}
+	}
+	if op == "NOT" {
+		for i := range res {
+			res[i] = ^res[i]
+		}
+	}
+	db.put(dest, &Item{Value: string(res)})
+	db.notify(notifyString, "set", dest)
+	return newInteger(int64(size))
+}
+
+// popCount returns the number of set bits in str.
+func popCount(str string) int64 {
+	var n int
+	for i := 0; i < len(str); i++ {
+		n += bits.OnesCount8(str[i])
+	}
+	return int64(n)
+}
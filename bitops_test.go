@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSetBit(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	wantInt := func(reply *Value, want int64) {
+		t.Helper()
+		if reply.Type != Integer || reply.Int != want {
+			t.Errorf("got %v, want %d", reply, want)
+		}
+	}
+	wantInt(do(rg, c, "setbit", "k", "7", "1"), 0)
+	wantInt(do(rg, c, "setbit", "k", "7", "1"), 1)
+	wantInt(do(rg, c, "setbit", "k", "1", "1"), 0)
+	if reply := do(rg, c, "get", "k"); reply.Bulk != "A" {
+		t.Errorf("GET k = %q, want \"A\"", reply.Bulk)
+	}
+	// Setting a bit past the end grows the string with zero bytes.
+	wantInt(do(rg, c, "setbit", "k", "23", "1"), 0)
+	if reply := do(rg, c, "get", "k"); reply.Bulk != "A\x00\x01" {
+		t.Errorf("GET k = %q, want \"A\\x00\\x01\"", reply.Bulk)
+	}
+	wantInt(do(rg, c, "setbit", "k", "7", "0"), 1)
+	wantInt(do(rg, c, "getbit", "k", "7"), 0)
+	wantInt(do(rg, c, "getbit", "k", "23"), 1)
+	wantInt(do(rg, c, "getbit", "k", "1000"), 0)
+
+	for _, args := range [][]string{
+		{"setbit", "k", "-1", "1"},
+		{"setbit", "k", "x", "1"},
+		{"setbit", "k", "0", "2"},
+		{"getbit", "k", "-1"},
+	} {
+		if reply := do(rg, c, args...); reply.Type != Error {
+			t.Errorf("%q = %v, want an error", args, reply)
+		}
+	}
+}
+
+func TestSetBitProtoMaxBulkLen(t *testing.T) {
+	rg := newTestServer(t, "proto-max-bulk-len 1mb")
+	c := NewClient(1, nil)
+	last := strconv.Itoa(8*1024*1024 - 1)
+	if reply := do(rg, c, "setbit", "k", last, "1"); reply.Type != Integer || reply.Int != 0 {
+		t.Fatalf("SETBIT at the last bit of the limit = %v, want 0", reply)
+	}
+	if reply := do(rg, c, "strlen", "k"); reply.Int != 1024*1024 {
+		t.Fatalf("STRLEN k = %v, want 1048576", reply)
+	}
+	past := strconv.Itoa(8 * 1024 * 1024)
+	for _, cmd := range []string{"setbit", "getbit"} {
+		args := []string{cmd, "k", past}
+		if cmd == "setbit" {
+			args = append(args, "1")
+		}
+		if reply := do(rg, c, args...); reply.Type != Error {
+			t.Errorf("%s past the limit = %v, want an error", cmd, reply)
+		}
+	}
+	// The limit follows CONFIG SET.
+	do(rg, c, "config", "set", "proto-max-bulk-len", "2mb")
+	if reply := do(rg, c, "setbit", "k", past, "1"); reply.Type != Integer {
+		t.Fatalf("SETBIT after raising the limit = %v, want an integer", reply)
+	}
+}
+
+func TestBitCount(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "k", "foobar")
+	tests := []struct {
+		args []string
+		want int64
+	}{
+		{nil, 26},
+		{[]string{"0", "0"}, 4},
+		{[]string{"1", "1"}, 6},
+		{[]string{"-2", "-1"}, 7},
+		{[]string{"0", "-1"}, 26},
+		{[]string{"3", "1"}, 0},
+		{[]string{"0", "100"}, 26},
+		{[]string{"5", "30", "bit"}, 17},
+		{[]string{"1", "1", "BYTE"}, 6},
+		{[]string{"0", "7", "bit"}, 4},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, append([]string{"bitcount", "k"}, tt.args...)...)
+		if reply.Type != Integer || reply.Int != tt.want {
+			t.Errorf("BITCOUNT k %q = %v, want %d", tt.args, reply, tt.want)
+		}
+	}
+	if reply := do(rg, c, "bitcount", "missing"); reply.Int != 0 {
+		t.Errorf("BITCOUNT missing = %v, want 0", reply)
+	}
+	for _, args := range [][]string{{"0"}, {"0", "1", "nibble"}, {"a", "1"}} {
+		if reply := do(rg, c, append([]string{"bitcount", "k"}, args...)...); reply.Type != Error {
+			t.Errorf("BITCOUNT k %q = %v, want an error", args, reply)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"slices"
+	"time"
+)
+
+// blockedClient is a client blocked in BLPOP or BRPOP until an element is
+// pushed to one of its keys, or in XREAD until an entry is added to one of
+// its streams, or until its timeout elapses.
+type blockedClient struct {
+	db      *RedisDb
+	keys    []string
+	left    bool
+	timeout time.Duration // timeout is how long to block, 0 meaning forever
+
+	// read is set for XREAD, nil for BLPOP and BRPOP.
+	read *streamRead
+
+	// reply receives the reply to send on behalf of the client, such as the
+	// key and element popped. It is buffered so the serving client never
+	// waits on the blocked one.
+	reply chan *Value
+}
+
+// streamRead holds what a client blocked in XREAD waits for: the entries
+// of each of its streams after the given ID, up to count of them, 0 meaning
+// no limit. resp3 tells how to shape the reply.
+type streamRead struct {
+	after map[string]StreamID
+	count int
+	resp3 bool
+}
+
+// block registers w as waiting on each of its keys, behind the clients
+// already waiting there. The caller must hold the shards of the keys, so
+// that nothing is added to them between checking and blocking. block is
+// thread-safe.
+func (rdb *RedisDb) block(w *blockedClient) {
+	rdb.blockedMu.Lock()
+	defer rdb.blockedMu.Unlock()
+
+	for _, key := range w.keys {
+		if !slices.Contains(rdb.blocked[key], w) {
+			rdb.blocked[key] = append(rdb.blocked[key], w)
+		}
+	}
+}
+
+// unblock removes w from the waiters of its keys. The caller must hold
+// rdb.blockedMu.
+func (rdb *RedisDb) unblock(w *blockedClient) {
+	for _, key := range w.keys {
+		waiters := slices.DeleteFunc(rdb.blocked[key], func(b *blockedClient) bool {
+			return b == w
+		})
+		if len(waiters) == 0 {
+			delete(rdb.blocked, key)
+		} else {
+			rdb.blocked[key] = waiters
+		}
+	}
+}
+
+// serveBlocked hands the elements of the list item stored at key to the
+// clients blocked on it, longest waiting first, until either runs out. It
+// returns the pops to record in the AOF in place of the handoffs. The caller
+// must hold the key's shard for writing. blockedMu is held throughout so that
+// a client blocked on several keys is served by one of them only.
+func (rdb *RedisDb) serveBlocked(key string, item *Item) []Value {
+	rdb.blockedMu.Lock()
+	defer rdb.blockedMu.Unlock()
+
+	var pops []Value
+	for _, w := range slices.Clone(rdb.blocked[key]) {
+		if len(item.List) == 0 {
+			break
+		}
+		if w.read != nil {
+			continue
+		}
+		rdb.unblock(w)
+
+		elem := popList(rdb, key, item, 1, w.left)[0]
+		w.reply <- newArray([]Value{
+			{Type: Bulk, Bulk: key},
+			{Type: Bulk, Bulk: elem},
+		})
+		if w.left {
+			pops = append(pops, newCommand("lpop", key))
+		} else {
+			pops = append(pops, newCommand("rpop", key))
+		}
+	}
+	return pops
+}
+
+// serveBlockedReads hands the entries added to the stream item stored at key
+// to the clients blocked in XREAD on it. The caller must hold the key's shard
+// for writing.
+func (rdb *RedisDb) serveBlockedReads(key string, item *Item) {
+	rdb.blockedMu.Lock()
+	defer rdb.blockedMu.Unlock()
+
+	for _, w := range slices.Clone(rdb.blocked[key]) {
+		if w.read == nil {
+			continue
+		}
+		entries := item.Stream.after(w.read.after[key], w.read.count)
+		if len(entries) == 0 {
+			continue
+		}
+		rdb.unblock(w)
+		w.reply <- xreadReply([]streamEntries{{key, entries}}, w.read.resp3)
+	}
+}
+
+// awaitUnblock waits until the client blocked by the command just dispatched
+// is served, its timeout elapses or the server shuts down, and returns the
+// reply to send. It returns nil if the client disconnected meanwhile.
+func (c *Client) awaitUnblock(rg *RedisGo) *Value {
+	w := c.blocked
+	c.blocked = nil
+
+	rg.blockedClients.Add(1)
+	defer rg.blockedClients.Add(-1)
+
+	// The replies held back for pipelining must go out before blocking.
+	c.writeMu.Lock()
+	err := c.writer.Flush()
+	c.writeMu.Unlock()
+
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var gone <-chan struct{}
+	if err == nil {
+		var stop func()
+		gone, stop = c.watchDisconnect()
+		defer stop()
+
+		select {
+		case reply := <-w.reply:
+			return reply
+		case <-timeout:
+		case <-rg.conf.quit:
+		case <-gone:
+		}
+	}
+	w.db.blockedMu.Lock()
+	w.db.unblock(w)
+	w.db.blockedMu.Unlock()
+
+	select {
+	case reply := <-w.reply:
+		// Served after all while giving up.
+		return reply
+	default:
+	}
+	if err != nil || isClosed(gone) {
+		return nil
+	}
+	return newNullArray()
+}
+
+// watchDisconnect watches the connection of c for the peer hanging up while
+// the client is blocked and not reading commands. The returned channel is
+// closed if it does. stop ends the watch, and must be called before the
+// connection is read again.
+func (c *Client) watchDisconnect() (gone <-chan struct{}, stop func()) {
+	goneCh := make(chan struct{})
+	finished := make(chan struct{})
+
+	// A blocked client is not subject to the idle timeout.
+	_ = c.conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(finished)
+		// Peek leaves any pipelined command buffered for serve.
+		if _, err := c.reader.Peek(1); err != nil && !isTimeout(err) {
+			close(goneCh)
+		}
+	}()
+	return goneCh, func() {
+		_ = c.conn.SetReadDeadline(time.Now())
+		<-finished
+	}
+}
+
+// isClosed reports whether ch is closed, without blocking.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// waitBlocked waits until n clients are blocked on rg.
+func waitBlocked(t *testing.T, rg *RedisGo, n int64) {
+	t.Helper()
+	waitFor(t, "clients did not block", func() bool {
+		return rg.blockedClients.Load() == n
+	})
+}
+
+func TestBLPopWokenByRPush(t *testing.T) {
+	rg := newTestServer(t)
+	reader, writer := dial(t, rg), dial(t, rg)
+
+	reader.send("blpop", "list", "0")
+	waitBlocked(t, rg, 1)
+	if reply := writer.do("rpush", "list", "a"); reply.Type != Integer {
+		t.Fatalf("RPUSH = %v", reply)
+	}
+	reply := reader.read(5 * time.Second)
+	if reply.Type != Array || len(reply.Array) != 2 || reply.Array[0].Bulk != "list" || reply.Array[1].Bulk != "a" {
+		t.Fatalf("BLPOP = %v, want [list a]", reply)
+	}
+	waitBlocked(t, rg, 0)
+	// The element went to the blocked client, not into the list.
+	if reply := writer.do("llen", "list"); reply.Int != 0 {
+		t.Fatalf("LLEN after the handoff = %v, want 0", reply)
+	}
+}
+
+func TestBLPopServesClientsInOrder(t *testing.T) {
+	rg := newTestServer(t)
+	readers := []*testConn{dial(t, rg), dial(t, rg), dial(t, rg)}
+	writer := dial(t, rg)
+
+	// Block the readers one at a time, so the order they wait in is known.
+	for i, reader := range readers {
+		reader.send("blpop", "list", "0")
+		waitBlocked(t, rg, int64(i+1))
+	}
+	writer.do("rpush", "list", "a", "b", "c", "d")
+	for i, want := range []string{"a", "b", "c"} {
+		reply := readers[i].read(5 * time.Second)
+		if reply.Type != Array || len(reply.Array) != 2 || reply.Array[1].Bulk != want {
+			t.Errorf("BLPOP of reader %d = %v, want [list %s]", i, reply, want)
+		}
+	}
+	if reply := writer.do("lrange", "list", "0", "-1"); len(reply.Array) != 1 || reply.Array[0].Bulk != "d" {
+		t.Fatalf("LRANGE after the handoffs = %v, want [d]", reply)
+	}
+}
+
+func TestBLPopTimesOut(t *testing.T) {
+	rg := newTestServer(t)
+	reader := dial(t, rg)
+	start := time.Now()
+	if reply := reader.do("blpop", "list", "0.05"); reply.Type != NullArray {
+		t.Errorf("BLPOP timing out = %v, want a null array", reply)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("BLPOP returned after %v, before its timeout", elapsed)
+	}
+	waitBlocked(t, rg, 0)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxPendingPushes bounds the push messages queued for a client. A client
+// that falls this far behind is disconnected rather than let the queue grow
+// without bound, like Redis's pubsub output buffer limit.
+const maxPendingPushes = 1 << 16
+
+// Client holds the state of a single client connection. A Client is owned by
+// the goroutine serving it; fields are not synchronized unless noted.
+type Client struct {
+	id        int64
+	conn      net.Conn
+	reader    *bufio.Reader
+	writer    *Writer
+	createdAt time.Time
+
+	// dbIndex is the index of the logical database selected with SELECT.
+	// Other goroutines read it, name and user, holding the server's
+	// clientsMu, under which the client writes them.
+	dbIndex int
+	name    string // name is the connection name set with CLIENT SETNAME
+
+	// user is the ACL user the client runs commands as: the default user
+	// until it authenticates as another. It is nil for the AOF replay pseudo
+	// client, which is not subject to ACL rules.
+	user *aclUser
+
+	// lastActive is when the client last sent a command, in unix nanoseconds.
+	lastActive atomic.Int64
+
+	// authenticated is set once the client passed AUTH. Only meaningful while
+	// the server requires authentication.
+	authenticated bool
+
+	// closeAfterReply makes serve close the connection once the reply to the
+	// current command is written, as requested by QUIT.
+	closeAfterReply bool
+
+	// propagate, when non-nil, holds the commands recorded in the AOF and
+	// the replication stream in place of the write command being executed;
+	// an empty slice records nothing. It is reset before every write command
+	// and set through propagateAs and propagateNone.
+	propagate []Value
+
+	// multi is set by MULTI until EXEC or DISCARD. Meanwhile commands are
+	// queued in queued rather than executed, and txFailed records whether
+	// one was rejected, in which case EXEC discards the transaction.
+	multi    bool
+	queued   []Value
+	txFailed bool
+
+	// watched holds the keys watched with WATCH, which make EXEC fail if any
+	// is modified before it runs.
+	watched []watchedKey
+
+	// channels and patterns hold the channels and glob patterns the client
+	// is subscribed to, guarded by the server's pubsub lock.
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	// pushes queues the push messages, such as pub/sub deliveries, sent to
+	// the client by other goroutines. They are written ahead of the next
+	// reply, or by pushLoop when the client is idle; pushReady wakes it up.
+	// pushes is guarded by pushMu.
+	pushes    []Value
+	pushMu    sync.Mutex
+	pushReady chan struct{}
+	pushing   bool // pushing is set once pushLoop runs
+
+	// writeMu serializes writes to the connection between serve and
+	// pushLoop.
+	writeMu sync.Mutex
+
+	// monitor is set once the client ran MONITOR and receives every command
+	// processed by the server.
+	monitor bool
+
+	// done is closed once the client is removed from the server.
+	done chan struct{}
+
+	// blocked is set by BLPOP and BRPOP when they found no element to pop,
+	// and by XREAD with BLOCK when it found no new entry, making serve wait
+	// for one before replying.
+	blocked *blockedClient
+
+	// replica is set once the client synchronized with SYNC or PSYNC. It
+	// then receives the replication stream as push messages and no replies.
+	// replPort is the port it listens on, as announced with REPLCONF, and
+	// replAck the offset it last acknowledged, at replAckAt in unix
+	// nanoseconds.
+	replica   bool
+	replPort  int
+	replAck   atomic.Int64
+	replAckAt atomic.Int64
+
+	// master is set on the pseudo client applying the replication stream of
+	// the master this server replicates, which alone may write to a replica.
+	master bool
+}
+
+// NewClient wraps conn into a Client identified by id.
+func NewClient(id int64, conn net.Conn) *Client {
+	c := &Client{
+		id:        id,
+		conn:      conn,
+		writer:    NewWriter(conn),
+		createdAt: time.Now(),
+		pushReady: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	c.reader = bufio.NewReader(flushingReader{c})
+	c.lastActive.Store(c.createdAt.UnixNano())
+	return c
+}
+
+// flushingReader reads from the connection of c, first flushing the replies
+// serve held back while pipelined commands remained buffered. This covers a
+// command that only partly arrived, whose sender may be waiting for the
+// earlier replies before sending the rest.
+type flushingReader struct {
+	c *Client
+}
+
+func (fr flushingReader) Read(p []byte) (int, error) {
+	fr.c.writeMu.Lock()
+	err := fr.c.writer.Flush()
+	fr.c.writeMu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return fr.c.conn.Read(p)
+}
+
+// serve reads commands from the client, dispatches them and writes back the
+// replies until the client disconnects or the connection fails. The client is
+// removed from the server and its connection closed on return.
+func (c *Client) serve(rg *RedisGo) {
+	defer rg.removeClient(c)
+
+	for {
+		if !c.setIdleDeadline(rg) {
+			return
+		}
+		var v Value
+		if err := v.readArray(c.reader, rg.conf.protoLimits()); err != nil {
+			switch {
+			case errors.Is(err, errProtocol):
+				// The rest of the stream can't be parsed, so the connection
+				// is closed, but the client is told why first.
+				log.Printf("client id=%d %v", c.id, err)
+				_ = c.writeReply(newError("ERR %v", err), true)
+			case !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) &&
+				!errors.Is(err, io.ErrUnexpectedEOF) && !isTimeout(err):
+				log.Printf("client id=%d read failed: %v", c.id, err)
+			}
+			return
+		}
+		c.lastActive.Store(time.Now().UnixNano())
+		reply := rg.dispatch(c, &v)
+		if c.replica {
+			reply = nil
+		}
+		if c.blocked != nil {
+			if reply = c.awaitUnblock(rg); reply == nil {
+				return
+			}
+		}
+
+		// A pipelining client sends many commands at once. Their replies are
+		// only flushed once every command read has been served, saving a
+		// write per command; see also flushingReader.
+		flush := c.reader.Buffered() == 0 || c.closeAfterReply
+		if err := c.writeReply(reply, flush); err != nil {
+			log.Printf("client id=%d write failed: %v", c.id, err)
+			return
+		}
+		if c.closeAfterReply {
+			return
+		}
+	}
+}
+
+// setIdleDeadline sets the read deadline of the connection from the timeout
+// config, so that a client idle for longer is disconnected; clients in
+// pub/sub or monitor mode and replicas are expected to stay idle and are
+// exempt. It reports false if the server is shutting down, since the deadline
+// could otherwise override the one set by drainClients.
+func (c *Client) setIdleDeadline(rg *RedisGo) bool {
+	var deadline time.Time
+	if timeout := rg.conf.idleTimeout(); timeout > 0 && !c.monitor && !c.replica && c.subscriptions() == 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = c.conn.SetReadDeadline(deadline)
+
+	select {
+	case <-rg.conf.quit:
+		return false
+	default:
+		return true
+	}
+}
+
+// writeReply writes the queued push messages followed by reply, flushing them
+// if flush is set. A nil reply writes only the pushes, for commands such as
+// SUBSCRIBE whose replies are pushes themselves.
+func (c *Client) writeReply(reply *Value, flush bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.pushMu.Lock()
+	pushes := c.pushes
+	c.pushes = nil
+	c.pushMu.Unlock()
+
+	for i := range pushes {
+		if err := c.writer.Write(&pushes[i]); err != nil {
+			return err
+		}
+	}
+	if reply != nil {
+		if err := c.writer.Write(reply); err != nil {
+			return err
+		}
+	}
+	if !flush {
+		return nil
+	}
+	return c.writer.Flush()
+}
+
+// push queues v to be sent to the client without waiting for the network, so
+// a slow client never holds up the sender. A client whose queue is full is
+// disconnected. push is thread-safe.
+func (c *Client) push(v Value) {
+	c.pushMu.Lock()
+	if len(c.pushes) >= maxPendingPushes {
+		c.pushMu.Unlock()
+		log.Printf("client id=%d closed for exceeding the push queue limit", c.id)
+		_ = c.conn.Close()
+		return
+	}
+	c.pushes = append(c.pushes, v)
+	c.pushMu.Unlock()
+
+	select {
+	case c.pushReady <- struct{}{}:
+	default:
+	}
+}
+
+// startPushLoop starts pushLoop unless it is running already. It is called by
+// the goroutine serving c when it starts receiving pushes.
+func (c *Client) startPushLoop() {
+	if !c.pushing {
+		c.pushing = true
+		go c.pushLoop()
+	}
+}
+
+// pushLoop writes the push messages queued for c while it is idle, until the
+// client is removed.
+func (c *Client) pushLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.pushReady:
+			if err := c.writeReply(nil, true); err != nil {
+				log.Printf("client id=%d write failed: %v", c.id, err)
+				_ = c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// isTimeout reports whether err is a network timeout, as caused by the read
+// deadline set when the server is shutting down.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
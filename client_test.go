@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProtocolErrorReplied(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "multibulk length",
+			request: "*x\r\n",
+			want:    "-ERR Protocol error: invalid multibulk length\r\n",
+		},
+		{
+			name:    "bulk length",
+			request: "*1\r\n$-2\r\n",
+			want:    "-ERR Protocol error: invalid bulk length\r\n",
+		},
+		{
+			name:    "bulk prefix",
+			request: "*1\r\n:1\r\n",
+			want:    "-ERR Protocol error: expected '$', got ':'\r\n",
+		},
+		{
+			name:    "inline quotes",
+			request: "set \"k v\r\n",
+			want:    "-ERR Protocol error: unbalanced quotes in request\r\n",
+		},
+		{
+			name:    "inline closing quote",
+			request: "set \"k\"v\r\n",
+			want:    "-ERR Protocol error: unbalanced quotes in request\r\n",
+		},
+	}
+	rg := newTestServer(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := connect(t, rg)
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			// A valid command ahead of the error is still served.
+			if _, err := io.WriteString(conn, "PING\r\n"+tt.request); err != nil {
+				t.Fatal(err)
+			}
+			// The connection is closed after the error reply.
+			got, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "+PONG\r\n" + tt.want; string(got) != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestPipelinedReplies(t *testing.T) {
+	rg := newTestServer(t)
+	conn := connect(t, rg)
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// Each SET replies with the value set by the one before it, so the
+	// replies show the order the commands ran in.
+	const n = 1000
+	var request, want strings.Builder
+	want.WriteString("$-1\r\n")
+	for i := range n {
+		request.WriteString(respOf(newCommand("set", "k", strconv.Itoa(i), "get")))
+		if i < n-1 {
+			want.WriteString(respOf(*newBulk(strconv.Itoa(i))))
+		}
+	}
+	go func() { _, _ = io.WriteString(conn, request.String()) }()
+
+	got := make([]byte, want.Len())
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want.String() {
+		t.Errorf("got %q, want %q", got, want.String())
+	}
+}
+
+func BenchmarkPipeline(b *testing.B) {
+	for _, depth := range []int{1, 16, 128} {
+		b.Run("depth="+strconv.Itoa(depth), func(b *testing.B) {
+			rg := newTestServer(b)
+			conn := connect(b, rg)
+			r := bufio.NewReader(conn)
+			batch := strings.Repeat(respOf(newCommand("set", "k", "v")), depth)
+
+			for b.Loop() {
+				if _, err := io.WriteString(conn, batch); err != nil {
+					b.Fatal(err)
+				}
+				for range depth {
+					if _, err := r.ReadSlice('\n'); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.N*depth)/b.Elapsed().Seconds(), "cmds/s")
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "command", handler: commandCmd, arity: -1, help: commandHelp},
+	)
+}
+
+// commandHelp is the reply to COMMAND HELP.
+var commandHelp = []string{
+	"(no subcommand)",
+	"    Return details about all commands.",
+	"COUNT",
+	"    Return the total number of commands in this server.",
+	"LIST",
+	"    Return a list of all commands in this server.",
+	"INFO [<command-name> ...]",
+	"    Return details about multiple commands.",
+	"    If no command names are given, documentation details for all",
+	"    commands are returned.",
+	"DOCS [<command-name> ...]",
+	"    Return documentation details about multiple commands.",
+	"    If no command names are given, documentation details for all",
+	"    commands are returned.",
+}
+
+// Handler executes a single command on behalf of client c. v holds the whole
+// command array with the command name at v.Array[0]; the returned value is
+// written back to the client as the reply.
+type Handler func(c *Client, v *Value, rg *RedisGo) *Value
+
+// Command describes a command the server knows how to dispatch.
+type Command struct {
+	// name is the lowercase command name.
+	name string
+
+	// handler executes the command.
+	handler Handler
+
+	// arity is the number of arguments including the command name. A negative
+	// arity -N means at least N arguments, mirroring Redis's COMMAND output.
+	arity int
+
+	// keys locates the key arguments, reported by COMMAND.
+	keys keySpec
+
+	// numKeys is the position of an argument counting the keys right after
+	// it, for commands such as SINTERCARD taking a variable number of keys.
+	// Zero means the command has no such argument.
+	numKeys int
+
+	// noAuth allows the command to run before the client has authenticated.
+	noAuth bool
+
+	// noMulti rejects the command inside a transaction.
+	noMulti bool
+
+	// isWrite marks commands that modify the keyspace.
+	isWrite bool
+
+	// denyOOM marks write commands that may grow memory usage and are
+	// therefore refused once maxmemory is reached. Commands that only shrink
+	// the dataset, such as DEL, stay allowed so clients can free memory.
+	denyOOM bool
+
+	// fast marks commands that run in constant or logarithmic time, reported
+	// by COMMAND.
+	fast bool
+
+	// help describes the subcommands of a container command such as CONFIG,
+	// each as a usage line followed by indented description lines, replied
+	// to <command> HELP. Nil means the command has no subcommands.
+	help []string
+}
+
+// keySpec locates the key arguments of a command the way Redis's legacy
+// first key, last key and step triple does: keys are at positions first,
+// first+step, ... up to last, where a negative last counts from the end of
+// the arguments. The zero keySpec means the command takes no keys.
+type keySpec struct {
+	first, last, step int
+}
+
+// Key specs shared by most commands.
+var (
+	oneKey   = keySpec{1, 1, 1}  // oneKey is a single key right after the command name.
+	allKeys  = keySpec{1, -1, 1} // allKeys is every argument.
+	keyPairs = keySpec{1, -1, 2} // keyPairs is every other argument, as in MSET key value ...
+)
+
+// commands is the registry of every command the server can dispatch keyed by
+// lowercase name. Files implementing commands add to it from their init funcs
+// via register.
+var commands = make(map[string]*Command)
+
+// register adds cmds to the command registry. It panics on a duplicate name
+// since that is always a programming error.
+func register(cmds ...*Command) {
+	for _, cmd := range cmds {
+		if _, ok := commands[cmd.name]; ok {
+			panic("command registered twice: " + cmd.name)
+		}
+		commands[cmd.name] = cmd
+	}
+}
+
+// arityOK reports whether argc arguments (including the command name) satisfy
+// the command's arity.
+func (cmd *Command) arityOK(argc int) bool {
+	if cmd.arity >= 0 {
+		return argc == cmd.arity
+	}
+	return argc >= -cmd.arity
+}
+
+// dispatch looks up the command named by v.Array[0], validates its arity and
+// executes it, returning the reply to send to the client. While the client is
+// in a transaction the command is queued for EXEC instead.
+func (rg *RedisGo) dispatch(c *Client, v *Value) *Value {
+	if len(v.Array) == 0 {
+		return c.failTx(newError("ERR empty command"))
+	}
+	name := strings.ToLower(v.Array[0].Bulk)
+
+	cmd, ok := commands[name]
+	if !ok {
+		return c.failTx(newError("ERR unknown command '%s'", v.Array[0].Bulk))
+	}
+	stats := rg.cmdStats[name]
+	if !c.authenticated && !cmd.noAuth && rg.acl.authRequired() {
+		stats.rejected.Add(1)
+		return c.failTx(newError("NOAUTH Authentication required."))
+	}
+	if !cmd.arityOK(len(v.Array)) {
+		stats.rejected.Add(1)
+		return c.failTx(newError("ERR wrong number of arguments for '%s' command", name))
+	}
+	if !cmd.noAuth {
+		if errv := rg.acl.check(c.user, cmd, v); errv != nil {
+			stats.rejected.Add(1)
+			return c.failTx(errv)
+		}
+	}
+	if cmd.isWrite && !c.master && rg.master.Load() != nil {
+		stats.rejected.Add(1)
+		return c.failTx(newError("READONLY You can't write against a read only replica."))
+	}
+	if c.multi && cmd.noMulti {
+		stats.rejected.Add(1)
+		return c.failTx(newError("ERR Command not allowed inside a transaction"))
+	}
+	if c.subscriptions() > 0 && c.writer.proto == 2 && !allowedSubscribed(name) {
+		stats.rejected.Add(1)
+		return subscribedError(name)
+	}
+	if c.multi && !controlsTx(name) {
+		c.queued = append(c.queued, *v)
+		return newString("QUEUED")
+	}
+	// EXEC takes txMu for writing itself to run the whole transaction
+	// without other commands interleaving.
+	if name != "exec" {
+		rg.txMu.RLock()
+		defer rg.txMu.RUnlock()
+	}
+	return rg.call(c, cmd, v)
+}
+
+// call executes cmd on behalf of client c, recording it in the AOF, the
+// replication stream, the stats and the slow log. It is the part of dispatch
+// that EXEC repeats for every queued command; the caller must hold txMu.
+func (rg *RedisGo) call(c *Client, cmd *Command, v *Value) *Value {
+	stats := rg.cmdStats[cmd.name]
+	if cmd.denyOOM && !rg.loading && !rg.checkMemory(v) {
+		stats.rejected.Add(1)
+		return newError("OOM command not allowed when used memory > 'maxmemory'.")
+	}
+	rg.genStats.totalCommands.Add(1)
+	if !c.monitor {
+		rg.feedMonitors(c, v)
+	}
+
+	var reply *Value
+	if cmd.isWrite {
+		c.propagate = nil
+	}
+	start := time.Now()
+	switch {
+	case cmd.isWrite:
+		reply = rg.execWrite(c, v, cmd)
+	case cmd.isHelp(v):
+		reply = cmd.helpReply()
+	default:
+		reply = cmd.handler(c, v, rg)
+	}
+	duration := time.Since(start)
+	stats.calls.Add(1)
+	stats.duration.Add(int64(duration))
+	if reply != nil && reply.Type == Error {
+		stats.failed.Add(1)
+	}
+	rg.logIfSlow(c, v, start, duration)
+	if cmd.fast {
+		rg.sampleLatency("fast-command", duration)
+	} else {
+		rg.sampleLatency("command", duration)
+	}
+	if cmd.isWrite && reply.Type != Error {
+		rg.dirty.Add(1)
+		rg.updatePeakMem()
+		// Keys are modified in place by many handlers, so the watchers are
+		// told here unless the handler reported that nothing changed.
+		if c.propagate == nil || len(c.propagate) > 0 {
+			for _, key := range cmd.keyArgs(v) {
+				rg.db(c).touchWatched(key)
+			}
+		}
+	}
+	return reply
+}
+
+// isHelp reports whether v invokes the HELP subcommand of cmd.
+func (cmd *Command) isHelp(v *Value) bool {
+	return cmd.help != nil && len(v.Array) == 2 && strings.EqualFold(v.Array[1].Bulk, "HELP")
+}
+
+// helpReply returns the reply to the HELP subcommand of cmd: its help lines
+// between a header and the description of HELP itself.
+func (cmd *Command) helpReply() *Value {
+	name := strings.ToUpper(cmd.name)
+	lines := make([]string, 0, len(cmd.help)+3)
+	lines = append(lines, name+" <subcommand> [<arg> [value] [opt] ...]. Subcommands are:")
+	lines = append(lines, cmd.help...)
+	lines = append(lines, "HELP", "    Print this help.")
+	return newArray(statusValues(lines))
+}
+
+// unknownSubcommand returns the error replied to a subcommand of the
+// container command name it doesn't know or that got the wrong number of
+// arguments.
+func unknownSubcommand(name, sub string) *Value {
+	return newError("ERR unknown subcommand or wrong number of arguments for '%s'. Try %s HELP.", sub, strings.ToUpper(name))
+}
+
+// keyArgs returns the key arguments of the invocation v of cmd, as located by
+// its key spec and numkeys argument.
+func (cmd *Command) keyArgs(v *Value) []string {
+	var keys []string
+	if cmd.keys.first > 0 {
+		last := cmd.keys.last
+		if last < 0 {
+			last += len(v.Array)
+		}
+		for i := cmd.keys.first; i <= last && i < len(v.Array); i += cmd.keys.step {
+			keys = append(keys, v.Array[i].Bulk)
+		}
+	}
+	if cmd.numKeys > 0 && cmd.numKeys < len(v.Array) {
+		n, err := strconv.Atoi(v.Array[cmd.numKeys].Bulk)
+		if err != nil || n < 0 {
+			return keys
+		}
+		for i := cmd.numKeys + 1; i <= cmd.numKeys+n && i < len(v.Array); i++ {
+			keys = append(keys, v.Array[i].Bulk)
+		}
+	}
+	return keys
+}
+
+// parseNumKeys parses the numkeys argument at args[0] and returns the keys
+// following it along with the remaining arguments.
+func parseNumKeys(args []Value) (keys []string, rest []Value, errv *Value) {
+	n, err := strconv.Atoi(args[0].Bulk)
+	if err != nil {
+		return nil, nil, newError(errNotInt)
+	}
+	if n <= 0 {
+		return nil, nil, newError("ERR numkeys should be greater than 0")
+	}
+	if n > len(args)-1 {
+		return nil, nil, newError("ERR Number of keys can't be greater than number of args")
+	}
+	return bulkArgs(args[1 : n+1]), args[n+1:], nil
+}
+
+// hasKeys reports whether the command takes key arguments.
+func (cmd *Command) hasKeys() bool {
+	return cmd.keys.first > 0 || cmd.numKeys > 0
+}
+
+// flags returns the command flags reported by COMMAND.
+func (cmd *Command) flags() []string {
+	var flags []string
+	switch {
+	case cmd.isWrite:
+		flags = append(flags, "write")
+	case cmd.hasKeys():
+		flags = append(flags, "readonly")
+	}
+	if cmd.denyOOM {
+		flags = append(flags, "denyoom")
+	}
+	if cmd.noAuth {
+		flags = append(flags, "no_auth")
+	}
+	if cmd.noMulti {
+		flags = append(flags, "no_multi")
+	}
+	if cmd.fast {
+		flags = append(flags, "fast")
+	}
+	if cmd.numKeys > 0 {
+		flags = append(flags, "movablekeys")
+	}
+	return flags
+}
+
+// categories returns the ACL categories reported by COMMAND, derived from the
+// command's flags.
+func (cmd *Command) categories() []string {
+	var cats []string
+	switch {
+	case cmd.isWrite:
+		cats = append(cats, "@write")
+	case cmd.hasKeys():
+		cats = append(cats, "@read")
+	}
+	if cmd.fast {
+		return append(cats, "@fast")
+	}
+	return append(cats, "@slow")
+}
+
+// info returns the COMMAND INFO entry of the command: name, arity, flags, the
+// first key, last key and step, ACL categories, then tips, key specifications
+// and subcommands, which aren't tracked and are always empty.
+func (cmd *Command) info() Value {
+	return Value{Type: Array, Array: []Value{
+		{Type: Bulk, Bulk: cmd.name},
+		{Type: Integer, Int: int64(cmd.arity)},
+		*newSet(statusValues(cmd.flags())),
+		{Type: Integer, Int: int64(cmd.keys.first)},
+		{Type: Integer, Int: int64(cmd.keys.last)},
+		{Type: Integer, Int: int64(cmd.keys.step)},
+		*newSet(statusValues(cmd.categories())),
+		{Type: Array, Array: []Value{}},
+		{Type: Array, Array: []Value{}},
+		{Type: Array, Array: []Value{}},
+	}}
+}
+
+// statusValues converts strs into an array of simple string values.
+func statusValues(strs []string) []Value {
+	vals := make([]Value, len(strs))
+	for i, str := range strs {
+		vals[i] = Value{Type: String, Str: str}
+	}
+	return vals
+}
+
+// commandNames returns the names of every registered command, sorted.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// commandCmd implements COMMAND [COUNT|LIST|INFO [name ...]|DOCS [name ...]],
+// describing the commands the server knows. Without a subcommand it replies
+// like COMMAND INFO for every command.
+func commandCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	if len(v.Array) == 1 {
+		return commandInfo(commandNames())
+	}
+	args := bulkArgs(v.Array[2:])
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "COUNT" && len(args) == 0:
+		return newInteger(int64(len(commands)))
+	case sub == "LIST" && len(args) == 0:
+		return newArray(bulkValues(commandNames()))
+	case sub == "INFO":
+		if len(args) == 0 {
+			args = commandNames()
+		}
+		return commandInfo(args)
+	case sub == "DOCS":
+		if len(args) == 0 {
+			args = commandNames()
+		}
+		// Documentation isn't tracked, so every known command gets an
+		// empty doc map. Unknown names are left out, like Redis does.
+		docs := make([]Value, 0, 2*len(args))
+		for _, name := range args {
+			if cmd, ok := commands[strings.ToLower(name)]; ok {
+				docs = append(docs, Value{Type: Bulk, Bulk: cmd.name}, *newMap([]Value{}))
+			}
+		}
+		return newMap(docs)
+	default:
+		return unknownSubcommand("command", v.Array[1].Bulk)
+	}
+}
+
+// commandInfo replies with the COMMAND INFO entry of each command in names,
+// or a null for names that aren't commands.
+func commandInfo(names []string) *Value {
+	vals := make([]Value, len(names))
+	for i, name := range names {
+		if cmd, ok := commands[strings.ToLower(name)]; ok {
+			vals[i] = cmd.info()
+		} else {
+			vals[i] = Value{Type: NullArray}
+		}
+	}
+	return newArray(vals)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigHelp(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	reply := do(rg, c, "config", "help")
+	if reply.Type != Array || len(reply.Array) == 0 {
+		t.Fatalf("CONFIG HELP = %v, want a non-empty array", reply)
+	}
+	if first := reply.Array[0].Str; !strings.HasPrefix(first, "CONFIG ") {
+		t.Errorf("CONFIG HELP starts with %q, want it to mention CONFIG", first)
+	}
+}
+
+func TestContainerCommandsHelp(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	for name, cmd := range commands {
+		if cmd.help == nil {
+			continue
+		}
+		reply := do(rg, c, name, "HeLp")
+		if reply.Type != Array || len(reply.Array) < 3 {
+			t.Errorf("%s HELP = %v, want its help lines", name, reply)
+			continue
+		}
+		if first := reply.Array[0].Str; !strings.HasPrefix(first, strings.ToUpper(name)+" ") {
+			t.Errorf("%s HELP starts with %q", name, first)
+		}
+		if last := reply.Array[len(reply.Array)-1].Str; last != "    Print this help." {
+			t.Errorf("%s HELP ends with %q", name, last)
+		}
+	}
+	if reply := do(rg, c, "config", "nosuch"); reply.Type != Error || !strings.Contains(reply.Err, "CONFIG HELP") {
+		t.Errorf("CONFIG NOSUCH = %v, want an error pointing to CONFIG HELP", reply)
+	}
+}
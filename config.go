@@ -6,8 +6,11 @@ import (
 	"log"
 	"math"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // FSyncMode controls how often the AOF file is flushed to disk.
@@ -63,6 +66,19 @@ const (
 	VolatileLFU Eviction = "volatile-lfu"
 )
 
+// RDBFormat is the format RDB files are saved in, as set by rdb-format.
+// Files in either format are loaded whatever the setting.
+type RDBFormat string
+
+const (
+	// GobRDB saves the databases gob-encoded, only readable by this server.
+	GobRDB RDBFormat = "gob"
+
+	// RedisRDB saves the databases in the RDB format of Redis, version 9,
+	// which Redis and its tools can load.
+	RedisRDB RDBFormat = "redis"
+)
+
 // RDbSnapshot defines a condition under which an RDB snapshot is triggered.
 // A snapshot is taken when at least KeysChanged keys have been modified
 // within the last Secs seconds.
@@ -75,9 +91,22 @@ type RDbSnapshot struct {
 // are safe defaults — a Config with no persistence, no auth, no memory limit,
 // and no eviction.
 type Config struct {
+	// mu guards the fields that can be changed at runtime through CONFIG SET.
+	// Code reading those fields while the server runs goes through the locked
+	// accessors below.
+	mu sync.RWMutex
+
 	// configFP is the path to the config file, used for INFO output.
 	configFP string
 
+	// port is the TCP port the server listens on. Defaults to 6379.
+	port int
+
+	// quit is closed to signal a graceful shutdown of the server and all of its
+	// background goroutines, once, through shutdown.
+	quit     chan struct{}
+	quitOnce sync.Once
+
 	// dir is the working directory for RDB and AOF files.
 	dir string
 
@@ -88,6 +117,10 @@ type Config struct {
 	// rdbFn is the filename for the RDB snapshot file.
 	rdbFn string
 
+	// rdbFormat is the format RDB snapshots are saved and sent to replicas
+	// in. Defaults to GobRDB.
+	rdbFormat RDBFormat
+
 	// aofEnabled controls whether AOF persistence is active.
 	aofEnabled bool
 
@@ -97,13 +130,33 @@ type Config struct {
 	// aofFsync controls the AOF flush frequency.
 	aofFsync FSyncMode
 
-	// requirepass controls whether AUTH is required before commands are accepted.
-	requirepass bool
+	// aofRewritePerc triggers an automatic AOF rewrite once the file has grown
+	// by this percentage over its size after the last rewrite. 0 disables
+	// automatic rewrites. Defaults to 100, matching Redis's default.
+	aofRewritePerc int
+
+	// aofRewriteMinSize is the size in bytes the AOF must reach before it is
+	// rewritten automatically. Defaults to 64mb, matching Redis's default.
+	aofRewriteMinSize uint64
 
-	// password is the required AUTH password. Only meaningful if requirepass is
-	// true.
+	// password is set by requirepass as the password of the default ACL
+	// user. Empty means the default user takes none, so clients need not
+	// authenticate.
 	password string
 
+	// masterHost and masterPort are the address of the master the server
+	// replicates from startup, as set by replicaof. An empty masterHost
+	// starts it as a master.
+	masterHost string
+	masterPort int
+
+	// masterUser and masterAuth are the credentials a replica authenticates
+	// to its master with, as set by masteruser and masterauth. An empty
+	// masterAuth skips authentication, and an empty masterUser
+	// authenticates as the default user.
+	masterUser string
+	masterAuth string
+
 	// maxmem is the maximum memory in bytes before eviction is triggered.
 	// 0 means no limit.
 	maxmem uint64
@@ -111,10 +164,63 @@ type Config struct {
 	// eviction is the eviction policy applied when maxmem is reached.
 	eviction Eviction
 
+	// databases is the number of logical databases selectable with SELECT.
+	// Defaults to 16, matching Redis's default.
+	databases int
+
+	// hz is how many times a second background tasks such as active expiry
+	// run. Defaults to 10, matching Redis's default.
+	hz int
+
+	// activeExpireSamples is the number of keys with an expiry sampled per
+	// active expiry pass. Defaults to 20.
+	activeExpireSamples int
+
 	// memSamples is the number of keys sampled during eviction candidate selection.
 	// Higher values give more accurate eviction at the cost of CPU. Defaults to 5
 	// if not set, matching Redis's default.
 	memSamples int
+
+	// protoMaxBulkLen is the largest bulk string a client may send. Defaults
+	// to 512mb, matching Redis's default.
+	protoMaxBulkLen int64
+
+	// lfuDecayTime is how many minutes a key's LFU access counter takes to be
+	// halved. 0 disables decay. Defaults to 1, matching Redis's default.
+	lfuDecayTime int
+
+	// timeout is how many seconds a client may stay idle before its
+	// connection is closed. 0, the default, never closes idle clients.
+	timeout int
+
+	// tcpKeepalive is the interval in seconds of the TCP keepalive probes
+	// sent on client connections. 0 disables them. Defaults to 300, matching
+	// Redis's default.
+	tcpKeepalive int
+
+	// maxClients is the number of clients that may be connected at once;
+	// further connections are refused. Defaults to 10000, matching Redis's
+	// default.
+	maxClients int
+
+	// notifyEvents is the set of keyspace event classes published to pub/sub
+	// clients. Empty by default, which disables notifications.
+	notifyEvents notifyClass
+
+	// slowlogSlowerThan is the execution time in microseconds from which a
+	// command is recorded in the slow log. 0 records every command and a
+	// negative value disables the log. Defaults to 10000, matching Redis's
+	// default.
+	slowlogSlowerThan int64
+
+	// slowlogMaxLen is the number of entries kept in the slow log. Defaults
+	// to 128, matching Redis's default.
+	slowlogMaxLen int
+
+	// latencyMonitorThreshold is the duration in milliseconds from which
+	// pauses are recorded by the latency monitor. 0, the default, disables
+	// it.
+	latencyMonitorThreshold int64
 }
 
 // readConfig parses the Redis compatible config file at fpath and returns the
@@ -122,7 +228,31 @@ type Config struct {
 // and a message is printed - this allows the server to run without a provided
 // config.
 func readConfig(fpath string) *Config {
-	conf := &Config{memSamples: 5}
+	conf := &Config{
+		configFP:  fpath,
+		port:      6379,
+		quit:      make(chan struct{}),
+		rdbFn:     "dump.rdb",
+		rdbFormat: GobRDB,
+		aofFn:     "appendonly.aof",
+		aofFsync:  EverySec,
+
+		aofRewritePerc:    100,
+		aofRewriteMinSize: 64 * 1024 * 1024,
+
+		eviction:   NoEviction,
+		memSamples: 5,
+
+		databases:           16,
+		hz:                  10,
+		activeExpireSamples: 20,
+		lfuDecayTime:        1,
+		protoMaxBulkLen:     512 * 1024 * 1024,
+		tcpKeepalive:        300,
+		maxClients:          10000,
+		slowlogSlowerThan:   10000,
+		slowlogMaxLen:       128,
+	}
 
 	cf, err := os.Open(fpath)
 	if err != nil {
@@ -161,6 +291,17 @@ func parseLines(line string, conf *Config) {
 	}
 	cmd := strings.ToLower(args[0])
 	switch cmd {
+	case "port":
+		if len(args) < 2 {
+			log.Println("port requires a value")
+			return
+		}
+		port, err := strconv.Atoi(args[1])
+		if err != nil || port < 0 || port > 65535 {
+			log.Printf("invalid port %q, defaulting to %d", args[1], conf.port)
+			return
+		}
+		conf.port = port
 	case "save":
 		if len(args) < 3 {
 			log.Printf("save requires 2 args, got %d: %s", len(args), line)
@@ -190,12 +331,30 @@ func parseLines(line string, conf *Config) {
 			return
 		}
 		conf.aofFn = args[1]
+	case "rdb-format":
+		if len(args) < 2 {
+			log.Println("rdb-format requires a value")
+			return
+		}
+		switch format := RDBFormat(strings.ToLower(args[1])); format {
+		case GobRDB, RedisRDB:
+			conf.rdbFormat = format
+		default:
+			log.Printf("invalid rdb-format %q, defaulting to gob", args[1])
+		}
 	case "appendfsync":
 		if len(args) < 2 {
 			log.Println("appendfsync requires a value")
 			return
 		}
-		conf.aofFsync = FSyncMode(args[1])
+		switch mode := FSyncMode(strings.ToLower(args[1])); mode {
+		case Always, EverySec, NoFSync:
+			conf.aofFsync = mode
+		case "no":
+			conf.aofFsync = NoFSync
+		default:
+			log.Printf("invalid appendfsync %q, defaulting to everysec", args[1])
+		}
 	case "dir":
 		if len(args) < 2 {
 			log.Println("dir requires a value")
@@ -208,13 +367,57 @@ func parseLines(line string, conf *Config) {
 			return
 		}
 		conf.aofEnabled = strings.ToLower(args[1]) == "yes"
+	case "auto-aof-rewrite-percentage":
+		if len(args) < 2 {
+			log.Println("auto-aof-rewrite-percentage requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid auto-aof-rewrite-percentage %q, defaulting to 100", args[1])
+			return
+		}
+		conf.aofRewritePerc = n
+	case "auto-aof-rewrite-min-size":
+		if len(args) < 2 {
+			log.Println("auto-aof-rewrite-min-size requires a value")
+			return
+		}
+		size, err := parseMem(args[1])
+		if err != nil {
+			log.Printf("cannot parse auto-aof-rewrite-min-size %q, defaulting to 64mb: %v", args[1], err)
+			return
+		}
+		conf.aofRewriteMinSize = size
 	case "requirepass":
 		if len(args) < 2 {
 			log.Println("requirepass requires a value")
 			return
 		}
-		conf.requirepass = true
 		conf.password = args[1]
+	case "replicaof", "slaveof":
+		if len(args) < 3 {
+			log.Printf("%s requires a host and a port", args[0])
+			return
+		}
+		port, err := strconv.Atoi(args[2])
+		if err != nil || port < 0 || port > 65535 {
+			log.Printf("invalid master port %q, starting as a master", args[2])
+			return
+		}
+		conf.masterHost, conf.masterPort = args[1], port
+	case "masteruser":
+		if len(args) < 2 {
+			log.Println("masteruser requires a value")
+			return
+		}
+		conf.masterUser = args[1]
+	case "masterauth":
+		if len(args) < 2 {
+			log.Println("masterauth requires a value")
+			return
+		}
+		conf.masterAuth = args[1]
 	case "maxmemory":
 		if len(args) < 2 {
 			log.Println("maxmemory requires a value")
@@ -231,23 +434,171 @@ func parseLines(line string, conf *Config) {
 			log.Println("maxmemory-policy requires a value")
 			return
 		}
-		conf.eviction = Eviction(args[1])
+		policy, err := parseEviction(args[1])
+		if err != nil {
+			log.Printf("%v, defaulting to noeviction", err)
+			return
+		}
+		conf.eviction = policy
 	case "maxmemory-samples":
 		if len(args) < 2 {
 			log.Println("maxmemory-samples requires a value")
 			return
 		}
 		n, err := strconv.Atoi(args[1])
-		if err != nil {
-			log.Printf("cannot parse maxmemory-samples %q, defaulting to 5: %v", args[1], err)
+		if err != nil || n < 1 {
+			log.Printf("invalid maxmemory-samples %q, defaulting to 5", args[1])
 			return
 		}
 		conf.memSamples = n
+	case "lfu-decay-time":
+		if len(args) < 2 {
+			log.Println("lfu-decay-time requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid lfu-decay-time %q, defaulting to 1", args[1])
+			return
+		}
+		conf.lfuDecayTime = n
+	case "proto-max-bulk-len":
+		if len(args) < 2 {
+			log.Println("proto-max-bulk-len requires a value")
+			return
+		}
+		size, err := parseMem(args[1])
+		if err != nil || size < 1024*1024 || size > math.MaxInt64 {
+			log.Printf("invalid proto-max-bulk-len %q, defaulting to 512mb", args[1])
+			return
+		}
+		conf.protoMaxBulkLen = int64(size)
+	case "databases":
+		if len(args) < 2 {
+			log.Println("databases requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			log.Printf("invalid databases %q, defaulting to 16", args[1])
+			return
+		}
+		conf.databases = n
+	case "hz":
+		if len(args) < 2 {
+			log.Println("hz requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > 500 {
+			log.Printf("invalid hz %q, must be in 1..500, defaulting to 10", args[1])
+			return
+		}
+		conf.hz = n
+	case "active-expire-samples":
+		if len(args) < 2 {
+			log.Println("active-expire-samples requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			log.Printf("invalid active-expire-samples %q, defaulting to 20", args[1])
+			return
+		}
+		conf.activeExpireSamples = n
+	case "timeout":
+		if len(args) < 2 {
+			log.Println("timeout requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid timeout %q, defaulting to 0", args[1])
+			return
+		}
+		conf.timeout = n
+	case "tcp-keepalive":
+		if len(args) < 2 {
+			log.Println("tcp-keepalive requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid tcp-keepalive %q, defaulting to 300", args[1])
+			return
+		}
+		conf.tcpKeepalive = n
+	case "notify-keyspace-events":
+		if len(args) < 2 {
+			log.Println("notify-keyspace-events requires a value")
+			return
+		}
+		classes, err := parseNotifyClasses(args[1])
+		if err != nil {
+			log.Printf("invalid notify-keyspace-events %q, defaulting to \"\": %v", args[1], err)
+			return
+		}
+		conf.notifyEvents = classes
+	case "maxclients":
+		if len(args) < 2 {
+			log.Println("maxclients requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			log.Printf("invalid maxclients %q, defaulting to 10000", args[1])
+			return
+		}
+		conf.maxClients = n
+	case "slowlog-log-slower-than":
+		if len(args) < 2 {
+			log.Println("slowlog-log-slower-than requires a value")
+			return
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			log.Printf("invalid slowlog-log-slower-than %q, defaulting to 10000", args[1])
+			return
+		}
+		conf.slowlogSlowerThan = n
+	case "slowlog-max-len":
+		if len(args) < 2 {
+			log.Println("slowlog-max-len requires a value")
+			return
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 {
+			log.Printf("invalid slowlog-max-len %q, defaulting to 128", args[1])
+			return
+		}
+		conf.slowlogMaxLen = n
+	case "latency-monitor-threshold":
+		if len(args) < 2 {
+			log.Println("latency-monitor-threshold requires a value")
+			return
+		}
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || n < 0 {
+			log.Printf("invalid latency-monitor-threshold %q, defaulting to 0", args[1])
+			return
+		}
+		conf.latencyMonitorThreshold = n
 	default:
 		log.Printf("unknown directive %q", cmd)
 	}
 }
 
+// parseEviction parses a maxmemory-policy value, case-insensitively.
+func parseEviction(str string) (Eviction, error) {
+	switch policy := Eviction(strings.ToLower(str)); policy {
+	case NoEviction, AllKeysRandom, AllKeysLRU, AllKeysLFU,
+		VolatileRandom, VolatileLRU, VolatileTTL, VolatileLFU:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid maxmemory-policy %q", str)
+	}
+}
+
 // parseMem parses a memory string with optional unit suffix into bytes.
 // Supports kb, mb, gb suffixes (case-insensitive); lack of suffix means
 // bytes. Ex: 100mb, 1gb, 32kb, 1024.
@@ -275,3 +626,441 @@ func parseMem(str string) (uint64, error) {
 	}
 	return mem * multiplier, nil
 }
+
+// configParam exposes a config field to CONFIG GET and, if set is non-nil,
+// CONFIG SET. get and set are called with Config.mu held.
+type configParam struct {
+	get func(conf *Config) string
+	set func(conf *Config, val string) error
+}
+
+// configParams is the registry of parameters visible to the CONFIG command,
+// keyed by their config file directive name.
+var configParams = map[string]configParam{
+	"port": {get: func(conf *Config) string { return strconv.Itoa(conf.port) }},
+	"dir":  {get: func(conf *Config) string { return conf.dir }},
+	"save": {get: func(conf *Config) string {
+		points := make([]string, 0, len(conf.rdb))
+		for _, rdb := range conf.rdb {
+			points = append(points, fmt.Sprintf("%d %d", rdb.Secs, rdb.KeysChanged))
+		}
+		return strings.Join(points, " ")
+	}},
+	"dbfilename":     {get: func(conf *Config) string { return conf.rdbFn }},
+	"appendfilename": {get: func(conf *Config) string { return conf.aofFn }},
+	"appendonly": {get: func(conf *Config) string {
+		if conf.aofEnabled {
+			return "yes"
+		}
+		return "no"
+	}},
+	"databases": {get: func(conf *Config) string { return strconv.Itoa(conf.databases) }},
+	"hz":        {get: func(conf *Config) string { return strconv.Itoa(conf.hz) }},
+	"auto-aof-rewrite-percentage": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.aofRewritePerc) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.aofRewritePerc = n
+			return nil
+		},
+	},
+	"auto-aof-rewrite-min-size": {
+		get: func(conf *Config) string { return strconv.FormatUint(conf.aofRewriteMinSize, 10) },
+		set: func(conf *Config, val string) error {
+			size, err := parseMem(val)
+			if err != nil {
+				return err
+			}
+			conf.aofRewriteMinSize = size
+			return nil
+		},
+	},
+	"rdb-format": {
+		get: func(conf *Config) string { return string(conf.rdbFormat) },
+		set: func(conf *Config, val string) error {
+			switch format := RDBFormat(strings.ToLower(val)); format {
+			case GobRDB, RedisRDB:
+				conf.rdbFormat = format
+			default:
+				return fmt.Errorf("argument must be one of gob or redis")
+			}
+			return nil
+		},
+	},
+	"appendfsync": {
+		get: func(conf *Config) string { return string(conf.aofFsync) },
+		set: func(conf *Config, val string) error {
+			switch mode := FSyncMode(strings.ToLower(val)); mode {
+			case Always, EverySec, NoFSync:
+				conf.aofFsync = mode
+			case "no":
+				conf.aofFsync = NoFSync
+			default:
+				return fmt.Errorf("argument must be one of always, everysec or no")
+			}
+			return nil
+		},
+	},
+	"requirepass": {
+		get: func(conf *Config) string { return conf.password },
+		set: func(conf *Config, val string) error {
+			conf.password = val
+			return nil
+		},
+	},
+	"masteruser": {
+		get: func(conf *Config) string { return conf.masterUser },
+		set: func(conf *Config, val string) error {
+			conf.masterUser = val
+			return nil
+		},
+	},
+	"masterauth": {
+		get: func(conf *Config) string { return conf.masterAuth },
+		set: func(conf *Config, val string) error {
+			conf.masterAuth = val
+			return nil
+		},
+	},
+	"maxmemory": {
+		get: func(conf *Config) string { return strconv.FormatUint(conf.maxmem, 10) },
+		set: func(conf *Config, val string) error {
+			maxmem, err := parseMem(val)
+			if err != nil {
+				return err
+			}
+			conf.maxmem = maxmem
+			return nil
+		},
+	},
+	"maxmemory-policy": {
+		get: func(conf *Config) string { return string(conf.eviction) },
+		set: func(conf *Config, val string) error {
+			policy, err := parseEviction(val)
+			if err != nil {
+				return err
+			}
+			conf.eviction = policy
+			return nil
+		},
+	},
+	"maxmemory-samples": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.memSamples) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			conf.memSamples = n
+			return nil
+		},
+	},
+	"proto-max-bulk-len": {
+		get: func(conf *Config) string { return strconv.FormatInt(conf.protoMaxBulkLen, 10) },
+		set: func(conf *Config, val string) error {
+			size, err := parseMem(val)
+			if err != nil {
+				return err
+			}
+			if size < 1024*1024 || size > math.MaxInt64 {
+				return fmt.Errorf("argument must be between 1mb and %d", int64(math.MaxInt64))
+			}
+			conf.protoMaxBulkLen = int64(size)
+			return nil
+		},
+	},
+	"lfu-decay-time": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.lfuDecayTime) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.lfuDecayTime = n
+			return nil
+		},
+	},
+	"timeout": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.timeout) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.timeout = n
+			return nil
+		},
+	},
+	"tcp-keepalive": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.tcpKeepalive) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.tcpKeepalive = n
+			return nil
+		},
+	},
+	"maxclients": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.maxClients) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fmt.Errorf("argument must be a positive integer")
+			}
+			conf.maxClients = n
+			return nil
+		},
+	},
+	"notify-keyspace-events": {
+		get: func(conf *Config) string { return conf.notifyEvents.String() },
+		set: func(conf *Config, val string) error {
+			classes, err := parseNotifyClasses(val)
+			if err != nil {
+				return err
+			}
+			conf.notifyEvents = classes
+			return nil
+		},
+	},
+	"slowlog-log-slower-than": {
+		get: func(conf *Config) string { return strconv.FormatInt(conf.slowlogSlowerThan, 10) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return fmt.Errorf("argument must be an integer")
+			}
+			conf.slowlogSlowerThan = n
+			return nil
+		},
+	},
+	"slowlog-max-len": {
+		get: func(conf *Config) string { return strconv.Itoa(conf.slowlogMaxLen) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.slowlogMaxLen = n
+			return nil
+		},
+	},
+	"latency-monitor-threshold": {
+		get: func(conf *Config) string { return strconv.FormatInt(conf.latencyMonitorThreshold, 10) },
+		set: func(conf *Config, val string) error {
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("argument must be a non-negative integer")
+			}
+			conf.latencyMonitorThreshold = n
+			return nil
+		},
+	},
+}
+
+// getParams returns the name-value pairs of every parameter matching the glob
+// pattern, sorted by name.
+func (conf *Config) getParams(pattern string) [][2]string {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	pairs := make([][2]string, 0)
+	for name, param := range configParams {
+		if globMatch(strings.ToLower(pattern), name) {
+			pairs = append(pairs, [2]string{name, param.get(conf)})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b [2]string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	return pairs
+}
+
+// setParam sets the runtime-tunable parameter name to val.
+func (conf *Config) setParam(name, val string) error {
+	param, ok := configParams[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", name)
+	}
+	if param.set == nil {
+		return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name)
+	}
+	conf.mu.Lock()
+	defer conf.mu.Unlock()
+
+	if err := param.set(conf, val); err != nil {
+		return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", name, err)
+	}
+	return nil
+}
+
+// lfuDecayPeriod returns how long it takes for an LFU access counter to be
+// halved, or 0 if counters don't decay.
+func (conf *Config) lfuDecayPeriod() time.Duration {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return time.Duration(conf.lfuDecayTime) * time.Minute
+}
+
+// protoLimits returns the request limits clients are held to.
+func (conf *Config) protoLimits() protoLimits {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return protoLimits{maxBulkLen: conf.protoMaxBulkLen}
+}
+
+// idleTimeout returns how long a client may stay idle before being
+// disconnected, or 0 if idle clients are kept.
+func (conf *Config) idleTimeout() time.Duration {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return time.Duration(conf.timeout) * time.Second
+}
+
+// keepalivePeriod returns the interval of TCP keepalive probes on client
+// connections, or 0 if they are disabled.
+func (conf *Config) keepalivePeriod() time.Duration {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return time.Duration(conf.tcpKeepalive) * time.Second
+}
+
+// maxClientsLimit returns the number of clients that may be connected at
+// once.
+func (conf *Config) maxClientsLimit() int {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return conf.maxClients
+}
+
+// keyspaceEvents returns the keyspace event classes published to clients.
+func (conf *Config) keyspaceEvents() notifyClass {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return conf.notifyEvents
+}
+
+// slowlogLimits returns the execution time from which commands are recorded
+// in the slow log, negative if it is disabled, and the number of entries it
+// keeps.
+func (conf *Config) slowlogLimits() (time.Duration, int) {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	if conf.slowlogSlowerThan < 0 {
+		return -1, conf.slowlogMaxLen
+	}
+	return time.Duration(min(conf.slowlogSlowerThan, math.MaxInt64/int64(time.Microsecond))) * time.Microsecond,
+		conf.slowlogMaxLen
+}
+
+// latencyThreshold returns the duration from which pauses are recorded by the
+// latency monitor, or 0 if it is disabled.
+func (conf *Config) latencyThreshold() time.Duration {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return time.Duration(min(conf.latencyMonitorThreshold, math.MaxInt64/int64(time.Millisecond))) * time.Millisecond
+}
+
+// rdbFileFormat returns the format RDB snapshots are saved in.
+func (conf *Config) rdbFileFormat() RDBFormat {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return conf.rdbFormat
+}
+
+// masterCredentials returns the user and password a replica authenticates to
+// its master with; an empty password means none.
+func (conf *Config) masterCredentials() (user, pass string) {
+	conf.mu.RLock()
+	defer conf.mu.RUnlock()
+
+	return conf.masterUser, conf.masterAuth
+}
+
+// shutdown closes quit, starting a graceful shutdown. It may be called more
+// than once.
+func (conf *Config) shutdown() {
+	conf.quitOnce.Do(func() { close(conf.quit) })
+}
+
+func init() {
+	register(
+		&Command{name: "config", handler: configCmd, arity: -2, help: configHelp},
+	)
+}
+
+// configHelp is the reply to CONFIG HELP.
+var configHelp = []string{
+	"GET <pattern>",
+	"    Return parameters matching the glob-like <pattern> and their values.",
+	"SET <directive> <value>",
+	"    Set the configuration <directive> to <value>.",
+	"RESETSTAT",
+	"    Reset statistics reported by the INFO command.",
+}
+
+// configCmd implements CONFIG GET pattern [pattern ...],
+// CONFIG SET parameter value [parameter value ...] and CONFIG RESETSTAT.
+func configCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	args := v.Array[2:]
+
+	switch strings.ToUpper(v.Array[1].Bulk) {
+	case "GET":
+		if len(args) == 0 {
+			return newError("ERR wrong number of arguments for 'config|get' command")
+		}
+		seen := make(map[string]bool)
+		vals := make([]Value, 0)
+		for _, arg := range args {
+			for _, pair := range rg.conf.getParams(arg.Bulk) {
+				if seen[pair[0]] {
+					continue
+				}
+				seen[pair[0]] = true
+				vals = append(vals, Value{Type: Bulk, Bulk: pair[0]}, Value{Type: Bulk, Bulk: pair[1]})
+			}
+		}
+		return newMap(vals)
+	case "SET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return newError("ERR wrong number of arguments for 'config|set' command")
+		}
+		for i := 0; i < len(args); i += 2 {
+			if err := rg.conf.setParam(args[i].Bulk, args[i+1].Bulk); err != nil {
+				return newError("ERR %v", err)
+			}
+			// requirepass is the password of the default ACL user.
+			if strings.EqualFold(args[i].Bulk, "requirepass") {
+				rg.acl.setRequirePass(args[i+1].Bulk)
+			}
+		}
+		// A lowered maxmemory takes effect right away rather than on the
+		// next write. Failing to get under it is not an error for CONFIG.
+		rg.freeMemory(0)
+		return newOK()
+	case "RESETSTAT":
+		if len(args) != 0 {
+			return newError("ERR wrong number of arguments for 'config|resetstat' command")
+		}
+		rg.genStats.reset()
+		for _, stats := range rg.cmdStats {
+			stats.reset()
+		}
+		return newOK()
+	default:
+		return unknownSubcommand("config", v.Array[1].Bulk)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestParseMaxmemorySamples(t *testing.T) {
+	tests := []struct {
+		val  string
+		want int
+	}{
+		{"10", 10},
+		{"1", 1},
+		{"0", 5},
+		{"-3", 5},
+		{"x", 5},
+	}
+	for _, tt := range tests {
+		conf := &Config{memSamples: 5}
+		parseLines("maxmemory-samples "+tt.val, conf)
+		if conf.memSamples != tt.want {
+			t.Errorf("maxmemory-samples %s: got %d, want %d", tt.val, conf.memSamples, tt.want)
+		}
+	}
+}
+
+func TestParseMaxmemoryPolicy(t *testing.T) {
+	tests := []struct {
+		val  string
+		want Eviction
+	}{
+		{"allkeys-lru", AllKeysLRU},
+		{"Volatile-TTL", VolatileTTL},
+		{"noeviction", NoEviction},
+		{"allkeys-fifo", AllKeysRandom},
+		{"", AllKeysRandom},
+	}
+	for _, tt := range tests {
+		conf := &Config{eviction: AllKeysRandom}
+		parseLines("maxmemory-policy "+tt.val, conf)
+		if conf.eviction != tt.want {
+			t.Errorf("maxmemory-policy %q: got %q, want %q", tt.val, conf.eviction, tt.want)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "ping", handler: ping, arity: -1, fast: true},
+		&Command{name: "echo", handler: echo, arity: 2, fast: true},
+		&Command{name: "auth", handler: auth, arity: -2, noAuth: true, fast: true},
+		&Command{name: "quit", handler: quit, arity: -1, noAuth: true},
+		&Command{name: "hello", handler: hello, arity: -1, noAuth: true, fast: true},
+		&Command{name: "client", handler: client, arity: -2, help: clientHelp},
+	)
+}
+
+// clientHelp is the reply to CLIENT HELP.
+var clientHelp = []string{
+	"GETNAME",
+	"    Return the name of the current connection.",
+	"ID",
+	"    Return the ID of the current connection.",
+	"INFO",
+	"    Return information about the current client connection.",
+	"KILL <ip:port>",
+	"    Kill connection made from <ip:port>.",
+	"KILL <option> <value> [<option> <value> [...]]",
+	"    Kill connections. Options are:",
+	"    * ADDR <ip:port>",
+	"      Kill connections made from the specified address",
+	"    * LADDR <ip:port>",
+	"      Kill connections made to specified local address",
+	"    * ID <client-id>",
+	"      Kill connections by client id.",
+	"    * SKIPME (YES|NO)",
+	"      Skip killing current connection (default: yes).",
+	"LIST [ID <id> [<id> ...]]",
+	"    Return information about client connections.",
+	"NO-EVICT (ON|OFF)",
+	"    Protect current client connection from eviction. Accepted, without effect.",
+	"NO-TOUCH (ON|OFF)",
+	"    Will not touch LRU/LFU stats when this mode is on. Accepted, without effect.",
+	"SETNAME <name>",
+	"    Assign the name <name> to the current connection.",
+}
+
+// ping implements PING [message], replying PONG or echoing message.
+func ping(c *Client, v *Value, rg *RedisGo) *Value {
+	if c.subscriptions() > 0 && c.writer.proto == 2 && len(v.Array) <= 2 {
+		return subscribedPing(v)
+	}
+	switch len(v.Array) {
+	case 1:
+		return newString("PONG")
+	case 2:
+		return newBulk(v.Array[1].Bulk)
+	default:
+		return newError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+// echo implements ECHO message.
+func echo(c *Client, v *Value, rg *RedisGo) *Value {
+	return newBulk(v.Array[1].Bulk)
+}
+
+// auth implements AUTH [username] password, authenticating the client as the
+// given ACL user, the default user if omitted.
+func auth(c *Client, v *Value, rg *RedisGo) *Value {
+	if len(v.Array) > 3 {
+		return newError(errSyntax)
+	}
+	if len(v.Array) == 2 && rg.acl.defaultNoPass() {
+		return newError("ERR AUTH <password> called without any password configured for " +
+			"the default user. Are you sure your configuration is correct?")
+	}
+	name, pass := "default", v.Array[1].Bulk
+	if len(v.Array) == 3 {
+		name, pass = v.Array[1].Bulk, v.Array[2].Bulk
+	}
+	user := rg.acl.authenticate(name, pass)
+	if user == nil {
+		return newError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	rg.setClientUser(c, user)
+	return newOK()
+}
+
+// hello implements HELLO [protover [AUTH username password] [SETNAME name]], switching the
+// connection to the requested RESP version and replying with a map
+// describing the server. The reply is already written in the new protocol.
+func hello(c *Client, v *Value, rg *RedisGo) *Value {
+	proto := c.writer.proto
+	args := v.Array[1:]
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0].Bulk)
+		if err != nil {
+			return newError("ERR Protocol version is not an integer or out of range")
+		}
+		if n != 2 && n != 3 {
+			return newError("NOPROTO unsupported protocol version")
+		}
+		proto, args = n, args[1:]
+	}
+	var user *aclUser
+	var name *string
+	for len(args) > 0 {
+		switch {
+		case strings.EqualFold(args[0].Bulk, "AUTH") && len(args) >= 3:
+			if user = rg.acl.authenticate(args[1].Bulk, args[2].Bulk); user == nil {
+				return newError("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+			args = args[3:]
+		case strings.EqualFold(args[0].Bulk, "SETNAME") && len(args) >= 2:
+			if !validClientName(args[1].Bulk) {
+				return newError(errClientName)
+			}
+			name, args = &args[1].Bulk, args[2:]
+		default:
+			return newError("ERR Syntax error in HELLO option '%s'", args[0].Bulk)
+		}
+	}
+	if !c.authenticated && user == nil && rg.acl.authRequired() {
+		return newError("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate " +
+			"the client and select the RESP protocol version at the same time")
+	}
+	if user != nil {
+		rg.setClientUser(c, user)
+	}
+	if name != nil {
+		rg.setClientName(c, *name)
+	}
+	// Push messages are written from other goroutines under writeMu, so the
+	// protocol changes under it too.
+	c.writeMu.Lock()
+	c.writer.proto = proto
+	c.writeMu.Unlock()
+
+	role := "master"
+	if rg.master.Load() != nil {
+		role = "replica"
+	}
+	return newMap([]Value{
+		{Type: Bulk, Bulk: "server"}, {Type: Bulk, Bulk: "redis"},
+		{Type: Bulk, Bulk: "version"}, {Type: Bulk, Bulk: redisVersion},
+		{Type: Bulk, Bulk: "proto"}, {Type: Integer, Int: int64(proto)},
+		{Type: Bulk, Bulk: "id"}, {Type: Integer, Int: c.id},
+		{Type: Bulk, Bulk: "mode"}, {Type: Bulk, Bulk: "standalone"},
+		{Type: Bulk, Bulk: "role"}, {Type: Bulk, Bulk: role},
+		{Type: Bulk, Bulk: "modules"}, {Type: Array, Array: []Value{}},
+	})
+}
+
+// quit implements QUIT, closing the connection after replying OK.
+func quit(c *Client, v *Value, rg *RedisGo) *Value {
+	c.closeAfterReply = true
+	return newOK()
+}
+
+// errClientName is the error replied to a connection name that doesn't pass
+// validClientName.
+const errClientName = "ERR Client names cannot contain spaces, newlines or special characters."
+
+// validClientName reports whether name may be used as a connection name: it
+// must be printable ASCII without spaces.
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// setClientName sets the connection name of c; an empty name clears it.
+func (rg *RedisGo) setClientName(c *Client, name string) {
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	c.name = name
+}
+
+// setClientUser authenticates c as user.
+func (rg *RedisGo) setClientUser(c *Client, user *aclUser) {
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	c.user, c.authenticated = user, true
+}
+
+// client implements the CLIENT subcommands ID, INFO, GETNAME, SETNAME, LIST,
+// KILL, NO-EVICT and NO-TOUCH. NO-EVICT and NO-TOUCH are accepted but have no
+// effect.
+func client(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[2:])
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "ID" && len(args) == 0:
+		return newInteger(c.id)
+	case sub == "INFO" && len(args) == 0:
+		rg.clientsMu.Lock()
+		defer rg.clientsMu.Unlock()
+		return newBulk(c.info() + "\n")
+	case sub == "GETNAME" && len(args) == 0:
+		rg.clientsMu.Lock()
+		defer rg.clientsMu.Unlock()
+		if c.name == "" {
+			return newNull()
+		}
+		return newBulk(c.name)
+	case sub == "SETNAME" && len(args) == 1:
+		if !validClientName(args[0]) {
+			return newError(errClientName)
+		}
+		rg.setClientName(c, args[0])
+		return newOK()
+	case sub == "LIST":
+		return rg.clientList(args)
+	case sub == "KILL" && len(args) > 0:
+		return rg.clientKill(c, args)
+	case (sub == "NO-EVICT" || sub == "NO-TOUCH") && len(args) == 1:
+		if mode := strings.ToUpper(args[0]); mode != "ON" && mode != "OFF" {
+			return newError(errSyntax)
+		}
+		return newOK()
+	default:
+		return unknownSubcommand("client", v.Array[1].Bulk)
+	}
+}
+
+// info returns the line describing c in CLIENT LIST and CLIENT INFO. The
+// caller must hold the server's clientsMu.
+func (c *Client) info() string {
+	now := time.Now()
+	idle := now.Sub(time.Unix(0, c.lastActive.Load()))
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d idle=%d db=%d user=%s",
+		c.id, c.addr(), c.conn.LocalAddr(), c.name,
+		int64(now.Sub(c.createdAt)/time.Second), int64(idle/time.Second), c.dbIndex, c.user.name)
+}
+
+// clientList implements CLIENT LIST [ID id [id ...]], describing every
+// connected client, or those with the given ids, one per line.
+func (rg *RedisGo) clientList(args []string) *Value {
+	var ids map[int64]bool
+	if len(args) > 0 {
+		if !strings.EqualFold(args[0], "ID") || len(args) < 2 {
+			return newError(errSyntax)
+		}
+		ids = make(map[int64]bool, len(args)-1)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || id <= 0 {
+				return newError("ERR Invalid client ID")
+			}
+			ids[id] = true
+		}
+	}
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	clients := make([]*Client, 0, len(rg.clients))
+	for _, cl := range rg.clients {
+		if ids == nil || ids[cl.id] {
+			clients = append(clients, cl)
+		}
+	}
+	slices.SortFunc(clients, func(a, b *Client) int { return cmp.Compare(a.id, b.id) })
+
+	var sb strings.Builder
+	for _, cl := range clients {
+		sb.WriteString(cl.info())
+		sb.WriteByte('\n')
+	}
+	return newBulk(sb.String())
+}
+
+// clientKill implements CLIENT KILL addr, replying OK, and CLIENT KILL
+// [ID id] [ADDR addr] [LADDR addr] [SKIPME yes|no], replying with the number
+// of clients killed. A client killing itself is disconnected after the reply.
+func (rg *RedisGo) clientKill(c *Client, args []string) *Value {
+	var (
+		id          int64
+		addr, laddr string
+		skipMe      = true
+	)
+	legacy := len(args) == 1
+	if legacy {
+		addr, skipMe = args[0], false
+	} else {
+		if len(args)%2 != 0 {
+			return newError(errSyntax)
+		}
+		for i := 0; i < len(args); i += 2 {
+			val := args[i+1]
+			switch strings.ToUpper(args[i]) {
+			case "ID":
+				n, err := strconv.ParseInt(val, 10, 64)
+				if err != nil || n <= 0 {
+					return newError("ERR client-id should be greater than 0")
+				}
+				id = n
+			case "ADDR":
+				addr = val
+			case "LADDR":
+				laddr = val
+			case "SKIPME":
+				switch strings.ToLower(val) {
+				case "yes":
+					skipMe = true
+				case "no":
+					skipMe = false
+				default:
+					return newError(errSyntax)
+				}
+			default:
+				return newError(errSyntax)
+			}
+		}
+	}
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	killed := 0
+	for _, cl := range rg.clients {
+		if (id != 0 && cl.id != id) || (addr != "" && cl.addr() != addr) ||
+			(laddr != "" && cl.conn.LocalAddr().String() != laddr) || (skipMe && cl == c) {
+			continue
+		}
+		if cl == c {
+			c.closeAfterReply = true
+		} else {
+			_ = cl.conn.Close()
+		}
+		killed++
+	}
+	if legacy {
+		if killed == 0 {
+			return newError("ERR No such client")
+		}
+		return newOK()
+	}
+	return newInteger(int64(killed))
+}
@@ -2,24 +2,182 @@ package main
 
 import (
 	"log"
+	"math/rand"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// numShards is the number of shards the keys of a database are spread
+// across. Every shard has its own lock, so that commands on keys of different
+// shards run in parallel.
+const (
+	shardBits = 8
+	numShards = 1 << shardBits
+)
+
 // RedisDb represents a Redis database, an in-memory key-value store; instance
 // must not be copied after first use because sync.Mutex must not be copied.
 // Methods on RedisDb are thread-safe for now.
+//
+// The keys are spread across shards by scanHash, whose top bits select the
+// shard so that SCAN can walk the shards in cursor order. Commands lock the
+// shards of the keys they access with lockKeys or rlockKeys, which also take
+// rwm for reading; operations on the whole database take rwm for writing
+// instead, which excludes every other user of the shards.
+//
+// Writes only run in parallel while nothing consumes the replication stream.
+// With the AOF enabled or a replica attached, execWrite holds repl.mu across
+// every write command so that the stream follows the order they were applied
+// in, which serializes them whatever shards they lock; reads still run in
+// parallel.
 type RedisDb struct {
-	store   map[string]*Item
+	id      int // id is the index of the database as used by SELECT
+	shards  [numShards]dbShard
 	rwm     sync.RWMutex
 	memUsed atomic.Uint64 // memUsed is approximate memory usage of the database in bytes across
+
+	// keyCount and expireCount count the keys of all shards, and those with
+	// an expiry set, so that they can be read without visiting every shard.
+	keyCount    atomic.Int64
+	expireCount atomic.Int64
+
+	// onExpire, if set, is called with the key's shard locked whenever a key
+	// is found to be expired and deleted.
+	onExpire func(key string)
+
+	// onEvent, if set, is called with the key's shard locked for every
+	// keyspace event, as reported through notify.
+	onEvent func(class notifyClass, event, key string)
+
+	// watches holds the keys watched by clients with WATCH, guarded by
+	// watchMu. When both are needed the shard locks are taken first. watched
+	// counts the keys in watches so that writes skip watchMu when there are
+	// none.
+	watches map[string]*keyWatch
+	watched atomic.Int64
+	watchMu sync.Mutex
+
+	// blocked holds the clients blocked in BLPOP, BRPOP or XREAD on each
+	// key, in the order they blocked, guarded by blockedMu. When both are
+	// needed the shard locks are taken first.
+	blocked   map[string][]*blockedClient
+	blockedMu sync.Mutex
+}
+
+// dbShard holds the keys of a database whose hash falls in its range.
+type dbShard struct {
+	mu      sync.RWMutex
+	store   map[string]*Item
+	expires map[string]struct{} // expires holds the keys of store with an expiry set
 }
 
-// NewRedisDb returns an initialized empty database.
-func NewRedisDb() *RedisDb {
-	return &RedisDb{
-		store: make(map[string]*Item),
+// keyWatch tracks a key watched by clients.
+type keyWatch struct {
+	version  uint64 // version is bumped on every modification of the key
+	watchers int    // watchers counts the clients watching the key
+}
+
+// NewRedisDb returns an initialized empty database with index id.
+func NewRedisDb(id int) *RedisDb {
+	rdb := &RedisDb{
+		id:      id,
+		watches: make(map[string]*keyWatch),
+		blocked: make(map[string][]*blockedClient),
+	}
+	for i := range rdb.shards {
+		rdb.shards[i].store = make(map[string]*Item)
+		rdb.shards[i].expires = make(map[string]struct{})
+	}
+	return rdb
+}
+
+// shardIndex returns the index of the shard holding key, the top bits of its
+// scanHash.
+func shardIndex(key string) int {
+	return int(scanHash(key) >> (63 - shardBits))
+}
+
+// shard returns the shard holding key.
+func (rdb *RedisDb) shard(key string) *dbShard {
+	return &rdb.shards[shardIndex(key)]
+}
+
+// shardsOf returns the distinct indices of the shards holding keys, in
+// ascending order, which is the order they must be locked in so that
+// commands locking several shards never deadlock.
+func shardsOf(keys []string) []int {
+	idx := make([]int, 0, len(keys))
+	for _, key := range keys {
+		idx = append(idx, shardIndex(key))
+	}
+	slices.Sort(idx)
+	return slices.Compact(idx)
+}
+
+// lockKeys locks the shards holding keys for writing, and returns the func
+// releasing them. The caller may then read and modify those keys, and only
+// those. lockKeys is thread-safe.
+func (rdb *RedisDb) lockKeys(keys ...string) func() {
+	rdb.rwm.RLock()
+	if len(keys) == 1 {
+		s := rdb.shard(keys[0])
+		s.mu.Lock()
+		return func() {
+			s.mu.Unlock()
+			rdb.rwm.RUnlock()
+		}
+	}
+	idx := shardsOf(keys)
+	for _, i := range idx {
+		rdb.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range slices.Backward(idx) {
+			rdb.shards[i].mu.Unlock()
+		}
+		rdb.rwm.RUnlock()
+	}
+}
+
+// rlockKeys is the read-only counterpart of lockKeys, locking the shards
+// holding keys for reading. rlockKeys is thread-safe.
+func (rdb *RedisDb) rlockKeys(keys ...string) func() {
+	rdb.rwm.RLock()
+	if len(keys) == 1 {
+		s := rdb.shard(keys[0])
+		s.mu.RLock()
+		return func() {
+			s.mu.RUnlock()
+			rdb.rwm.RUnlock()
+		}
+	}
+	idx := shardsOf(keys)
+	for _, i := range idx {
+		rdb.shards[i].mu.RLock()
+	}
+	return func() {
+		for _, i := range slices.Backward(idx) {
+			rdb.shards[i].mu.RUnlock()
+		}
+		rdb.rwm.RUnlock()
+	}
+}
+
+// rlockAll locks every shard for reading, giving a consistent view of the
+// whole database, and returns the func releasing them. rlockAll is
+// thread-safe.
+func (rdb *RedisDb) rlockAll() func() {
+	rdb.rwm.RLock()
+	for i := range rdb.shards {
+		rdb.shards[i].mu.RLock()
+	}
+	return func() {
+		for i := range rdb.shards {
+			rdb.shards[i].mu.RUnlock()
+		}
+		rdb.rwm.RUnlock()
 	}
 }
 
@@ -33,91 +191,633 @@ func (rdb *RedisDb) MemUsed() uint64 {
 // the database, its memory usage is subtracted before overwriting. Set is
 // thread-safe.
 func (rdb *RedisDb) Set(key, val string) {
-	rdb.rwm.Lock()
-	defer rdb.rwm.Unlock()
+	unlock := rdb.lockKeys(key)
+	defer unlock()
 
-	if old, ok := rdb.store[key]; ok {
-		used := old.approxMemUsage(key)
-		curr := rdb.memUsed.Load()
-		if curr >= used {
-			rdb.memUsed.Store(curr - used)
+	rdb.put(key, &Item{Value: val})
+	rdb.notify(notifyString, "set", key)
+	log.Printf("set key=%q, memory usage=%d bytes", key, rdb.memUsed.Load())
+}
+
+// MSet stores every key-value pair of kvs, laid out as key1, val1, key2, val2
+// and so on, with all their shards locked so no reader observes a partial
+// update. MSet is thread-safe.
+func (rdb *RedisDb) MSet(kvs []string) {
+	unlock := rdb.lockKeys(pairKeys(kvs)...)
+	defer unlock()
+
+	for i := 0; i+1 < len(kvs); i += 2 {
+		rdb.put(kvs[i], &Item{Value: kvs[i+1]})
+		rdb.notify(notifyString, "set", kvs[i])
+	}
+}
+
+// MSetNX behaves like MSet but only stores the pairs if none of the keys
+// exist, reporting whether they were stored. MSetNX is thread-safe.
+func (rdb *RedisDb) MSetNX(kvs []string) bool {
+	unlock := rdb.lockKeys(pairKeys(kvs)...)
+	defer unlock()
+
+	for i := 0; i < len(kvs); i += 2 {
+		if rdb.lookup(kvs[i]) != nil {
+			return false
 		}
 	}
-	item := &Item{Value: val}
-	imem := item.approxMemUsage(key)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		rdb.put(kvs[i], &Item{Value: kvs[i+1]})
+		rdb.notify(notifyString, "set", kvs[i])
+	}
+	return true
+}
 
-	rdb.memUsed.Add(imem)
-	rdb.store[key] = item
-	log.Printf("set key=%q, memory usage=%d bytes", key, rdb.memUsed.Load())
+// pairKeys returns the keys of kvs, laid out as for MSet.
+func pairKeys(kvs []string) []string {
+	keys := make([]string, 0, (len(kvs)+1)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		keys = append(keys, kvs[i])
+	}
+	return keys
+}
+
+// MGet returns the items stored at keys in order, with nil for keys that are
+// missing or expired. Like Get it records an access on every item found. MGet
+// is thread-safe.
+func (rdb *RedisDb) MGet(keys []string) []*Item {
+	unlock := rdb.rlockKeys(keys...)
+	defer unlock()
+
+	items := make([]*Item, len(keys))
+	for i, key := range keys {
+		if item := rdb.peek(key); item != nil {
+			item.touch()
+			items[i] = item
+		}
+	}
+	return items
 }
 
 // Get returns the (val, true) for the given key, or (nil, false) if the key
-// does not exist. Get updates LastAccessed and AccessCount on the Item for
-// LRU/LFU tracking. Get is thread-safe.
+// does not exist or has expired, in which case it is deleted. Get updates
+// LastAccessed and AccessCount on the Item for LRU/LFU tracking. Get is
+// thread-safe, and concurrent Gets only share the read lock since the access
+// counters are updated atomically.
 func (rdb *RedisDb) Get(key string) (*Item, bool) {
-	rdb.rwm.Lock()
-	defer rdb.rwm.Unlock()
+	unlock := rdb.rlockKeys(key)
+	item, ok := rdb.shard(key).store[key]
+	if ok && !item.hasExpired() {
+		item.touch()
+		unlock()
+		return item, true
+	}
+	unlock()
 
-	item, ok := rdb.store[key]
-	if !ok {
-		return nil, false
+	if ok {
+		// The item has expired, retake the write lock to delete it unless it
+		// was replaced in the meantime.
+		unlock = rdb.lockKeys(key)
+		rdb.lookup(key)
+		unlock()
 	}
-	item.AccessCount++
-	item.LastUsedAt = time.Now()
+	return nil, false
+}
 
-	log.Printf("key=%q accessed %d times, last used at=%v",
-		key, item.AccessCount, item.LastUsedAt,
-	)
-	return item, true
+// peek returns the item stored at key, or nil if the key does not exist or has
+// expired. Unlike lookup it never deletes, so the caller only needs to hold
+// the key's shard for reading.
+func (rdb *RedisDb) peek(key string) *Item {
+	item, ok := rdb.shard(key).store[key]
+	if !ok || item.hasExpired() {
+		return nil
+	}
+	return item
+}
+
+// Exists reports whether key is present and not expired. Exists does not
+// count as an access for LRU/LFU tracking. Exists is thread-safe.
+func (rdb *RedisDb) Exists(key string) bool {
+	unlock := rdb.rlockKeys(key)
+	defer unlock()
+
+	return rdb.peek(key) != nil
+}
+
+// Keys returns the live keys matching the glob pattern. Keys holds only the
+// read locks while collecting the matching key names. Keys is thread-safe.
+func (rdb *RedisDb) Keys(pattern string) []string {
+	unlock := rdb.rlockAll()
+	defer unlock()
+
+	keys := make([]string, 0)
+	for i := range rdb.shards {
+		for key, item := range rdb.shards[i].store {
+			if !item.hasExpired() && globMatch(pattern, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
 }
 
 // Delete removes the key from the underlying store and updates the memory
-// usage, returns early if key not exists. Delete is thread-safe.
-func (rdb *RedisDb) Delete(key string) {
-	rdb.rwm.Lock()
-	defer rdb.rwm.Unlock()
+// usage. It reports whether a live key was removed; missing and expired keys
+// report false. Delete is thread-safe.
+func (rdb *RedisDb) Delete(key string) bool {
+	unlock := rdb.lockKeys(key)
+	defer unlock()
 
-	item, ok := rdb.store[key]
+	if rdb.lookup(key) == nil || !rdb.remove(key) {
+		return false
+	}
+	rdb.notify(notifyGeneric, "del", key)
+	log.Printf("delete on key=%q, memory usage=%d bytes", key, rdb.memUsed.Load())
+	return true
+}
+
+// lazyFreeThreshold is the number of elements above which Unlink frees a
+// value on another goroutine, like Redis's LAZYFREE_THRESHOLD.
+const lazyFreeThreshold = 64
+
+// Unlink removes key like Delete, except that a large collection is freed on
+// another goroutine instead of holding up the caller. The key itself is gone
+// once Unlink returns. Unlink is thread-safe.
+func (rdb *RedisDb) Unlink(key string) bool {
+	unlock := rdb.lockKeys(key)
+	defer unlock()
+
+	item := rdb.lookup(key)
+	if item == nil || !rdb.remove(key) {
+		return false
+	}
+	rdb.notify(notifyGeneric, "del", key)
+	if item.elements() > lazyFreeThreshold {
+		go item.free()
+	}
+	return true
+}
+
+// Persist removes the expiry of key, reporting whether the key existed and had
+// an expiry to remove. Persist is thread-safe.
+func (rdb *RedisDb) Persist(key string) bool {
+	unlock := rdb.lockKeys(key)
+	defer unlock()
+
+	item := rdb.lookup(key)
+	if item == nil || !item.hasExpiry() {
+		return false
+	}
+	rdb.setExpiry(key, item, time.Unix(unixTSEpoch, 0))
+	rdb.notify(notifyGeneric, "persist", key)
+	return true
+}
+
+// lookup returns the item stored at key, or nil if the key does not exist.
+// An expired item is deleted and reported as missing. The caller must hold
+// the key's shard for writing.
+func (rdb *RedisDb) lookup(key string) *Item {
+	item, ok := rdb.shard(key).store[key]
 	if !ok {
+		return nil
+	}
+	if item.hasExpired() {
+		rdb.expire(key)
+		return nil
+	}
+	return item
+}
+
+// getTyped returns the item stored at key for a write command, or a
+// WRONGTYPE error reply if it holds another kind of value. A missing or
+// expired key yields a nil item and no error, an expired one being deleted.
+// Finding the item counts as an access for LRU/LFU tracking. The caller must
+// hold the key's shard for writing.
+func (rdb *RedisDb) getTyped(key string, kind ItemKind) (*Item, *Value) {
+	return typed(rdb.lookup(key), kind)
+}
+
+// peekTyped is the read-only counterpart of getTyped, leaving an expired key
+// in place. The caller must hold the key's shard.
+func (rdb *RedisDb) peekTyped(key string, kind ItemKind) (*Item, *Value) {
+	return typed(rdb.peek(key), kind)
+}
+
+// typed returns item, counting the access, if it is of the given kind.
+func typed(item *Item, kind ItemKind) (*Item, *Value) {
+	if item == nil {
+		return nil, nil
+	}
+	if item.Kind != kind {
+		return nil, newError(errWrongType)
+	}
+	item.touch()
+	return item, nil
+}
+
+// expire deletes the expired key and reports it through onExpire. The caller
+// must hold the key's shard for writing.
+func (rdb *RedisDb) expire(key string) {
+	if !rdb.remove(key) {
 		return
 	}
-	used := item.approxMemUsage(key)
-	curr := rdb.memUsed.Load()
-	if curr >= used {
-		rdb.memUsed.Store(curr - used)
+	if rdb.onExpire != nil {
+		rdb.onExpire(key)
+	}
+	rdb.notify(notifyExpired, "expired", key)
+}
+
+// put stores item at key, replacing any existing item, and updates the memory
+// usage accordingly. A new item without a recorded access counts as accessed
+// now, which also starts its LFU decay clock. A small integer value is
+// replaced by its shared copy. The caller must hold the key's shard for
+// writing.
+func (rdb *RedisDb) put(key string, item *Item) {
+	if item.LastAccessed == 0 {
+		item.LastAccessed = time.Now().UnixNano()
+	}
+	if item.DecayedAt == 0 {
+		item.DecayedAt = item.LastAccessed
+	}
+	item.shareValue()
+	s := rdb.shard(key)
+	if old, ok := s.store[key]; ok {
+		rdb.subMem(old.approxMemUsage(key))
+	} else {
+		rdb.keyCount.Add(1)
+		rdb.notify(notifyNew, "new", key)
+	}
+	rdb.memUsed.Add(item.approxMemUsage(key))
+	s.store[key] = item
+	rdb.touchWatched(key)
+	rdb.trackExpiry(s, key, item)
+}
+
+// setExpiry sets the expiry of the item stored at key to when; passing the
+// unixTSEpoch sentinel removes it. The caller must hold the key's shard for
+// writing.
+func (rdb *RedisDb) setExpiry(key string, item *Item, when time.Time) {
+	item.Expiration = when
+	rdb.trackExpiry(rdb.shard(key), key, item)
+}
+
+// trackExpiry records in the expires of s whether item, stored at key, has an
+// expiry set.
+func (rdb *RedisDb) trackExpiry(s *dbShard, key string, item *Item) {
+	_, had := s.expires[key]
+	switch has := item.hasExpiry(); {
+	case has && !had:
+		s.expires[key] = struct{}{}
+		rdb.expireCount.Add(1)
+	case !has && had:
+		delete(s.expires, key)
+		rdb.expireCount.Add(-1)
 	}
-	delete(rdb.store, key)
-	log.Printf("delete on key=%q, memory usage=%d bytes", key, rdb.memUsed.Load())
 }
 
-// sampleKeys returns a slice of sample key-value pairs for eviction candidate
-// selection. The returned slice is guaranteed to be at most as long as the
-// provided memSamples count. The sample returned is a random subset due to Go's
-// randomness in map iteration order.
-func (rdb *RedisDb) sampleKeys(count int) []sample {
+// remove deletes key from the store and updates the memory usage, reporting
+// whether the key existed. The caller must hold the key's shard for writing.
+func (rdb *RedisDb) remove(key string) bool {
+	s := rdb.shard(key)
+	item, ok := s.store[key]
+	if !ok {
+		return false
+	}
+	rdb.subMem(item.approxMemUsage(key))
+	delete(s.store, key)
+	rdb.keyCount.Add(-1)
+	if _, ok := s.expires[key]; ok {
+		delete(s.expires, key)
+		rdb.expireCount.Add(-1)
+	}
+	rdb.touchWatched(key)
+	return true
+}
+
+// subMem subtracts used bytes from the memory usage, clamping at zero since
+// the accounting is approximate.
+func (rdb *RedisDb) subMem(used uint64) {
+	for {
+		curr := rdb.memUsed.Load()
+		if rdb.memUsed.CompareAndSwap(curr, curr-min(curr, used)) {
+			return
+		}
+	}
+}
+
+// sampleKeys returns up to count distinct pseudo-random keys with their items
+// for eviction candidate selection; with volatile, only keys with an expiry
+// set are sampled. A database with no more than count candidates is returned
+// in full. sampleKeys is thread-safe.
+func (rdb *RedisDb) sampleKeys(count int, volatile bool) []sample {
 	rdb.rwm.RLock()
 	defer rdb.rwm.RUnlock()
 
-	samples := make([]sample, 0, count)
-	for k, v := range rdb.store {
-		samples = append(samples, sample{
-			key: k, val: v,
-		})
-		if len(samples) >= count {
-			break
+	n := int(rdb.keyCount.Load())
+	if volatile {
+		n = int(rdb.expireCount.Load())
+	}
+	samples := make([]sample, 0, min(count, n))
+	if n <= count {
+		for i := range rdb.shards {
+			s := &rdb.shards[i]
+			s.mu.RLock()
+			for k, v := range s.store {
+				if _, ok := s.expires[k]; ok || !volatile {
+					samples = append(samples, sample{key: k, val: v, expiration: v.Expiration})
+				}
+			}
+			s.mu.RUnlock()
+		}
+		return samples
+	}
+	// Picks may repeat, so bound the attempts rather than loop until count
+	// distinct keys turn up.
+	seen := make(map[string]struct{}, count)
+	for tries := 0; len(samples) < count && tries < 2*count; tries++ {
+		smp := rdb.randomKey(volatile)
+		if _, ok := seen[smp.key]; ok || smp.val == nil {
+			continue
 		}
+		seen[smp.key] = struct{}{}
+		samples = append(samples, smp)
 	}
 	return samples
 }
 
-// Snapshot returns a shallow copy of the underlying store.
-func (rdb *RedisDb) Snapshot() map[string]*Item {
+// randomKey returns a sample of a pseudo-random key, with a nil item if there
+// is none. It picks from a random shard and relies on Go starting every map
+// iteration at a random position, so it is cheap but not uniform. With
+// volatile only keys with an expiry set are considered. The caller must hold
+// rwm, but none of the shards.
+func (rdb *RedisDb) randomKey(volatile bool) sample {
+	for i := range randomShards {
+		s := &rdb.shards[i]
+		s.mu.RLock()
+		key, item := s.any(volatile)
+		var expiration time.Time
+		if item != nil {
+			expiration = item.Expiration
+		}
+		s.mu.RUnlock()
+		if item != nil {
+			return sample{key: key, val: item, expiration: expiration}
+		}
+	}
+	return sample{}
+}
+
+// randomShards yields as many shard indices picked at random as there are
+// shards, then every index in turn. A search for a random key thus picks
+// among the non-empty shards evenly, yet finds one if there is any.
+func randomShards(yield func(int) bool) {
+	for range numShards {
+		if !yield(rand.Intn(numShards)) {
+			return
+		}
+	}
+	for i := range numShards {
+		if !yield(i) {
+			return
+		}
+	}
+}
+
+// any returns an arbitrary key of s with its item, or a nil item if s is
+// empty. With volatile only keys with an expiry set are considered. The
+// caller must hold s.mu.
+func (s *dbShard) any(volatile bool) (string, *Item) {
+	if volatile {
+		for k := range s.expires {
+			return k, s.store[k]
+		}
+		return "", nil
+	}
+	for k, v := range s.store {
+		return k, v
+	}
+	return "", nil
+}
+
+// RandomKey returns a pseudo-random live key, or false if the database has
+// none. Like randomKey it picks from random shards and relies on map
+// iteration starting at a random position, so a single pass under the read
+// locks suffices; an expired key met on the way is deleted afterwards.
+// RandomKey is thread-safe.
+func (rdb *RedisDb) RandomKey() (string, bool) {
+	rdb.rwm.RLock()
+	var expired string
+	for i := range randomShards {
+		s := &rdb.shards[i]
+		s.mu.RLock()
+		for key, item := range s.store {
+			if !item.hasExpired() {
+				s.mu.RUnlock()
+				rdb.rwm.RUnlock()
+				return key, true
+			}
+			if expired == "" {
+				expired = key
+			}
+		}
+		s.mu.RUnlock()
+	}
+	rdb.rwm.RUnlock()
+
+	if expired != "" {
+		unlock := rdb.lockKeys(expired)
+		rdb.lookup(expired)
+		unlock()
+	}
+	return "", false
+}
+
+// evict deletes key to reclaim memory, reporting whether it still existed.
+// Unlike Delete it is meant for keys picked by sampleKeys, which may have
+// been removed by another client in the meantime. evict is thread-safe.
+func (rdb *RedisDb) evict(key string) bool {
+	unlock := rdb.lockKeys(key)
+	defer unlock()
+
+	if !rdb.remove(key) {
+		return false
+	}
+	rdb.notify(notifyEvicted, "evicted", key)
+	return true
+}
+
+// expireSample checks up to count keys with an expiry set, deleting those that
+// have expired. It returns the number of keys sampled and expired so callers
+// can decide whether another pass is worthwhile. The keys are taken from the
+// shards in turn, starting from a random one, locking one shard at a time.
+// expireSample is thread-safe.
+func (rdb *RedisDb) expireSample(count int) (sampled, expired int) {
 	rdb.rwm.RLock()
 	defer rdb.rwm.RUnlock()
 
-	copyDb := make(map[string]*Item, len(rdb.store))
-	for k, v := range rdb.store {
-		copyDb[k] = v
+	start := rand.Intn(numShards)
+	for i := 0; i < numShards && sampled < count; i++ {
+		s := &rdb.shards[(start+i)%numShards]
+		s.mu.Lock()
+		for key := range s.expires {
+			if sampled >= count {
+				break
+			}
+			sampled++
+			if item := s.store[key]; item != nil && item.hasExpired() {
+				rdb.expire(key)
+				expired++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return sampled, expired
+}
+
+// Size returns the number of keys in the database, including expired keys
+// that have not been reclaimed yet, like Redis's DBSIZE. Size is thread-safe.
+func (rdb *RedisDb) Size() int {
+	return int(rdb.keyCount.Load())
+}
+
+// Expires returns the number of keys in the database with an expiry set,
+// including expired keys that have not been reclaimed yet. Expires is
+// thread-safe.
+func (rdb *RedisDb) Expires() int {
+	return int(rdb.expireCount.Load())
+}
+
+// Flush removes every key from the database and resets its memory usage. With
+// async, the old maps are swapped out and dropped on another goroutine so the
+// caller isn't held up freeing a large keyspace. Flush is thread-safe.
+func (rdb *RedisDb) Flush(async bool) {
+	rdb.rwm.Lock()
+	defer rdb.rwm.Unlock()
+
+	rdb.touchWatchedIn(rdb)
+	old := make([]map[string]*Item, 0, numShards)
+	for i := range rdb.shards {
+		s := &rdb.shards[i]
+		old = append(old, s.store)
+		s.store = make(map[string]*Item)
+		s.expires = make(map[string]struct{})
+	}
+	rdb.keyCount.Store(0)
+	rdb.expireCount.Store(0)
+	rdb.memUsed.Store(0)
+
+	if async {
+		go func() {
+			for _, store := range old {
+				clear(store)
+			}
+		}()
+	}
+}
+
+// swap exchanges the whole contents of rdb and other, leaving their indices in
+// place. It only exchanges the maps of every shard and holds both write locks
+// so no reader observes a torn state. swap is thread-safe.
+func (rdb *RedisDb) swap(other *RedisDb) {
+	if rdb == other {
+		return
+	}
+	unlock := lockDbs(rdb, other)
+	defer unlock()
+
+	// A key of either database changed for the clients watching it in both.
+	for _, db := range []*RedisDb{rdb, other} {
+		db.touchWatchedIn(rdb)
+		db.touchWatchedIn(other)
+	}
+	for i := range rdb.shards {
+		a, b := &rdb.shards[i], &other.shards[i]
+		a.store, b.store = b.store, a.store
+		a.expires, b.expires = b.expires, a.expires
+	}
+	rdb.keyCount.Store(other.keyCount.Swap(rdb.keyCount.Load()))
+	rdb.expireCount.Store(other.expireCount.Swap(rdb.expireCount.Load()))
+	rdb.memUsed.Store(other.memUsed.Swap(rdb.memUsed.Load()))
+}
+
+// Snapshot returns a shallow copy of the underlying store.
+func (rdb *RedisDb) Snapshot() map[string]*Item {
+	unlock := rdb.rlockAll()
+	defer unlock()
+
+	copyDb := make(map[string]*Item, rdb.Size())
+	for i := range rdb.shards {
+		for k, v := range rdb.shards[i].store {
+			copyDb[k] = v
+		}
 	}
 	return copyDb
 }
+
+// watch registers a watcher of key, returning the key's current version to
+// compare against at EXEC. watch is thread-safe.
+func (rdb *RedisDb) watch(key string) uint64 {
+	rdb.watchMu.Lock()
+	defer rdb.watchMu.Unlock()
+
+	w, ok := rdb.watches[key]
+	if !ok {
+		w = &keyWatch{}
+		rdb.watches[key] = w
+		rdb.watched.Add(1)
+	}
+	w.watchers++
+	return w.version
+}
+
+// unwatch unregisters a watcher of key, forgetting the key once nobody
+// watches it. unwatch is thread-safe.
+func (rdb *RedisDb) unwatch(key string) {
+	rdb.watchMu.Lock()
+	defer rdb.watchMu.Unlock()
+
+	if w, ok := rdb.watches[key]; ok {
+		if w.watchers--; w.watchers == 0 {
+			delete(rdb.watches, key)
+			rdb.watched.Add(-1)
+		}
+	}
+}
+
+// watchVersion returns the current version of the watched key. watchVersion
+// is thread-safe.
+func (rdb *RedisDb) watchVersion(key string) uint64 {
+	rdb.watchMu.Lock()
+	defer rdb.watchMu.Unlock()
+
+	if w, ok := rdb.watches[key]; ok {
+		return w.version
+	}
+	return 0
+}
+
+// touchWatched bumps the version of key if it is watched, failing the
+// transactions of the clients watching it. It only takes watchMu if some key
+// is watched. touchWatched is thread-safe.
+func (rdb *RedisDb) touchWatched(key string) {
+	if rdb.watched.Load() == 0 {
+		return
+	}
+	rdb.watchMu.Lock()
+	defer rdb.watchMu.Unlock()
+
+	if w, ok := rdb.watches[key]; ok {
+		w.version++
+	}
+}
+
+// touchWatchedIn bumps the version of every watched key present in db, for
+// operations that replace the whole database. The caller must hold db.rwm for
+// writing.
+func (rdb *RedisDb) touchWatchedIn(db *RedisDb) {
+	rdb.watchMu.Lock()
+	defer rdb.watchMu.Unlock()
+
+	for key, w := range rdb.watches {
+		if _, ok := db.shard(key).store[key]; ok {
+			w.version++
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// benchmarkParallelSet runs SETs of distinct keys from parallel clients of
+// rg, each within lock when it is not nil.
+func benchmarkParallelSet(b *testing.B, rg *RedisGo, lock sync.Locker) {
+	var ids atomic.Int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		id := ids.Add(1)
+		c := NewClient(id, nil)
+		prefix := "key:" + strconv.FormatInt(id, 10) + ":"
+		for i := 0; pb.Next(); i++ {
+			v := newCommand("set", prefix+strconv.Itoa(i%10000), "value")
+			if lock != nil {
+				lock.Lock()
+			}
+			rg.dispatch(c, &v)
+			if lock != nil {
+				lock.Unlock()
+			}
+		}
+	})
+}
+
+// BenchmarkParallelSet compares parallel writers on the sharded keyspace with
+// the same writers behind a single lock, as before the keyspace was sharded,
+// and with the AOF enabled, which serializes writes through repl.mu.
+func BenchmarkParallelSet(b *testing.B) {
+	b.Run("sharded", func(b *testing.B) {
+		benchmarkParallelSet(b, newTestServer(b), nil)
+	})
+	b.Run("single-lock", func(b *testing.B) {
+		benchmarkParallelSet(b, newTestServer(b), &sync.Mutex{})
+	})
+	b.Run("aof", func(b *testing.B) {
+		benchmarkParallelSet(b, newTestServer(b, "appendonly yes", "appendfsync no"), nil)
+	})
+}
+
+// BenchmarkConcurrentGet runs Gets of a single hot key from parallel readers,
+// which only share the read lock of its shard, and for comparison the same
+// readers behind an exclusive lock, as Get took before.
+func BenchmarkConcurrentGet(b *testing.B) {
+	for _, exclusive := range []bool{false, true} {
+		name := "shared"
+		if exclusive {
+			name = "exclusive"
+		}
+		b.Run(name, func(b *testing.B) {
+			db := NewRedisDb(0)
+			unlock := db.lockKeys("hot")
+			db.put("hot", &Item{Kind: KindString, Value: "value"})
+			unlock()
+			var mu sync.Mutex
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if exclusive {
+						mu.Lock()
+					}
+					if _, ok := db.Get("hot"); !ok {
+						b.Error("hot key missing")
+					}
+					if exclusive {
+						mu.Unlock()
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestTypedCommandsWrongType(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "k", "string")
+	tests := [][]string{
+		// Lists.
+		{"lpush", "k", "a"},
+		{"rpush", "k", "a"},
+		{"lpop", "k"},
+		{"rpop", "k"},
+		{"llen", "k"},
+		{"lrange", "k", "0", "-1"},
+		{"lindex", "k", "0"},
+		{"lset", "k", "0", "a"},
+		{"lrem", "k", "0", "a"},
+		{"ltrim", "k", "0", "1"},
+		{"linsert", "k", "before", "a", "b"},
+		{"blpop", "k", "1"},
+		{"brpop", "k", "1"},
+
+		// Hashes.
+		{"hset", "k", "f", "v"},
+		{"hget", "k", "f"},
+		{"hmget", "k", "f"},
+		{"hgetall", "k"},
+		{"hdel", "k", "f"},
+		{"hlen", "k"},
+		{"hexists", "k", "f"},
+		{"hkeys", "k"},
+		{"hvals", "k"},
+		{"hincrby", "k", "f", "1"},
+		{"hincrbyfloat", "k", "f", "1"},
+		{"hscan", "k", "0"},
+
+		// Sets.
+		{"sadd", "k", "m"},
+		{"srem", "k", "m"},
+		{"smembers", "k"},
+		{"sismember", "k", "m"},
+		{"scard", "k"},
+		{"spop", "k"},
+		{"srandmember", "k"},
+		{"sinter", "k"},
+		{"sunion", "k"},
+		{"sdiff", "k"},
+		{"sinterstore", "d", "k"},
+		{"sscan", "k", "0"},
+
+		// Sorted sets.
+		{"zadd", "k", "1", "m"},
+		{"zscore", "k", "m"},
+		{"zrank", "k", "m"},
+		{"zrevrank", "k", "m"},
+		{"zrem", "k", "m"},
+		{"zcard", "k"},
+		{"zcount", "k", "0", "1"},
+		{"zrange", "k", "0", "-1"},
+		{"zrevrange", "k", "0", "-1"},
+		{"zrangebyscore", "k", "0", "1"},
+		{"zscan", "k", "0"},
+		{"geoadd", "k", "1", "1", "m"},
+		{"geopos", "k", "m"},
+		{"geodist", "k", "a", "b"},
+
+		// Streams.
+		{"xadd", "k", "*", "f", "v"},
+		{"xlen", "k"},
+		{"xrange", "k", "-", "+"},
+		{"xrevrange", "k", "+", "-"},
+		{"xread", "streams", "k", "0"},
+		{"xsetid", "k", "1-0"},
+	}
+	for _, args := range tests {
+		reply := do(rg, c, args...)
+		if reply.Type != Error || reply.Err != errWrongType {
+			t.Errorf("%q = %v, want %q", args, reply, errWrongType)
+		}
+	}
+	if reply := do(rg, c, "get", "k"); reply.Bulk != "string" {
+		t.Errorf("GET k = %v after the failed commands, want string", reply)
+	}
+
+	// The string commands refuse the other types in turn.
+	do(rg, c, "rpush", "list", "a")
+	for _, args := range [][]string{{"get", "list"}, {"append", "list", "a"}, {"incr", "list"}, {"strlen", "list"}, {"getrange", "list", "0", "1"}} {
+		if reply := do(rg, c, args...); reply.Type != Error || reply.Err != errWrongType {
+			t.Errorf("%q = %v, want %q", args, reply, errWrongType)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "debug", handler: debug, arity: -2, help: debugHelp},
+	)
+}
+
+// debugHelp is the reply to DEBUG HELP.
+var debugHelp = []string{
+	"OBJECT <key>",
+	"    Show low level info about the <key> and associated value.",
+	"SET-ACTIVE-EXPIRE <0|1>",
+	"    Setting it to 0 disables expiring keys in background when they are not",
+	"    accessed (otherwise the Redis behavior). Setting it to 1 reenables back the",
+	"    default.",
+	"SLEEP <seconds>",
+	"    Stop the server for <seconds>. Decimals allowed.",
+}
+
+// debug implements the DEBUG subcommands used by tests and when debugging
+// the server: SLEEP seconds, OBJECT key and SET-ACTIVE-EXPIRE 0|1.
+func debug(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[2:])
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "SLEEP" && len(args) == 1:
+		secs, err := parseFloat(args[0])
+		if err != nil || secs < 0 || secs > math.MaxInt64/float64(time.Second) {
+			return newError(errNotFloat)
+		}
+		time.Sleep(time.Duration(secs * float64(time.Second)))
+		return newOK()
+	case sub == "OBJECT" && len(args) == 1:
+		return debugObject(rg.db(c), args[0])
+	case sub == "SET-ACTIVE-EXPIRE" && len(args) == 1:
+		switch args[0] {
+		case "0":
+			rg.activeExpireOff.Store(true)
+		case "1":
+			rg.activeExpireOff.Store(false)
+		default:
+			return newError(errSyntax)
+		}
+		return newOK()
+	default:
+		return unknownSubcommand("debug", v.Array[1].Bulk)
+	}
+}
+
+// debugObject implements DEBUG OBJECT key, describing the internals of the
+// value stored at key.
+func debugObject(db *RedisDb, key string) *Value {
+	unlock := db.rlockKeys(key)
+	defer unlock()
+
+	item := db.peek(key)
+	if item == nil {
+		return newError("ERR no such key")
+	}
+	last := item.lastAccessed()
+	return newString(fmt.Sprintf("Value at:%p refcount:%d encoding:%s serializedlength:%d lru:%d lru_seconds_idle:%d",
+		item, item.refCount(), item.encoding(), item.payloadLen(), last.Unix()&(1<<24-1), int64(time.Since(last)/time.Second)))
+}
+
+// payloadLen returns the number of bytes of data held by the item: its string,
+// elements, fields and values, or members and their 8-byte scores.
+func (i *Item) payloadLen() int {
+	n := len(i.Value)
+	for _, elem := range i.List {
+		n += len(elem)
+	}
+	for field, val := range i.Hash {
+		n += len(field) + len(val)
+	}
+	for member := range i.Set {
+		n += len(member)
+	}
+	if i.ZSet != nil {
+		for member := range i.ZSet.Scores {
+			n += len(member) + 8
+		}
+	}
+	if i.Stream != nil {
+		for _, entry := range i.Stream.Entries {
+			n += 16
+			for _, field := range entry.Fields {
+				n += len(field)
+			}
+		}
+	}
+	return n
+}
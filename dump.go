@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc64"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "dump", handler: dump, arity: 2, keys: oneKey},
+		&Command{name: "restore", handler: restore, arity: -4, keys: oneKey, isWrite: true, denyOOM: true},
+	)
+}
+
+// dumpVersion is the version byte leading every DUMP payload. RESTORE refuses
+// payloads of any other version.
+const dumpVersion = 1
+
+// crcTable is the CRC-64 table used to checksum DUMP payloads.
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// errBadDump is the error replied to RESTORE with a corrupt payload.
+const errBadDump = "ERR Bad data format"
+
+// dumpItem serializes the value of item, without its expiry or access
+// statistics, as the version byte, the gob encoding of the value, as used by
+// the RDB file, and a little-endian CRC-64 of both.
+func dumpItem(item *Item) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(dumpVersion)
+	payload := &Item{
+		Kind:   item.Kind,
+		Value:  item.Value,
+		List:   item.List,
+		Hash:   item.Hash,
+		Set:    item.Set,
+		ZSet:   item.ZSet,
+		Stream: item.Stream,
+	}
+	if err := gob.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return binary.LittleEndian.AppendUint64(buf.Bytes(), crc64.Checksum(buf.Bytes(), crcTable)), nil
+}
+
+// undumpItem decodes a payload made by dumpItem, verifying its version and
+// checksum and that it holds a well-formed value.
+func undumpItem(data []byte) (*Item, bool) {
+	if len(data) < 9 || data[0] != dumpVersion {
+		return nil, false
+	}
+	body, sum := data[:len(data)-8], binary.LittleEndian.Uint64(data[len(data)-8:])
+	if crc64.Checksum(body, crcTable) != sum {
+		return nil, false
+	}
+	var item Item
+	if err := gob.NewDecoder(bytes.NewReader(body[1:])).Decode(&item); err != nil {
+		return nil, false
+	}
+	// Gob omits empty collections, but the keyspace never holds one.
+	switch item.Kind {
+	case KindString:
+	case KindList:
+		if len(item.List) == 0 {
+			return nil, false
+		}
+	case KindHash:
+		if len(item.Hash) == 0 {
+			return nil, false
+		}
+	case KindSet:
+		if len(item.Set) == 0 {
+			return nil, false
+		}
+	case KindZSet:
+		if item.ZSet == nil || item.ZSet.Len() == 0 || len(item.ZSet.Scores) != item.ZSet.Len() {
+			return nil, false
+		}
+	case KindStream:
+		// Unlike other collections, a stream may be empty.
+		if item.Stream == nil {
+			item.Stream = &Stream{}
+		}
+		for i, entry := range item.Stream.Entries {
+			if len(entry.Fields) == 0 || len(entry.Fields)%2 != 0 ||
+				i > 0 && compareStreamID(item.Stream.Entries[i-1].ID, entry.ID) >= 0 {
+				return nil, false
+			}
+		}
+		if n := item.Stream.Len(); n > 0 && compareStreamID(item.Stream.Entries[n-1].ID, item.Stream.LastID) > 0 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	item.Expiration = time.Unix(unixTSEpoch, 0)
+	return &item, true
+}
+
+// dump implements DUMP key, replying with the serialized value of key, or a
+// null if it is missing.
+func dump(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item := db.peek(v.Array[1].Bulk)
+	if item == nil {
+		return newNull()
+	}
+	data, err := dumpItem(item)
+	if err != nil {
+		return newError("ERR %v", err)
+	}
+	return newBulk(string(data))
+}
+
+// restore implements RESTORE key ttl serialized-value [REPLACE] [ABSTTL],
+// creating key from a DUMP payload. ttl is in milliseconds, 0 meaning no
+// expiry, or a Unix time in milliseconds with ABSTTL. Without REPLACE an
+// existing key is an error.
+func restore(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	ttl, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	if ttl < 0 || ttl > math.MaxInt64/int64(time.Millisecond) {
+		return newError("ERR Invalid TTL value, must be >= 0")
+	}
+	var replace, absTTL bool
+	for _, arg := range v.Array[4:] {
+		switch strings.ToUpper(arg.Bulk) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		default:
+			return newError(errSyntax)
+		}
+	}
+	item, ok := undumpItem([]byte(v.Array[3].Bulk))
+	if !ok {
+		return newError(errBadDump)
+	}
+	if ttl > 0 {
+		if absTTL {
+			item.Expiration = time.UnixMilli(ttl)
+		} else {
+			item.Expiration = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	if db.lookup(key) != nil && !replace {
+		return newError("BUSYKEY Target key name already exists.")
+	}
+	if item.hasExpired() {
+		// Already expired: the key ends up missing, as if it had been restored
+		// and then expired right away.
+		if db.remove(key) {
+			db.notify(notifyGeneric, "del", key)
+			c.propagateAs("del", key)
+		} else {
+			c.propagateNone()
+		}
+		return newOK()
+	}
+	db.put(key, item)
+	db.notify(notifyGeneric, "restore", key)
+	if item.hasExpiry() {
+		// A relative TTL would be counted from the time of the replay.
+		c.propagateAs("restore", key, strconv.FormatInt(item.Expiration.UnixMilli(), 10),
+			v.Array[3].Bulk, "REPLACE", "ABSTTL")
+	}
+	return newOK()
+}
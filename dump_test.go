@@ -0,0 +1,87 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+// hashOf returns the fields and values of an HGETALL reply.
+func hashOf(reply *Value) map[string]string {
+	hash := map[string]string{}
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		hash[reply.Array[i].Bulk] = reply.Array[i+1].Bulk
+	}
+	return hash
+}
+
+func TestDumpRestoreHash(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "hset", "h", "a", "1", "b", "2", "bin", binaryValue)
+	payload := do(rg, c, "dump", "h")
+	if payload.Type != Bulk {
+		t.Fatalf("DUMP h = %v, want a bulk string", payload)
+	}
+	if reply := do(rg, c, "restore", "copy", "0", payload.Bulk); reply.Type != String || reply.Str != "OK" {
+		t.Fatalf("RESTORE copy = %v, want OK", reply)
+	}
+	want := hashOf(do(rg, c, "hgetall", "h"))
+	if got := hashOf(do(rg, c, "hgetall", "copy")); !maps.Equal(got, want) {
+		t.Fatalf("restored hash = %v, want %v", got, want)
+	}
+	if reply := do(rg, c, "ttl", "copy"); reply.Int != -1 {
+		t.Fatalf("TTL copy = %v, want -1", reply)
+	}
+	if reply := do(rg, c, "dump", "missing"); reply.Type != Null {
+		t.Fatalf("DUMP missing = %v, want null", reply)
+	}
+}
+
+func TestRestoreBadPayload(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "hset", "h", "a", "1")
+	payload := do(rg, c, "dump", "h").Bulk
+
+	corrupt := func(i int) string {
+		b := []byte(payload)
+		b[i] ^= 0xff
+		return string(b)
+	}
+	tests := map[string]string{
+		"checksum": corrupt(len(payload) - 1),
+		"body":     corrupt(len(payload) / 2),
+		"version":  corrupt(0),
+		"short":    payload[:8],
+	}
+	for name, bad := range tests {
+		if reply := do(rg, c, "restore", "copy", "0", bad); reply.Type != Error || reply.Err != errBadDump {
+			t.Errorf("RESTORE with a bad %s = %v, want %q", name, reply, errBadDump)
+		}
+	}
+	if reply := do(rg, c, "exists", "copy"); reply.Int != 0 {
+		t.Fatalf("EXISTS copy after failed restores = %v, want 0", reply)
+	}
+}
+
+func TestRestoreBusyKey(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "hset", "h", "a", "1")
+	payload := do(rg, c, "dump", "h").Bulk
+	do(rg, c, "set", "k", "string")
+
+	const errBusy = "BUSYKEY Target key name already exists."
+	if reply := do(rg, c, "restore", "k", "0", payload); reply.Type != Error || reply.Err != errBusy {
+		t.Fatalf("RESTORE onto an existing key = %v, want %q", reply, errBusy)
+	}
+	if reply := do(rg, c, "get", "k"); reply.Bulk != "string" {
+		t.Fatalf("GET k after the refused RESTORE = %v, want string", reply)
+	}
+	if reply := do(rg, c, "restore", "k", "0", payload, "replace"); reply.Type != String || reply.Str != "OK" {
+		t.Fatalf("RESTORE REPLACE = %v, want OK", reply)
+	}
+	if reply := do(rg, c, "hget", "k", "a"); reply.Bulk != "1" {
+		t.Fatalf("HGET k a after RESTORE REPLACE = %v, want 1", reply)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import "time"
+
+// writeCost estimates how many bytes executing the command in v would add to
+// the dataset: the size of its arguments plus the overhead of one new entry.
+// It is deliberately rough since the real cost depends on the command.
+func writeCost(v *Value) uint64 {
+	cost := uint64(mapEntry + timeSize)
+	for _, arg := range v.Array[1:] {
+		cost += uint64(len(arg.Bulk))
+	}
+	return cost
+}
+
+// checkMemory reports whether the write command in v may run under the
+// configured maxmemory limit, evicting keys first if the policy allows it.
+func (rg *RedisGo) checkMemory(v *Value) bool {
+	return rg.freeMemory(writeCost(v))
+}
+
+// freeMemory evicts keys according to maxmemory-policy until memory usage plus
+// extra fits under maxmemory. It reports whether it succeeded; with
+// noeviction, or when the policy finds nothing left to evict, it fails. A
+// maxmemory of 0 disables the limit.
+func (rg *RedisGo) freeMemory(extra uint64) bool {
+	rg.conf.mu.RLock()
+	maxmem, policy, samples := rg.conf.maxmem, rg.conf.eviction, rg.conf.memSamples
+	rg.conf.mu.RUnlock()
+
+	if maxmem == 0 {
+		return true
+	}
+	decay := rg.conf.lfuDecayPeriod()
+	for rg.memUsed()+extra > maxmem {
+		if policy == NoEviction || !rg.evictOne(policy, samples, decay) {
+			return false
+		}
+	}
+	return true
+}
+
+// evictOne deletes a single key chosen by policy and reports whether one was
+// found. The sampled policies look at samples keys per database and evict the
+// best candidate among all of them; LFU frequencies decay over decay.
+func (rg *RedisGo) evictOne(policy Eviction, samples int, decay time.Duration) bool {
+	switch policy {
+	case AllKeysRandom, VolatileRandom:
+		return rg.evictRandom(policy == VolatileRandom)
+	case AllKeysLRU, VolatileLRU:
+		return rg.evictSampled(policy == VolatileLRU, samples, func(a, b sample) bool {
+			return a.val.lastAccessed().Before(b.val.lastAccessed())
+		})
+	case AllKeysLFU, VolatileLFU:
+		return rg.evictSampled(policy == VolatileLFU, samples, func(a, b sample) bool {
+			fa, fb := a.val.frequency(decay), b.val.frequency(decay)
+			if fa != fb {
+				return fa < fb
+			}
+			return a.val.lastAccessed().Before(b.val.lastAccessed())
+		})
+	case VolatileTTL:
+		return rg.evictSampled(true, samples, func(a, b sample) bool {
+			return a.expiration.Before(b.expiration)
+		})
+	default:
+		// The config parser and CONFIG SET only accept the policies above,
+		// and noeviction never gets here.
+		return false
+	}
+}
+
+// evictRandom deletes a random key, or a random key with an expiry set when
+// volatile. Databases are tried starting from a random index so eviction is
+// spread across the whole keyspace rather than always draining db 0 first.
+func (rg *RedisGo) evictRandom(volatile bool) bool {
+	start := rg.randIntn(len(rg.dbs))
+	for i := range rg.dbs {
+		db := rg.dbs[(start+i)%len(rg.dbs)]
+		for _, s := range db.sampleKeys(1, volatile) {
+			if rg.evict(db, s.key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evictSampled samples count keys from every database and deletes the one
+// that better ranks first, approximating Redis's sampled LRU/LFU eviction.
+func (rg *RedisGo) evictSampled(volatile bool, count int, better func(a, b sample) bool) bool {
+	var (
+		bestDb *RedisDb
+		best   sample
+	)
+	for _, db := range rg.dbs {
+		for _, s := range db.sampleKeys(count, volatile) {
+			if s.val == nil {
+				continue
+			}
+			if bestDb == nil || better(s, best) {
+				bestDb, best = db, s
+			}
+		}
+	}
+	if bestDb == nil {
+		return false
+	}
+	// The key may have been deleted since it was sampled, in which case the
+	// caller's loop simply samples again.
+	rg.evict(bestDb, best.key)
+	return true
+}
+
+// evict deletes key from db to reclaim memory, reporting whether it still
+// existed. The deletion is propagated as a DEL, so that the AOF and the
+// replicas drop the key too instead of keeping it past the memory limit.
+func (rg *RedisGo) evict(db *RedisDb, key string) bool {
+	if !db.evict(key) {
+		return false
+	}
+	rg.genStats.evictedKeys.Add(1)
+	rg.propagate(db.id, newCommand("del", key))
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEvictedKeysStayGoneAfterAofReload(t *testing.T) {
+	dir := t.TempDir()
+	conf := []string{
+		"dir " + dir,
+		"appendonly yes",
+		"appendfsync always",
+		"maxmemory-policy allkeys-random",
+	}
+	rg := newTestServer(t, conf...)
+	c := NewClient(1, nil)
+	for i := range 100 {
+		do(rg, c, "set", "key:"+strconv.Itoa(i), "value")
+	}
+	if reply := do(rg, c, "config", "set", "maxmemory", "1"); reply.Type == Error {
+		t.Fatalf("CONFIG SET maxmemory: %s", reply.Str)
+	}
+	evicted := rg.genStats.evictedKeys.Load()
+	if evicted == 0 {
+		t.Fatal("no key was evicted")
+	}
+	want := 100 - int(evicted)
+	if got := rg.dbs[0].Size(); got != want {
+		t.Fatalf("%d keys before reload, want %d", got, want)
+	}
+	closeTestServer(rg)
+
+	rg = newTestServer(t, conf...)
+	if got := rg.dbs[0].Size(); got != want {
+		t.Fatalf("%d keys after reload, want %d", got, want)
+	}
+}
+
+func TestEvictVolatileTTL(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "persistent", "value")
+	for i := range 5 {
+		do(rg, c, "set", "key:"+strconv.Itoa(i), "value", "ex", strconv.Itoa(100*(i+1)))
+	}
+	// With as many samples as keys, every key is a candidate.
+	for i := range 5 {
+		if !rg.evictOne(VolatileTTL, 10, 0) {
+			t.Fatalf("eviction %d found no key", i)
+		}
+		key := "key:" + strconv.Itoa(i)
+		if reply := do(rg, c, "exists", key); reply.Int != 0 {
+			t.Fatalf("%s still exists after eviction %d, want the shortest TTL evicted first", key, i)
+		}
+	}
+	if rg.evictOne(VolatileTTL, 10, 0) {
+		t.Fatal("volatile-ttl evicted a key without an expiry")
+	}
+	if reply := do(rg, c, "exists", "persistent"); reply.Int != 1 {
+		t.Fatalf("EXISTS persistent = %v, want 1", reply)
+	}
+}
+
+func TestNoEvictionRejectsWrites(t *testing.T) {
+	rg := newTestServer(t, "maxmemory-policy noeviction")
+	c := NewClient(1, nil)
+	for i := range 100 {
+		do(rg, c, "set", "key:"+strconv.Itoa(i), "value")
+	}
+	if reply := do(rg, c, "config", "set", "maxmemory", "1"); reply.Type == Error {
+		t.Fatalf("CONFIG SET maxmemory: %s", reply.Str)
+	}
+	const errOOM = "OOM command not allowed when used memory > 'maxmemory'."
+	if reply := do(rg, c, "set", "another", "value"); reply.Type != Error || reply.Err != errOOM {
+		t.Fatalf("SET past maxmemory = %v, want %q", reply, errOOM)
+	}
+	if reply := do(rg, c, "get", "key:0"); reply.Type != Bulk || reply.Bulk != "value" {
+		t.Fatalf("GET past maxmemory = %v, want value", reply)
+	}
+	// Commands that free memory are still allowed.
+	if reply := do(rg, c, "del", "key:0"); reply.Type != Integer || reply.Int != 1 {
+		t.Fatalf("DEL past maxmemory = %v, want 1", reply)
+	}
+	if got := rg.genStats.evictedKeys.Load(); got != 0 {
+		t.Fatalf("%d keys evicted under noeviction, want 0", got)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "ttl", handler: ttl, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "pttl", handler: pttl, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "expiretime", handler: expireTime, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "pexpiretime", handler: pexpireTime, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "expire", handler: expire, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "pexpire", handler: pexpire, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "expireat", handler: expireAt, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "pexpireat", handler: pexpireAt, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "persist", handler: persist, arity: 2, keys: oneKey, isWrite: true, fast: true},
+	)
+}
+
+// remainingTTL returns the time to live of key in milliseconds, -2 if the key
+// does not exist and -1 if it has no expiry.
+func remainingTTL(db *RedisDb, key string) int64 {
+	unlock := db.rlockKeys(key)
+	defer unlock()
+
+	item := db.peek(key)
+	if item == nil {
+		return -2
+	}
+	if !item.hasExpiry() {
+		return -1
+	}
+	return max(time.Until(item.Expiration).Milliseconds(), 0)
+}
+
+// ttl implements TTL key, replying with the remaining time to live in seconds.
+func ttl(c *Client, v *Value, rg *RedisGo) *Value {
+	ms := remainingTTL(rg.db(c), v.Array[1].Bulk)
+	if ms < 0 {
+		return newInteger(ms)
+	}
+	return newInteger((ms + 500) / 1000)
+}
+
+// pttl implements PTTL key, replying with the remaining time to live in
+// milliseconds.
+func pttl(c *Client, v *Value, rg *RedisGo) *Value {
+	return newInteger(remainingTTL(rg.db(c), v.Array[1].Bulk))
+}
+
+// expiryTime returns the absolute Unix time in milliseconds at which key
+// expires, -2 if the key does not exist and -1 if it has no expiry.
+func expiryTime(db *RedisDb, key string) int64 {
+	unlock := db.rlockKeys(key)
+	defer unlock()
+
+	item := db.peek(key)
+	if item == nil {
+		return -2
+	}
+	if !item.hasExpiry() {
+		return -1
+	}
+	return item.Expiration.UnixMilli()
+}
+
+// expireTime implements EXPIRETIME key, replying with the Unix time in
+// seconds at which key expires.
+func expireTime(c *Client, v *Value, rg *RedisGo) *Value {
+	ms := expiryTime(rg.db(c), v.Array[1].Bulk)
+	if ms < 0 {
+		return newInteger(ms)
+	}
+	return newInteger(ms / 1000)
+}
+
+// pexpireTime implements PEXPIRETIME key, replying with the Unix time in
+// milliseconds at which key expires.
+func pexpireTime(c *Client, v *Value, rg *RedisGo) *Value {
+	return newInteger(expiryTime(rg.db(c), v.Array[1].Bulk))
+}
+
+// expire implements EXPIRE key seconds [NX|XX|GT|LT].
+func expire(c *Client, v *Value, rg *RedisGo) *Value {
+	return expireGeneric(c, "expire", v, rg, time.Second, false)
+}
+
+// pexpire implements PEXPIRE key milliseconds [NX|XX|GT|LT].
+func pexpire(c *Client, v *Value, rg *RedisGo) *Value {
+	return expireGeneric(c, "pexpire", v, rg, time.Millisecond, false)
+}
+
+// expireAt implements EXPIREAT key unix-time-seconds [NX|XX|GT|LT].
+func expireAt(c *Client, v *Value, rg *RedisGo) *Value {
+	return expireGeneric(c, "expireat", v, rg, time.Second, true)
+}
+
+// pexpireAt implements PEXPIREAT key unix-time-milliseconds [NX|XX|GT|LT].
+func pexpireAt(c *Client, v *Value, rg *RedisGo) *Value {
+	return expireGeneric(c, "pexpireat", v, rg, time.Millisecond, true)
+}
+
+// expireGeneric sets the expiry of a key to the time given in unit, relative
+// to now or as an absolute Unix timestamp if abs is set. The optional NX, XX,
+// GT and LT flags make the update conditional on the current expiry. An expiry
+// in the past deletes the key right away. The AOF records the outcome as an
+// absolute PEXPIREAT or a DEL so that replaying it later has the same effect.
+func expireGeneric(c *Client, cmd string, v *Value, rg *RedisGo, unit time.Duration, abs bool) *Value {
+	key := v.Array[1].Bulk
+	n, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	var nx, xx, gt, lt bool
+	for _, arg := range v.Array[3:] {
+		switch strings.ToUpper(arg.Bulk) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return newError("ERR Unsupported option %s", arg.Bulk)
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return newError("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return newError("ERR GT and LT options at the same time are not compatible")
+	}
+	limit := int64(math.MaxInt64 / unit)
+	if n > limit || n < -limit {
+		return newError("ERR invalid expire time in '%s' command", cmd)
+	}
+	var when time.Time
+	if abs {
+		when = time.Unix(0, 0).Add(time.Duration(n) * unit)
+	} else {
+		when = time.Now().Add(time.Duration(n) * unit)
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item := db.lookup(key)
+	if item == nil {
+		c.propagateNone()
+		return newInteger(0)
+	}
+	switch {
+	case nx && item.hasExpiry(), xx && !item.hasExpiry(),
+		gt && (!item.hasExpiry() || !when.After(item.Expiration)),
+		lt && item.hasExpiry() && !when.Before(item.Expiration):
+		c.propagateNone()
+		return newInteger(0)
+	}
+	if !when.After(time.Now()) {
+		db.expire(key)
+		c.propagateAs("del", key)
+		return newInteger(1)
+	}
+	db.setExpiry(key, item, when)
+	db.notify(notifyGeneric, "expire", key)
+	c.propagateAs("pexpireat", key, strconv.FormatInt(when.UnixMilli(), 10))
+	return newInteger(1)
+}
+
+// persist implements PERSIST key, replying 1 if an expiry was removed.
+func persist(c *Client, v *Value, rg *RedisGo) *Value {
+	if rg.db(c).Persist(v.Array[1].Bulk) {
+		return newInteger(1)
+	}
+	return newInteger(0)
+}
+
+// activeExpire periodically samples keys with an expiry and deletes the ones
+// that have expired, so that keys which are never read again don't hold memory
+// forever. It runs conf.hz times a second until conf.quit is closed.
+func (rg *RedisGo) activeExpire() {
+	ticker := time.NewTicker(time.Second / time.Duration(rg.conf.hz))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.conf.quit:
+			return
+		case <-ticker.C:
+			if !rg.activeExpireOff.Load() {
+				rg.activeExpireCycle()
+			}
+		}
+	}
+}
+
+// activeExpireCycle runs one active expiry cycle over every database. Like
+// Redis's adaptive cycle it keeps sampling a database while more than a
+// quarter of the sampled keys turn out to be expired, bounded to a quarter of
+// the tick interval so that a large batch of expired keys can't stall the
+// server.
+func (rg *RedisGo) activeExpireCycle() {
+	budget := time.Second / time.Duration(rg.conf.hz) / 4
+	start := time.Now()
+
+	for _, db := range rg.dbs {
+		for time.Since(start) < budget {
+			sampled, expired := db.expireSample(rg.conf.activeExpireSamples)
+			if sampled == 0 || expired*4 <= sampled {
+				break
+			}
+		}
+	}
+	rg.propagateExpired()
+	rg.sampleLatency("expire-cycle", time.Since(start))
+}
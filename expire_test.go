@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiryPropagatedAsDel(t *testing.T) {
+	rg := newTestServer(t, "appendonly yes", "appendfsync always")
+	rg.activeExpireOff.Store(true)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "lazy", "v", "px", "1")
+	do(rg, c, "set", "active", "v", "px", "1")
+	time.Sleep(5 * time.Millisecond)
+
+	if reply := do(rg, c, "get", "lazy"); reply.Type != Null {
+		t.Fatalf("GET of an expired key replied %v", reply)
+	}
+	rg.activeExpireCycle()
+	// The queued DELs are propagated ahead of the next write.
+	do(rg, c, "set", "lazy", "again")
+
+	data, err := os.ReadFile(rg.aofPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	aof := string(data)
+	for _, key := range []string{"lazy", "active"} {
+		del := respOf(newCommand("del", key))
+		if !strings.Contains(aof, del) {
+			t.Errorf("AOF has no DEL of %q", key)
+		}
+	}
+	del := strings.Index(aof, respOf(newCommand("del", "lazy")))
+	set := strings.Index(aof, respOf(newCommand("set", "lazy", "again")))
+	if del > set {
+		t.Errorf("DEL of the expired key follows the write recreating it")
+	}
+}
+
+// respOf returns v encoded in RESP.
+func respOf(v Value) string {
+	var b strings.Builder
+	w := NewWriter(&b)
+	_ = w.Write(&v)
+	_ = w.Flush()
+	return b.String()
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "geoadd", handler: geoadd, arity: -5, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "geopos", handler: geopos, arity: -2, keys: oneKey},
+		&Command{name: "geodist", handler: geodist, arity: -4, keys: oneKey},
+		&Command{name: "geosearch", handler: geosearch, arity: -7, keys: oneKey},
+	)
+}
+
+// Geospatial items are sorted sets whose scores are 52-bit geohashes of the
+// coordinates of their members, interleaving 26 bits of latitude with 26
+// bits of longitude, as in Redis. Latitudes are limited to those of the
+// Web Mercator projection.
+const (
+	geoLonMin = -180
+	geoLonMax = 180
+	geoLatMin = -85.05112878
+	geoLatMax = 85.05112878
+	geoStep   = 26
+
+	// earthRadius is the radius of the Earth in meters, the one Redis
+	// computes distances with.
+	earthRadius = 6372797.560856
+
+	// mercatorMax is half the width of the projected Earth in meters.
+	mercatorMax = 20037726.37
+)
+
+// geoHash is a geohash of step bits of latitude and as many of longitude,
+// latitude bits at even positions and longitude bits at odd ones.
+type geoHash struct {
+	bits uint64
+	step uint
+}
+
+// geoArea is the cell of the Earth a geohash stands for.
+type geoArea struct {
+	lonMin, lonMax, latMin, latMax float64
+}
+
+// spreadBits moves the low 32 bits of v to the even bit positions.
+func spreadBits(v uint64) uint64 {
+	v &= 0xffffffff
+	v = (v | v<<16) & 0x0000ffff0000ffff
+	v = (v | v<<8) & 0x00ff00ff00ff00ff
+	v = (v | v<<4) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v<<2) & 0x3333333333333333
+	v = (v | v<<1) & 0x5555555555555555
+	return v
+}
+
+// squashBits is the inverse of spreadBits, gathering the even bits of v.
+func squashBits(v uint64) uint64 {
+	v &= 0x5555555555555555
+	v = (v | v>>1) & 0x3333333333333333
+	v = (v | v>>2) & 0x0f0f0f0f0f0f0f0f
+	v = (v | v>>4) & 0x00ff00ff00ff00ff
+	v = (v | v>>8) & 0x0000ffff0000ffff
+	v = (v | v>>16) & 0x00000000ffffffff
+	return v
+}
+
+// validLonLat reports whether the coordinates can be geohashed.
+func validLonLat(lon, lat float64) bool {
+	return lon >= geoLonMin && lon <= geoLonMax && lat >= geoLatMin && lat <= geoLatMax
+}
+
+// encodeGeoHash returns the geohash of the cell of the given step holding
+// the coordinates, which must be valid.
+func encodeGeoHash(lon, lat float64, step uint) geoHash {
+	latOff := (lat - geoLatMin) / (geoLatMax - geoLatMin) * float64(uint64(1)<<step)
+	lonOff := (lon - geoLonMin) / (geoLonMax - geoLonMin) * float64(uint64(1)<<step)
+	return geoHash{spreadBits(uint64(latOff)) | spreadBits(uint64(lonOff))<<1, step}
+}
+
+// area returns the cell h stands for.
+func (h geoHash) area() geoArea {
+	lat, lon := squashBits(h.bits), squashBits(h.bits>>1)
+	cells := float64(uint64(1) << h.step)
+	return geoArea{
+		lonMin: geoLonMin + float64(lon)/cells*(geoLonMax-geoLonMin),
+		lonMax: geoLonMin + float64(lon+1)/cells*(geoLonMax-geoLonMin),
+		latMin: geoLatMin + float64(lat)/cells*(geoLatMax-geoLatMin),
+		latMax: geoLatMin + float64(lat+1)/cells*(geoLatMax-geoLatMin),
+	}
+}
+
+// decodeGeoScore returns the coordinates of the center of the cell the
+// score of a geospatial member stands for.
+func decodeGeoScore(score float64) (lon, lat float64) {
+	a := geoHash{uint64(score), geoStep}.area()
+	lon = min(max((a.lonMin+a.lonMax)/2, geoLonMin), geoLonMax)
+	lat = min(max((a.latMin+a.latMax)/2, geoLatMin), geoLatMax)
+	return lon, lat
+}
+
+// move returns the cell dx cells east and dy cells north of h, each -1, 0
+// or 1. Longitudes wrap around; latitudes too, which the callers rule out.
+func (h geoHash) move(dx, dy int) geoHash {
+	const evens, odds = 0x5555555555555555, 0xaaaaaaaaaaaaaaaa
+	shift := 64 - 2*h.step
+	lon, lat := h.bits&odds, h.bits&evens
+	step := func(v uint64, d int, fill, keep uint64) uint64 {
+		switch {
+		case d > 0:
+			v += fill + 1
+		case d < 0:
+			v = (v | fill) - (fill + 1)
+		}
+		return v & keep
+	}
+	lon = step(lon, dx, evens>>shift, odds>>shift)
+	lat = step(lat, dy, odds>>shift, evens>>shift)
+	return geoHash{lon | lat, h.step}
+}
+
+// geoDistance returns the distance in meters between two points along the
+// surface of the Earth, by the haversine formula.
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	lat1r, lat2r := lat1*math.Pi/180, lat2*math.Pi/180
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((lon2 - lon1) * math.Pi / 180 / 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1r)*math.Cos(lat2r)*v*v))
+}
+
+// geoUnits maps the distance units to their length in meters.
+var geoUnits = map[string]float64{"m": 1, "km": 1000, "ft": 0.3048, "mi": 1609.34}
+
+// parseGeoUnit parses a distance unit, replying with its length in meters.
+func parseGeoUnit(arg string) (float64, *Value) {
+	unit, ok := geoUnits[strings.ToLower(arg)]
+	if !ok {
+		return 0, newError("ERR unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return unit, nil
+}
+
+// parseLonLat parses a longitude and latitude, which must be valid.
+func parseLonLat(lonArg, latArg string) (lon, lat float64, errv *Value) {
+	lon, err1 := parseFloat(lonArg)
+	lat, err2 := parseFloat(latArg)
+	if err1 != nil || err2 != nil {
+		return 0, 0, newError(errNotFloat)
+	}
+	if !validLonLat(lon, lat) {
+		return 0, 0, newError("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+// formatDistance formats a distance in the given unit the way Redis replies
+// with it.
+func formatDistance(meters, unit float64) string {
+	return strconv.FormatFloat(meters/unit, 'f', 4, 64)
+}
+
+// geoadd implements GEOADD key [NX|XX] [CH] longitude latitude member
+// [longitude latitude member ...], adding the members to the sorted set at
+// key with the geohashes of their coordinates as scores. It replies like
+// ZADD, which it is run as.
+func geoadd(c *Client, v *Value, rg *RedisGo) *Value {
+	zaddArgs := []Value{{Type: Bulk, Bulk: "zadd"}, v.Array[1]}
+	i := 2
+	var nx, xx bool
+options:
+	for ; i < len(v.Array); i++ {
+		switch strings.ToUpper(v.Array[i].Bulk) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+		default:
+			break options
+		}
+		zaddArgs = append(zaddArgs, v.Array[i])
+	}
+	triples := v.Array[i:]
+	switch {
+	case len(triples) == 0 || len(triples)%3 != 0:
+		return newError("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	case nx && xx:
+		return newError("ERR XX and NX options at the same time are not compatible")
+	}
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, errv := parseLonLat(triples[j].Bulk, triples[j+1].Bulk)
+		if errv != nil {
+			return errv
+		}
+		hash := encodeGeoHash(lon, lat, geoStep)
+		zaddArgs = append(zaddArgs,
+			Value{Type: Bulk, Bulk: strconv.FormatUint(hash.bits, 10)},
+			triples[j+2])
+	}
+	return zadd(c, newArray(zaddArgs), rg)
+}
+
+// geopos implements GEOPOS key [member ...], replying with the longitude
+// and latitude of each member, or a null array for those missing.
+func geopos(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	vals := make([]Value, len(v.Array)-2)
+	for i, member := range v.Array[2:] {
+		vals[i] = *newNullArray()
+		if item == nil {
+			continue
+		}
+		if score, ok := item.ZSet.Score(member.Bulk); ok {
+			vals[i] = geoCoordValue(decodeGeoScore(score))
+		}
+	}
+	return newArray(vals)
+}
+
+// geoCoordValue returns the reply for a longitude and latitude.
+func geoCoordValue(lon, lat float64) Value {
+	return Value{Type: Array, Array: []Value{
+		{Type: Bulk, Bulk: strconv.FormatFloat(lon, 'f', -1, 64)},
+		{Type: Bulk, Bulk: strconv.FormatFloat(lat, 'f', -1, 64)},
+	}}
+}
+
+// geodist implements GEODIST key member1 member2 [M|KM|FT|MI], replying
+// with the distance between the members in the unit, meters by default, or
+// a null if either is missing.
+func geodist(c *Client, v *Value, rg *RedisGo) *Value {
+	unit := 1.0
+	switch len(v.Array) {
+	case 4:
+	case 5:
+		var errv *Value
+		if unit, errv = parseGeoUnit(v.Array[4].Bulk); errv != nil {
+			return errv
+		}
+	default:
+		return newError(errSyntax)
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	score1, ok1 := item.ZSet.Score(v.Array[2].Bulk)
+	score2, ok2 := item.ZSet.Score(v.Array[3].Bulk)
+	if !ok1 || !ok2 {
+		return newNull()
+	}
+	lon1, lat1 := decodeGeoScore(score1)
+	lon2, lat2 := decodeGeoScore(score2)
+	return newBulk(formatDistance(geoDistance(lon1, lat1, lon2, lat2), unit))
+}
+
+// geoShape is the area GEOSEARCH looks in: a circle of the given radius, or
+// a box of the given width and height, around a center, in meters.
+type geoShape struct {
+	lon, lat      float64
+	byBox         bool
+	radius        float64
+	width, height float64
+}
+
+// distanceTo returns the distance from the center of s to the point,
+// reporting whether the point lies within s.
+func (s *geoShape) distanceTo(lon, lat float64) (float64, bool) {
+	if s.byBox {
+		// The box is aligned with the meridians: the point must lie within
+		// half its height of the center's latitude, and within half its
+		// width of the center's longitude along that latitude.
+		if earthRadius*math.Abs(lat-s.lat)*math.Pi/180 > s.height/2 {
+			return 0, false
+		}
+		if geoDistance(lon, s.lat, s.lon, s.lat) > s.width/2 {
+			return 0, false
+		}
+		return geoDistance(s.lon, s.lat, lon, lat), true
+	}
+	dist := geoDistance(s.lon, s.lat, lon, lat)
+	return dist, dist <= s.radius
+}
+
+// cells returns the geohash cells covering s: the cell holding the center
+// and its neighbors, at the finest step at which they still cover the
+// bounding box of s, leaving out the neighbors outside the box.
+func (s *geoShape) cells() []geoHash {
+	halfW, halfH := s.radius, s.radius
+	if s.byBox {
+		halfW, halfH = s.width/2, s.height/2
+	}
+	latDelta := halfH / earthRadius * 180 / math.Pi
+	// The box is widest at the latitude furthest from the equator.
+	edgeLat := s.lat + latDelta
+	if s.lat < 0 {
+		edgeLat = s.lat - latDelta
+	}
+	lonDelta := halfW / earthRadius / math.Cos(edgeLat*math.Pi/180) * 180 / math.Pi
+	box := geoArea{s.lon - lonDelta, s.lon + lonDelta, s.lat - latDelta, s.lat + latDelta}
+
+	step := geoEstimateStep(math.Hypot(halfW, halfH), s.lat)
+	hash := encodeGeoHash(s.lon, s.lat, step)
+	neighbor := func(dx, dy int) geoArea { return hash.move(dx, dy).area() }
+	if step > 1 && (neighbor(0, 1).latMax < box.latMax || neighbor(0, -1).latMin > box.latMin ||
+		neighbor(1, 0).lonMax < box.lonMax || neighbor(-1, 0).lonMin > box.lonMin) {
+		step--
+		hash = encodeGeoHash(s.lon, s.lat, step)
+	}
+
+	area := hash.area()
+	var cells []geoHash
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			if step >= 2 && (dy < 0 && area.latMin < box.latMin || dy > 0 && area.latMax > box.latMax ||
+				dx < 0 && area.lonMin < box.lonMin || dx > 0 && area.lonMax > box.lonMax) {
+				continue
+			}
+			if cell := hash.move(dx, dy); !slices.Contains(cells, cell) {
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+// geoEstimateStep returns the step of the geohash cells whose neighbors
+// cover the given distance in meters around a point at latitude lat. Cells
+// narrow towards the poles, so the step is lowered there.
+func geoEstimateStep(meters, lat float64) uint {
+	if meters == 0 {
+		return geoStep
+	}
+	step := 1
+	for ; meters < mercatorMax; meters *= 2 {
+		step++
+	}
+	step -= 2
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), geoStep))
+}
+
+// geoMatch is a member found by GEOSEARCH.
+type geoMatch struct {
+	member   string
+	score    float64
+	dist     float64
+	lon, lat float64
+}
+
+// geosearch implements GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude
+// latitude BYRADIUS radius M|KM|FT|MI|BYBOX width height M|KM|FT|MI
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH],
+// replying with the members of the sorted set at key within the shape
+// around the center. With ANY the search stops at the first count matches
+// found, otherwise the nearest count are kept. WITHDIST, WITHHASH and
+// WITHCOORD turn each member into an array adding its distance, score and
+// coordinates.
+func geosearch(c *Client, v *Value, rg *RedisGo) *Value {
+	var (
+		shape                          geoShape
+		fromMember                     string
+		hasMember, hasLonLat, hasShape bool
+		unit                           float64
+		order                          int // order is 1 for ASC, -1 for DESC, 0 for unsorted
+		count                          int64
+		anyMatch                       bool
+		withCoord, withDist, withHash  bool
+	)
+	args := bulkArgs(v.Array[2:])
+	for i := 0; i < len(args); i++ {
+		n := len(args) - i - 1 // n counts the arguments after args[i]
+		var errv *Value
+		switch arg := strings.ToUpper(args[i]); {
+		case arg == "FROMMEMBER" && n >= 1 && !hasMember:
+			fromMember, hasMember = args[i+1], true
+			i++
+		case arg == "FROMLONLAT" && n >= 2 && !hasLonLat:
+			if shape.lon, shape.lat, errv = parseLonLat(args[i+1], args[i+2]); errv != nil {
+				return errv
+			}
+			hasLonLat = true
+			i += 2
+		case arg == "BYRADIUS" && n >= 2 && !hasShape:
+			radius, err := parseFloat(args[i+1])
+			if err != nil {
+				return newError("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return newError("ERR radius cannot be negative")
+			}
+			if unit, errv = parseGeoUnit(args[i+2]); errv != nil {
+				return errv
+			}
+			shape.radius, hasShape = radius*unit, true
+			i += 2
+		case arg == "BYBOX" && n >= 3 && !hasShape:
+			width, err1 := parseFloat(args[i+1])
+			height, err2 := parseFloat(args[i+2])
+			if err1 != nil || err2 != nil {
+				return newError("ERR need numeric width and height")
+			}
+			if width < 0 || height < 0 {
+				return newError("ERR height or width cannot be negative")
+			}
+			if unit, errv = parseGeoUnit(args[i+3]); errv != nil {
+				return errv
+			}
+			shape.width, shape.height = width*unit, height*unit
+			shape.byBox, hasShape = true, true
+			i += 3
+		case arg == "ASC":
+			order = 1
+		case arg == "DESC":
+			order = -1
+		case arg == "COUNT" && n >= 1:
+			var err error
+			if count, err = strconv.ParseInt(args[i+1], 10, 64); err != nil {
+				return newError(errNotInt)
+			}
+			if count <= 0 {
+				return newError("ERR COUNT must be > 0")
+			}
+			i++
+			if i+1 < len(args) && strings.EqualFold(args[i+1], "ANY") {
+				anyMatch = true
+				i++
+			}
+		case arg == "WITHCOORD":
+			withCoord = true
+		case arg == "WITHDIST":
+			withDist = true
+		case arg == "WITHHASH":
+			withHash = true
+		case arg == "FROMMEMBER" || arg == "FROMLONLAT":
+			if n > 0 {
+				return newError("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			return newError(errSyntax)
+		case arg == "BYRADIUS" || arg == "BYBOX":
+			if n > 0 {
+				return newError("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			return newError(errSyntax)
+		default:
+			return newError(errSyntax)
+		}
+	}
+	switch {
+	case hasMember == hasLonLat:
+		return newError("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	case !hasShape:
+		return newError("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	if count > 0 && !anyMatch && order == 0 {
+		// The nearest matches are kept, so they must be sorted anyway.
+		order = 1
+	}
+
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newArray([]Value{})
+	}
+	if hasMember {
+		score, ok := item.ZSet.Score(fromMember)
+		if !ok {
+			return newError("ERR could not decode requested zset member")
+		}
+		shape.lon, shape.lat = decodeGeoScore(score)
+	}
+
+	var matches []geoMatch
+search:
+	for _, cell := range shape.cells() {
+		shift := 2 * (geoStep - cell.step)
+		r := ScoreRange{
+			Min:   float64(cell.bits << shift),
+			Max:   float64((cell.bits + 1) << shift),
+			MaxEx: true,
+		}
+		for _, e := range item.ZSet.RangeByScore(r, 0, -1) {
+			lon, lat := decodeGeoScore(e.Score)
+			dist, ok := shape.distanceTo(lon, lat)
+			if !ok {
+				continue
+			}
+			matches = append(matches, geoMatch{e.Member, e.Score, dist, lon, lat})
+			if anyMatch && int64(len(matches)) == count {
+				break search
+			}
+		}
+	}
+	if order != 0 {
+		slices.SortStableFunc(matches, func(a, b geoMatch) int {
+			return order * cmp.Compare(a.dist, b.dist)
+		})
+	}
+	if count > 0 && int64(len(matches)) > count {
+		matches = matches[:count]
+	}
+
+	vals := make([]Value, len(matches))
+	for i, m := range matches {
+		if !withDist && !withHash && !withCoord {
+			vals[i] = Value{Type: Bulk, Bulk: m.member}
+			continue
+		}
+		fields := []Value{{Type: Bulk, Bulk: m.member}}
+		if withDist {
+			fields = append(fields, Value{Type: Bulk, Bulk: formatDistance(m.dist, unit)})
+		}
+		if withHash {
+			fields = append(fields, Value{Type: Integer, Int: int64(m.score)})
+		}
+		if withCoord {
+			fields = append(fields, geoCoordValue(m.lon, m.lat))
+		}
+		vals[i] = Value{Type: Array, Array: fields}
+	}
+	return newArray(vals)
+}
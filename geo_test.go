@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestGeoDistBetweenCities(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "geoadd", "sicily",
+		"13.361389", "38.115556", "Palermo",
+		"15.087269", "37.502669", "Catania")
+	tests := []struct {
+		unit string
+		want float64
+	}{
+		// Redis replies with these for the example of its documentation.
+		{"m", 166274.1516},
+		{"km", 166.2742},
+		{"mi", 103.3182},
+		{"ft", 545518.8700},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, "geodist", "sicily", "Palermo", "Catania", tt.unit)
+		if reply.Type != Bulk {
+			t.Fatalf("GEODIST in %s = %v", tt.unit, reply)
+		}
+		got, err := strconv.ParseFloat(reply.Bulk, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got-tt.want) > tt.want*1e-6 {
+			t.Errorf("GEODIST in %s = %v, want %v", tt.unit, got, tt.want)
+		}
+	}
+	if reply := do(rg, c, "geodist", "sicily", "Palermo", "Rome"); reply.Type != Null {
+		t.Errorf("GEODIST to a missing member = %v, want nil", reply)
+	}
+}
+
+func TestGeoSearchByRadius(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "geoadd", "sicily",
+		"13.361389", "38.115556", "Palermo",
+		"15.087269", "37.502669", "Catania",
+		"12.758489", "38.788135", "edge1",
+		"17.241510", "38.788135", "edge2")
+	tests := []struct {
+		radius string
+		want   []string
+	}{
+		{"100", []string{"Catania"}},
+		{"200", []string{"Catania", "Palermo"}},
+		{"300", []string{"Catania", "Palermo", "edge2", "edge1"}},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, "geosearch", "sicily", "fromlonlat", "15", "37", "byradius", tt.radius, "km", "asc")
+		var got []string
+		for _, m := range reply.Array {
+			got = append(got, m.Bulk)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GEOSEARCH within %s km = %v, want %v", tt.radius, got, tt.want)
+		}
+	}
+}
+
+func TestGeoAddRejectsInvalidCoordinates(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	for _, lonlat := range [][2]string{{"181", "0"}, {"0", "86"}, {"-181", "0"}, {"0", "-85.06"}} {
+		if reply := do(rg, c, "geoadd", "k", lonlat[0], lonlat[1], "m"); reply.Type != Error {
+			t.Errorf("GEOADD at %v = %v, want an error", lonlat, reply)
+		}
+	}
+}
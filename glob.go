@@ -0,0 +1,122 @@
+package main
+
+// globMatch reports whether str matches the Redis-style glob pattern. The
+// pattern supports:
+//   - * matching any sequence of bytes, including none
+//   - ? matching any single byte
+//   - [abc] matching one of the listed bytes, [^abc] any byte not listed and
+//     [a-z] a byte range
+//   - \ escaping the next byte so it matches literally
+//
+// Matching is byte-wise, so it is safe for binary keys. It is shared by KEYS,
+// SCAN's MATCH option and pattern subscriptions.
+func globMatch(pattern, str string) bool {
+	p, s := 0, 0
+	// starP and starS remember the last * seen and the position in str it is
+	// currently assumed to match up to, to backtrack on a mismatch.
+	starP, starS := -1, 0
+
+	for s < len(str) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// Collapse consecutive stars.
+				for p < len(pattern) && pattern[p] == '*' {
+					p++
+				}
+				if p == len(pattern) {
+					return true
+				}
+				starP, starS = p, s
+				continue
+			case '?':
+				p++
+				s++
+				continue
+			case '[':
+				if end, ok := matchClass(pattern, p, str[s]); end > p {
+					if ok {
+						p = end
+						s++
+						continue
+					}
+					break
+				}
+				// An unterminated class matches a literal [.
+				if str[s] == '[' {
+					p++
+					s++
+					continue
+				}
+			case '\\':
+				if p+1 < len(pattern) {
+					if pattern[p+1] == str[s] {
+						p += 2
+						s++
+						continue
+					}
+					break
+				}
+				if str[s] == '\\' {
+					p++
+					s++
+					continue
+				}
+			default:
+				if pattern[p] == str[s] {
+					p++
+					s++
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		// Let the last star swallow one more byte and retry.
+		starS++
+		p, s = starP, starS
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// matchClass matches b against the character class starting at pattern[p],
+// which must be '['. It returns the index just past the closing ']' and
+// whether b is in the class. If the class is unterminated it returns p.
+func matchClass(pattern string, p int, b byte) (int, bool) {
+	i := p + 1
+	negate := i < len(pattern) && pattern[i] == '^'
+	if negate {
+		i++
+	}
+	var match bool
+	for ; i < len(pattern) && pattern[i] != ']'; i++ {
+		switch {
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == b {
+				match = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if b >= lo && b <= hi {
+				match = true
+			}
+			i += 2
+		default:
+			if pattern[i] == b {
+				match = true
+			}
+		}
+	}
+	if i >= len(pattern) {
+		return p, false
+	}
+	return i + 1, match != negate
+}
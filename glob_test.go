@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		want         bool
+	}{
+		// Literals, * and ?.
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*", "a", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b*", "xxbxxaxx", false},
+		{"a**b", "ab", true},
+		{"a*b*c", "abcbc", true},
+		{"?", "a", true},
+		{"?", "", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"user:*:name", "user:42:name", true},
+
+		// Character classes.
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"[a-c]", "b", true},
+		{"[a-c]", "d", false},
+		{"[a-c0-9]", "7", true},
+		{"[abc-]", "-", true},
+		{"[a-]", "-", true},
+		{"[]", "]", false},
+
+		// Reversed ranges match like their reversal.
+		{"[z-a]", "m", true},
+		{"[9-0]", "5", true},
+		{"[c-a]", "d", false},
+
+		// Negation.
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"[^a-c]", "d", true},
+		{"[^a-c]", "b", false},
+		{"[^]", "a", true},
+
+		// An unterminated class matches a literal [.
+		{"[abc", "[abc", true},
+		{"[abc", "a", false},
+		{"a[", "a[", true},
+		{"a[", "a", false},
+		{"[^", "[^", true},
+
+		// Escaped metacharacters match literally.
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`\[a]`, "[a]", true},
+		{`\[a]`, "a", false},
+		{`a\\b`, `a\b`, true},
+		{`[\]]`, "]", true},
+		{`[\^a]`, "^", true},
+		{`[a\-z]`, "-", true},
+		{`[a\-z]`, "m", false},
+		{`\x`, "x", true},
+
+		// A \ ending the pattern matches a literal \.
+		{`a\`, `a\`, true},
+		{`a\`, "a", false},
+		{`a\`, "ab", false},
+
+		// Matching is byte-wise.
+		{"\x00*\xff", "\x00abc\xff", true},
+		{"[\x80-\xff]", "\xc3", true},
+		{"?", "\xc3\xa9", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.str); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.str, got, tt.want)
+		}
+	}
+}
+
+func TestMatchClass(t *testing.T) {
+	tests := []struct {
+		pattern string
+		b       byte
+		end     int
+		match   bool
+	}{
+		{"[abc]", 'b', 5, true},
+		{"[abc]x", 'd', 5, false},
+		{"[^abc]", 'd', 6, true},
+		{"[a-z]", 'q', 5, true},
+		{"[z-a]", 'q', 5, true},
+		{`[\]]`, ']', 4, true},
+		{"[abc", 'a', 0, false},
+		{`[a\`, 'a', 0, false},
+	}
+	for _, tt := range tests {
+		end, match := matchClass(tt.pattern, 0, tt.b)
+		if end != tt.end || match != tt.match {
+			t.Errorf("matchClass(%q, %q) = %d, %v, want %d, %v", tt.pattern, tt.b, end, match, tt.end, tt.match)
+		}
+	}
+}
@@ -1 +1,3 @@
 module redisgo
+
+go 1.27.1
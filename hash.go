@@ -0,0 +1,323 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+func init() {
+	register(
+		&Command{name: "hset", handler: hset, arity: -4, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "hget", handler: hget, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "hdel", handler: hdel, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "hgetall", handler: hgetAll, arity: 2, keys: oneKey},
+		&Command{name: "hkeys", handler: hkeys, arity: 2, keys: oneKey},
+		&Command{name: "hvals", handler: hvals, arity: 2, keys: oneKey},
+		&Command{name: "hlen", handler: hlen, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "hexists", handler: hexists, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "hmget", handler: hmget, arity: -3, keys: oneKey, fast: true},
+		&Command{name: "hincrby", handler: hincrBy, arity: 4, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "hincrbyfloat", handler: hincrByFloat, arity: 4, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+	)
+}
+
+// hsetField sets field to val in the hash item stored at key, keeping the
+// memory usage of db up to date. It reports whether field is new. The caller
+// must hold the shard of the item for writing.
+func hsetField(db *RedisDb, item *Item, field, val string) bool {
+	old, exists := item.Hash[field]
+	if exists {
+		db.subMem(fieldMemUsage(field, old))
+	}
+	item.Hash[field] = val
+	db.memUsed.Add(fieldMemUsage(field, val))
+	return !exists
+}
+
+// hset implements HSET key field value [field value ...], replying with the
+// number of fields that were added rather than updated.
+func hset(c *Client, v *Value, rg *RedisGo) *Value {
+	if len(v.Array)%2 != 0 {
+		return newError("ERR wrong number of arguments for 'hset' command")
+	}
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		item = &Item{Kind: KindHash, Hash: make(map[string]string)}
+		db.put(key, item)
+	}
+	var added int64
+	for i := 2; i < len(v.Array); i += 2 {
+		if hsetField(db, item, v.Array[i].Bulk, v.Array[i+1].Bulk) {
+			added++
+		}
+	}
+	db.notify(notifyHash, "hset", key)
+	return newInteger(added)
+}
+
+// hget implements HGET key field.
+func hget(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	val, ok := item.Hash[v.Array[2].Bulk]
+	if !ok {
+		return newNull()
+	}
+	return newBulk(val)
+}
+
+// hdel implements HDEL key field [field ...], replying with the number of
+// fields removed. A hash left empty is deleted.
+func hdel(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	var removed int64
+	for _, arg := range v.Array[2:] {
+		val, ok := item.Hash[arg.Bulk]
+		if !ok {
+			continue
+		}
+		db.subMem(fieldMemUsage(arg.Bulk, val))
+		delete(item.Hash, arg.Bulk)
+		removed++
+	}
+	if removed > 0 {
+		db.notify(notifyHash, "hdel", key)
+	}
+	if len(item.Hash) == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return newInteger(removed)
+}
+
+// hgetAll implements HGETALL key, replying with a flat array of field-value
+// pairs in no particular order.
+func hgetAll(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newMap([]Value{})
+	}
+	vals := make([]Value, 0, 2*len(item.Hash))
+	for field, val := range item.Hash {
+		vals = append(vals, Value{Type: Bulk, Bulk: field}, Value{Type: Bulk, Bulk: val})
+	}
+	return newMap(vals)
+}
+
+// hkeys implements HKEYS key.
+func hkeys(c *Client, v *Value, rg *RedisGo) *Value {
+	return hashListGeneric(c, v, rg, func(field, _ string) string { return field })
+}
+
+// hvals implements HVALS key.
+func hvals(c *Client, v *Value, rg *RedisGo) *Value {
+	return hashListGeneric(c, v, rg, func(_, val string) string { return val })
+}
+
+// hashListGeneric replies with an array holding pick(field, value) for every
+// field of the hash at key, in no particular order. A missing key yields an
+// empty array.
+func hashListGeneric(c *Client, v *Value, rg *RedisGo, pick func(field, val string) string) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newArray([]Value{})
+	}
+	vals := make([]Value, 0, len(item.Hash))
+	for field, val := range item.Hash {
+		vals = append(vals, Value{Type: Bulk, Bulk: pick(field, val)})
+	}
+	return newArray(vals)
+}
+
+// hlen implements HLEN key.
+func hlen(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(len(item.Hash)))
+}
+
+// hexists implements HEXISTS key field.
+func hexists(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	if _, ok := item.Hash[v.Array[2].Bulk]; !ok {
+		return newInteger(0)
+	}
+	return newInteger(1)
+}
+
+// hmget implements HMGET key field [field ...], replying with the values in
+// argument order and Null for missing fields.
+func hmget(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	vals := make([]Value, len(v.Array)-2)
+	for i, arg := range v.Array[2:] {
+		val, ok := "", false
+		if item != nil {
+			val, ok = item.Hash[arg.Bulk]
+		}
+		if !ok {
+			vals[i] = Value{Type: Null}
+			continue
+		}
+		vals[i] = Value{Type: Bulk, Bulk: val}
+	}
+	return newArray(vals)
+}
+
+// lookupOrCreateHash returns the hash stored at key, creating an empty one if
+// the key is missing. The caller must hold the key's shard for writing.
+func lookupOrCreateHash(db *RedisDb, key string) (*Item, *Value) {
+	item, errv := db.getTyped(key, KindHash)
+	if errv != nil {
+		return nil, errv
+	}
+	if item == nil {
+		item = &Item{Kind: KindHash, Hash: make(map[string]string)}
+		db.put(key, item)
+	}
+	return item, nil
+}
+
+// hincrBy implements HINCRBY key field increment, treating a missing field as
+// 0 and replying with the new value.
+func hincrBy(c *Client, v *Value, rg *RedisGo) *Value {
+	key, field := v.Array[1].Bulk, v.Array[2].Bulk
+	delta, err := strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindHash)
+	if errv != nil {
+		return errv
+	}
+	var curr int64
+	if item != nil {
+		if val, ok := item.Hash[field]; ok {
+			if curr, err = strconv.ParseInt(val, 10, 64); err != nil {
+				return newError("ERR hash value is not an integer")
+			}
+		}
+	}
+	if (delta > 0 && curr > math.MaxInt64-delta) || (delta < 0 && curr < math.MinInt64-delta) {
+		return newError("ERR increment or decrement would overflow")
+	}
+	curr += delta
+
+	if item == nil {
+		item, _ = lookupOrCreateHash(db, key)
+	}
+	hsetField(db, item, field, strconv.FormatInt(curr, 10))
+	db.notify(notifyHash, "hincrby", key)
+	return newInteger(curr)
+}
+
+// hincrByFloat implements HINCRBYFLOAT key field increment, treating a missing
+// field as 0 and replying with the new value as a bulk string.
+func hincrByFloat(c *Client, v *Value, rg *RedisGo) *Value {
+	key, field := v.Array[1].Bulk, v.Array[2].Bulk
+	delta, err := parseFloat(v.Array[3].Bulk)
+	if err != nil {
+		return newError(errNotFloat)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindHash)
+	if errv != nil {
+		return errv
+	}
+	var curr float64
+	if item != nil {
+		if val, ok := item.Hash[field]; ok {
+			if curr, err = parseFloat(val); err != nil {
+				return newError("ERR hash value is not a float")
+			}
+		}
+	}
+	curr += delta
+	if math.IsNaN(curr) || math.IsInf(curr, 0) {
+		return newError("ERR increment would produce NaN or Infinity")
+	}
+	if item == nil {
+		item, _ = lookupOrCreateHash(db, key)
+	}
+	val := formatFloat(curr)
+	hsetField(db, item, field, val)
+	db.notify(notifyHash, "hincrbyfloat", key)
+	return newBulk(val)
+}
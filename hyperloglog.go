@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "pfadd", handler: pfadd, arity: -2, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "pfcount", handler: pfcount, arity: -2, keys: allKeys},
+		&Command{name: "pfmerge", handler: pfmerge, arity: -2, keys: allKeys, isWrite: true, denyOOM: true},
+	)
+}
+
+// HyperLogLogs are strings laid out as in Redis, so that they can be moved
+// between the two with DUMP and RESTORE or RDB files: a 16 byte header,
+// "HYLL", the encoding, three unused bytes and the cached cardinality, then
+// the registers. hllRegisters registers of hllBits bits each estimate the
+// cardinality with a standard error of 0.81%.
+const (
+	hllP         = 14
+	hllQ         = 64 - hllP
+	hllRegisters = 1 << hllP
+	hllBits      = 6
+	hllMaxReg    = 1<<hllBits - 1
+
+	hllHeaderLen = 16
+	hllDenseLen  = hllHeaderLen + (hllRegisters*hllBits+7)/8
+
+	// The dense encoding packs every register, the sparse encoding
+	// run-length encodes them. Strings are always written dense, sparse ones
+	// written by Redis are read too.
+	hllDense  = 0
+	hllSparse = 1
+
+	// hllAlphaInf is the bias correction of the estimator for an infinite
+	// number of registers.
+	hllAlphaInf = 0.721347520444481703680
+
+	errNotHLL     = "WRONGTYPE Key is not a valid HyperLogLog string value."
+	errCorruptHLL = "INVALIDOBJ Corrupted HLL object detected"
+)
+
+// hll holds the registers of a HyperLogLog, one byte each.
+type hll [hllRegisters]uint8
+
+// murmurHash64A is the 64-bit MurmurHash2 of data, as used by Redis to hash
+// HyperLogLog elements.
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(data))*m
+	for ; len(data) >= 8; data = data[8:] {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * i)
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// add updates the register elem hashes to, reporting whether it changed.
+// The low hllP bits of the hash select the register, which keeps the
+// longest run of trailing zeros seen in the remaining bits, plus one.
+func (h *hll) add(elem string) bool {
+	hash := murmurHash64A([]byte(elem), 0xadc83b19)
+	index := hash & (hllRegisters - 1)
+	count := uint8(bits.TrailingZeros64(hash>>hllP|1<<hllQ) + 1)
+	if count <= h[index] {
+		return false
+	}
+	h[index] = count
+	return true
+}
+
+// merge sets each register to the greater of its value and that in o.
+func (h *hll) merge(o *hll) {
+	for i, reg := range o {
+		h[i] = max(h[i], reg)
+	}
+}
+
+// count estimates the number of distinct elements added, with the estimator
+// from Otmar Ertl's "New cardinality estimation algorithms for HyperLogLog
+// sketches", as Redis does.
+func (h *hll) count() uint64 {
+	var histo [64]int
+	for _, reg := range h {
+		histo[reg]++
+	}
+	const m = float64(hllRegisters)
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// hllSigma is the sigma function of the estimator, correcting for the
+// registers still at zero.
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if z == prev {
+			return z
+		}
+	}
+}
+
+// hllTau is the tau function of the estimator, correcting for the registers
+// at their greatest value.
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if z == prev {
+			return z / 3
+		}
+	}
+}
+
+// isHLL reports whether str starts like a HyperLogLog string.
+func isHLL(str string) bool {
+	return len(str) >= hllHeaderLen && strings.HasPrefix(str, "HYLL")
+}
+
+// decodeHLL reads the registers of the HyperLogLog string str.
+func decodeHLL(str string) (*hll, *Value) {
+	if !isHLL(str) {
+		return nil, newError(errNotHLL)
+	}
+	h := new(hll)
+	payload := str[hllHeaderLen:]
+	switch str[4] {
+	case hllDense:
+		if len(str) != hllDenseLen {
+			return nil, newError(errNotHLL)
+		}
+		for i := range h {
+			bit := i * hllBits
+			b0 := uint16(payload[bit/8])
+			var b1 uint16
+			if bit/8+1 < len(payload) {
+				b1 = uint16(payload[bit/8+1])
+			}
+			h[i] = uint8((b0|b1<<8)>>(bit%8)) & hllMaxReg
+		}
+	case hllSparse:
+		// Opcodes are ZERO (00xxxxxx) for a run of up to 64 zero registers,
+		// XZERO (01xxxxxx yyyyyyyy) for up to 16384, and VAL (1vvvvvxx) for
+		// up to 4 registers of value 1 to 32.
+		i := 0
+		for p := 0; p < len(payload); p++ {
+			op := payload[p]
+			var run int
+			var val uint8
+			switch {
+			case op&0xc0 == 0x00:
+				run = int(op&0x3f) + 1
+			case op&0xc0 == 0x40:
+				if p+1 >= len(payload) {
+					return nil, newError(errCorruptHLL)
+				}
+				run = int(op&0x3f)<<8 | int(payload[p+1]) + 1
+				p++
+			default:
+				run = int(op&0x03) + 1
+				val = (op>>2)&0x1f + 1
+			}
+			if i+run > hllRegisters {
+				return nil, newError(errCorruptHLL)
+			}
+			for ; run > 0; run-- {
+				h[i] = val
+				i++
+			}
+		}
+		if i != hllRegisters {
+			return nil, newError(errCorruptHLL)
+		}
+	default:
+		return nil, newError(errNotHLL)
+	}
+	return h, nil
+}
+
+// encode returns the dense HyperLogLog string holding the registers, with
+// the cached cardinality marked stale.
+func (h *hll) encode() string {
+	buf := make([]byte, hllDenseLen+1)
+	copy(buf, "HYLL")
+	buf[4] = hllDense
+	buf[15] = 1 << 7
+	payload := buf[hllHeaderLen:]
+	for i, reg := range h {
+		bit := i * hllBits
+		word := uint16(reg) << (bit % 8)
+		payload[bit/8] |= byte(word)
+		payload[bit/8+1] |= byte(word >> 8)
+	}
+	return string(buf[:hllDenseLen])
+}
+
+// cachedCount returns the cardinality cached in the header of the
+// HyperLogLog string str, reporting false if it is stale.
+func cachedCount(str string) (uint64, bool) {
+	card := binary.LittleEndian.Uint64([]byte(str[8:hllHeaderLen]))
+	return card, card&(1<<63) == 0
+}
+
+// pfadd implements PFADD key [element ...], adding the elements to the
+// HyperLogLog at key, created if missing. It replies with 1 if a register
+// changed, and so possibly the estimated cardinality, or the key was
+// created, 0 otherwise.
+func pfadd(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	h := new(hll)
+	changed := old == nil
+	if old != nil {
+		if h, errv = decodeHLL(old.Value); errv != nil {
+			return errv
+		}
+	}
+	for _, elem := range v.Array[2:] {
+		if h.add(elem.Bulk) {
+			changed = true
+		}
+	}
+	if !changed {
+		return newInteger(0)
+	}
+	item := &Item{Value: h.encode()}
+	if old != nil {
+		item.Expiration = old.Expiration
+	}
+	db.put(key, item)
+	db.notify(notifyString, "pfadd", key)
+	return newInteger(1)
+}
+
+// pfcount implements PFCOUNT key [key ...], replying with the estimated
+// cardinality of the union of the HyperLogLogs at the keys. Missing keys
+// count as empty. The cardinality cached in a single HyperLogLog is used
+// while it is fresh; as this server never stores a fresh one, it only helps
+// with strings written by Redis.
+func pfcount(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(bulkArgs(v.Array[1:])...)
+	defer unlock()
+
+	union := new(hll)
+	for _, key := range bulkArgs(v.Array[1:]) {
+		item, errv := db.peekTyped(key, KindString)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		// The string is validated before its cached cardinality is
+		// trusted, which a plain string starting with HYLL would fake.
+		h, errv := decodeHLL(item.Value)
+		if errv != nil {
+			return errv
+		}
+		if len(v.Array) == 2 {
+			if card, ok := cachedCount(item.Value); ok {
+				return newInteger(int64(card))
+			}
+		}
+		union.merge(h)
+	}
+	return newInteger(int64(union.count()))
+}
+
+// pfmerge implements PFMERGE destkey [sourcekey ...], storing at destkey a
+// HyperLogLog of the union of those at destkey and the source keys.
+func pfmerge(c *Client, v *Value, rg *RedisGo) *Value {
+	dest := v.Array[1].Bulk
+	db := rg.db(c)
+	unlock := db.lockKeys(bulkArgs(v.Array[1:])...)
+	defer unlock()
+
+	union := new(hll)
+	var old *Item
+	for i, key := range bulkArgs(v.Array[1:]) {
+		item, errv := db.getTyped(key, KindString)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		h, errv := decodeHLL(item.Value)
+		if errv != nil {
+			return errv
+		}
+		union.merge(h)
+		if i == 0 {
+			old = item
+		}
+	}
+	item := &Item{Value: union.encode()}
+	if old != nil {
+		item.Expiration = old.Expiration
+	}
+	db.put(dest, item)
+	db.notify(notifyString, "pfadd", dest)
+	return newOK()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestPFCountErrorBound(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	added := 0
+	for _, n := range []int{10, 100, 1000, 10000, 100000, 500000} {
+		for added < n {
+			args := []string{"pfadd", "h"}
+			for ; added < n && len(args) < 1002; added++ {
+				args = append(args, "elem:"+strconv.Itoa(added))
+			}
+			do(rg, c, args...)
+		}
+		reply := do(rg, c, "pfcount", "h")
+		if reply.Type != Integer {
+			t.Fatalf("PFCOUNT = %v", reply)
+		}
+		// The standard error is 0.81%, so 3% is beyond any reasonable
+		// deviation.
+		if rel := math.Abs(float64(reply.Int)-float64(n)) / float64(n); rel > 0.03 {
+			t.Errorf("PFCOUNT of %d elements = %d, off by %.2f%%", n, reply.Int, rel*100)
+		}
+	}
+}
+
+func TestPFAddRepeatedElements(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	if reply := do(rg, c, "pfadd", "h", "a", "b", "c"); reply.Int != 1 {
+		t.Errorf("PFADD of new elements = %v, want 1", reply)
+	}
+	if reply := do(rg, c, "pfadd", "h", "a", "b"); reply.Int != 0 {
+		t.Errorf("PFADD of elements already added = %v, want 0", reply)
+	}
+	if reply := do(rg, c, "pfcount", "h"); reply.Int != 3 {
+		t.Errorf("PFCOUNT = %v, want 3", reply)
+	}
+	do(rg, c, "pfadd", "h2", "c", "d")
+	if reply := do(rg, c, "pfcount", "h", "h2", "missing"); reply.Int != 4 {
+		t.Errorf("PFCOUNT of the union = %v, want 4", reply)
+	}
+}
+
+func TestPFCountRejectsFakeHLL(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "h", "HYLLxxxxxxxxxxxx")
+	for _, args := range [][]string{{"pfcount", "h"}, {"pfadd", "h", "a"}} {
+		if reply := do(rg, c, args...); reply.Type != Error || reply.Err != errNotHLL {
+			t.Errorf("%q = %v, want %q", args, reply, errNotHLL)
+		}
+	}
+}
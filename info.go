@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "info", handler: info, arity: -1},
+	)
+}
+
+// redisVersion is the Redis version the server reports itself compatible with.
+const redisVersion = "7.2.0"
+
+// infoSection is a named block of INFO output.
+type infoSection struct {
+	name   string
+	fields func(rg *RedisGo) [][2]string
+
+	// extra leaves the section out of INFO and INFO default, so that it is
+	// only included when asked for by name or with all or everything.
+	extra bool
+}
+
+// infoSections lists the INFO sections in output order.
+var infoSections = []infoSection{
+	{name: "Server", fields: (*RedisGo).serverInfo},
+	{name: "Clients", fields: (*RedisGo).clientsInfo},
+	{name: "Memory", fields: (*RedisGo).memoryInfo},
+	{name: "Persistence", fields: (*RedisGo).persistenceInfo},
+	{name: "Stats", fields: (*RedisGo).statsInfo},
+	{name: "Replication", fields: (*RedisGo).replicationInfo},
+	{name: "Commandstats", fields: (*RedisGo).commandStatsInfo, extra: true},
+	{name: "Keyspace", fields: (*RedisGo).keyspaceInfo},
+}
+
+// info implements INFO [section ...], replying with the requested sections in
+// the Redis text format. Without arguments, or with default, every section
+// but the extra ones is included; all and everything include them too.
+func info(c *Client, v *Value, rg *RedisGo) *Value {
+	want := make(map[string]bool)
+	for _, arg := range v.Array[1:] {
+		want[strings.ToLower(arg.Bulk)] = true
+	}
+	all := want["all"] || want["everything"]
+	defaults := len(want) == 0 || want["default"]
+
+	var sb strings.Builder
+	for _, section := range infoSections {
+		if !all && !(defaults && !section.extra) && !want[strings.ToLower(section.name)] {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\r\n")
+		}
+		fmt.Fprintf(&sb, "# %s\r\n", section.name)
+		for _, field := range section.fields(rg) {
+			fmt.Fprintf(&sb, "%s:%s\r\n", field[0], field[1])
+		}
+	}
+	return newBulk(sb.String())
+}
+
+// memUsed returns the approximate memory usage across all databases.
+func (rg *RedisGo) memUsed() uint64 {
+	var total uint64
+	for _, db := range rg.dbs {
+		total += db.MemUsed()
+	}
+	return total
+}
+
+// humanBytes formats n bytes the way INFO's *_human fields do, e.g. 1.50M.
+func humanBytes(n uint64) string {
+	const unit = 1024
+	switch {
+	case n < unit:
+		return fmt.Sprintf("%dB", n)
+	case n < unit*unit:
+		return fmt.Sprintf("%.2fK", float64(n)/unit)
+	case n < unit*unit*unit:
+		return fmt.Sprintf("%.2fM", float64(n)/(unit*unit))
+	default:
+		return fmt.Sprintf("%.2fG", float64(n)/(unit*unit*unit))
+	}
+}
+
+// serverInfo returns the fields of the Server section.
+func (rg *RedisGo) serverInfo() [][2]string {
+	uptime := time.Since(rg.startedAt)
+	return [][2]string{
+		{"redis_version", redisVersion},
+		{"redis_mode", "standalone"},
+		{"os", runtime.GOOS},
+		{"arch_bits", strconv.Itoa(strconv.IntSize)},
+		{"go_version", runtime.Version()},
+		{"process_id", strconv.Itoa(os.Getpid())},
+		{"tcp_port", strconv.Itoa(rg.conf.port)},
+		{"uptime_in_seconds", strconv.FormatInt(int64(uptime/time.Second), 10)},
+		{"uptime_in_days", strconv.FormatInt(int64(uptime/(24*time.Hour)), 10)},
+		{"hz", strconv.Itoa(rg.conf.hz)},
+		{"config_file", rg.conf.configFP},
+	}
+}
+
+// clientsInfo returns the fields of the Clients section.
+func (rg *RedisGo) clientsInfo() [][2]string {
+	rg.clientsMu.Lock()
+	count := rg.clientCount
+	rg.clientsMu.Unlock()
+
+	return [][2]string{
+		{"connected_clients", strconv.Itoa(count)},
+		{"maxclients", strconv.Itoa(rg.conf.maxClientsLimit())},
+		{"blocked_clients", strconv.FormatInt(rg.blockedClients.Load(), 10)},
+	}
+}
+
+// memoryInfo returns the fields of the Memory section.
+func (rg *RedisGo) memoryInfo() [][2]string {
+	used := rg.memUsed()
+
+	rg.conf.mu.RLock()
+	maxmem, policy := rg.conf.maxmem, rg.conf.eviction
+	rg.conf.mu.RUnlock()
+
+	return [][2]string{
+		{"used_memory", strconv.FormatUint(used, 10)},
+		{"used_memory_human", humanBytes(used)},
+		{"used_memory_peak", strconv.FormatUint(rg.peakMem.Load(), 10)},
+		{"used_memory_peak_human", humanBytes(rg.peakMem.Load())},
+		{"maxmemory", strconv.FormatUint(maxmem, 10)},
+		{"maxmemory_human", humanBytes(maxmem)},
+		{"maxmemory_policy", string(policy)},
+	}
+}
+
+// persistenceInfo returns the fields of the Persistence section.
+func (rg *RedisGo) persistenceInfo() [][2]string {
+	fields := [][2]string{
+		{"rdb_changes_since_last_save", strconv.FormatInt(rg.dirty.Load(), 10)},
+		{"rdb_bgsave_in_progress", boolInfo(rg.inRdbSnapshot.Load())},
+		{"rdb_last_save_time", strconv.FormatInt(rg.rbdState.lastSaveTs.Load(), 10)},
+		{"rdb_saves", strconv.FormatInt(rg.rbdState.saves.Load(), 10)},
+		{"aof_enabled", boolInfo(rg.conf.aofEnabled)},
+		{"aof_rewrite_in_progress", boolInfo(rg.inCompaction.Load())},
+		{"aof_rewrites", strconv.FormatInt(rg.aofStats.rewrites.Load(), 10)},
+	}
+	if rg.aof != nil {
+		size, _ := rg.aof.Size()
+		fields = append(fields,
+			[2]string{"aof_current_size", strconv.FormatInt(size, 10)},
+			[2]string{"aof_base_size", strconv.FormatInt(rg.aofStats.baseSize.Load(), 10)},
+		)
+	}
+	return fields
+}
+
+// statsInfo returns the fields of the Stats section.
+func (rg *RedisGo) statsInfo() [][2]string {
+	return [][2]string{
+		{"total_connections_received", strconv.FormatInt(rg.genStats.totalConnections.Load(), 10)},
+		{"total_commands_processed", strconv.FormatInt(rg.genStats.totalCommands.Load(), 10)},
+		{"expired_keys", strconv.FormatInt(rg.genStats.expiredKeys.Load(), 10)},
+		{"evicted_keys", strconv.FormatInt(rg.genStats.evictedKeys.Load(), 10)},
+		{"rejected_connections", strconv.FormatInt(rg.genStats.rejectedConns.Load(), 10)},
+	}
+}
+
+// replicationInfo returns the fields of the Replication section.
+func (rg *RedisGo) replicationInfo() [][2]string {
+	var fields [][2]string
+	if m := rg.master.Load(); m != nil {
+		state := m.getState()
+		link := "down"
+		if state == "connected" {
+			link = "up"
+		}
+		fields = append(fields,
+			[2]string{"role", "slave"},
+			[2]string{"master_host", m.host},
+			[2]string{"master_port", strconv.Itoa(m.port)},
+			[2]string{"master_link_status", link},
+			[2]string{"master_sync_in_progress", boolInfo(state == "sync")},
+			[2]string{"slave_repl_offset", strconv.FormatInt(m.offset.Load(), 10)},
+		)
+	} else {
+		fields = append(fields, [2]string{"role", "master"})
+	}
+	replicas := rg.replicas()
+	fields = append(fields, [2]string{"connected_slaves", strconv.Itoa(len(replicas))})
+	for i, r := range replicas {
+		state, lag := "wait_bgsave", int64(0)
+		if r.online {
+			state, lag = "online", int64(time.Since(r.ackAt)/time.Second)
+		}
+		fields = append(fields, [2]string{fmt.Sprintf("slave%d", i),
+			fmt.Sprintf("ip=%s,port=%d,state=%s,offset=%d,lag=%d", r.ip, r.port, state, r.ack, lag)})
+	}
+	return append(fields,
+		[2]string{"master_replid", rg.repl.id},
+		[2]string{"master_repl_offset", strconv.FormatInt(rg.replOffset(), 10)},
+	)
+}
+
+// commandStatsInfo returns the fields of the Commandstats section, one per
+// command called or rejected since the stats were last reset, sorted by name.
+func (rg *RedisGo) commandStatsInfo() [][2]string {
+	fields := make([][2]string, 0)
+	for name, stats := range rg.cmdStats {
+		calls, rejected, failed := stats.calls.Load(), stats.rejected.Load(), stats.failed.Load()
+		if calls == 0 && rejected == 0 {
+			continue
+		}
+		usec := stats.duration.Load() / int64(time.Microsecond)
+		var perCall float64
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		fields = append(fields, [2]string{"cmdstat_" + name,
+			fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+				calls, usec, perCall, rejected, failed)})
+	}
+	slices.SortFunc(fields, func(a, b [2]string) int {
+		return strings.Compare(a[0], b[0])
+	})
+	return fields
+}
+
+// keyspaceInfo returns the fields of the Keyspace section, one per non-empty
+// database.
+func (rg *RedisGo) keyspaceInfo() [][2]string {
+	fields := make([][2]string, 0)
+	for i, db := range rg.dbs {
+		keys, expires := db.Size(), db.Expires()
+		if keys == 0 {
+			continue
+		}
+		fields = append(fields, [2]string{"db" + strconv.Itoa(i), fmt.Sprintf("keys=%d,expires=%d", keys, expires)})
+	}
+	return fields
+}
+
+// boolInfo formats b as INFO does, 1 or 0.
+func boolInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
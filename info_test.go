@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// infoField returns the value of field in the INFO reply info.
+func infoField(info, field string) string {
+	for _, line := range strings.Split(info, "\r\n") {
+		if value, ok := strings.CutPrefix(line, field+":"); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+func TestInfoCommandStats(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	for range 5 {
+		do(rg, c, "set", "k", "v")
+	}
+	do(rg, c, "set", "k")
+	do(rg, c, "incr", "k")
+
+	info := do(rg, c, "info", "commandstats").Bulk
+	set := infoField(info, "cmdstat_set")
+	if !strings.HasPrefix(set, "calls=5,") || !strings.HasSuffix(set, ",rejected_calls=1,failed_calls=0") {
+		t.Errorf("cmdstat_set:%s, want 5 calls and 1 rejected", set)
+	}
+	if incr := infoField(info, "cmdstat_incr"); !strings.HasPrefix(incr, "calls=1,") || !strings.HasSuffix(incr, ",failed_calls=1") {
+		t.Errorf("cmdstat_incr:%s, want 1 failed call", incr)
+	}
+	if get := infoField(info, "cmdstat_get"); get != "" {
+		t.Errorf("cmdstat_get:%s for a command never called", get)
+	}
+
+	do(rg, c, "config", "resetstat")
+	info = do(rg, c, "info", "commandstats").Bulk
+	if set := infoField(info, "cmdstat_set"); set != "" {
+		t.Errorf("cmdstat_set:%s after CONFIG RESETSTAT", set)
+	}
+}
@@ -1,6 +1,11 @@
 package main
 
 import (
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,49 +15,434 @@ import (
 // when serializing/deserializing to Unix timestamps.
 const unixTSEpoch int64 = -62135596800
 
+// ItemKind identifies the data type held by an Item. The zero value is
+// KindString so that plain string items need no explicit kind.
+type ItemKind uint8
+
+const (
+	KindString ItemKind = iota
+	KindList
+	KindHash
+	KindSet
+	KindZSet
+	KindStream
+)
+
+// String returns the type name of k as reported by the TYPE command.
+func (k ItemKind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindList:
+		return "list"
+	case KindHash:
+		return "hash"
+	case KindSet:
+		return "set"
+	case KindZSet:
+		return "zset"
+	case KindStream:
+		return "stream"
+	default:
+		return "unknown"
+	}
+}
+
 // Item represents a value stored in the database along with its metadata.
 // All fields are exported to support gob encoding for RDB persistence.
 type Item struct {
-	// Expiration is the expiry time for this item. If Exp.Unix() == unixTSEpoch,
-	// the item has no expiry set and will never expire passively.
+	// Expiration is the expiry time for this item. If Expiration.Unix() equals
+	// unixTSEpoch, the item has no expiry set and will never expire passively.
 	Expiration time.Time
 
-	// Value is the string value stored for this key.
+	// Kind is the data type of the item and determines which of the payload
+	// fields below is in use.
+	Kind ItemKind
+
+	// Value is the string value stored for this key, used by KindString.
 	Value string
 
-	// AccessCount counts how many times this item has been read.
-	// Used by the LFU eviction policy to determine least frequently used keys.
-	AccessCount int
+	// List holds the elements of a KindList item, head first.
+	List []string
+
+	// Hash holds the field-value pairs of a KindHash item.
+	Hash map[string]string
+
+	// Set holds the members of a KindSet item.
+	Set map[string]struct{}
+
+	// ZSet holds the members and scores of a KindZSet item.
+	ZSet *SortedSet
+
+	// Stream holds the entries of a KindStream item.
+	Stream *Stream
+
+	// AccessCount counts how many times this item has been read, halved for
+	// every lfu-decay-time period since DecayedAt so that keys which were hot
+	// once eventually become evictable. Used by the LFU eviction policy to
+	// determine least frequently used keys. Updated atomically so reads only
+	// need the db's read lock.
+	AccessCount int64
+
+	// DecayedAt records, as Unix nanoseconds, the time up to which decay has
+	// been applied to AccessCount.
+	DecayedAt int64
+
+	// LastAccessed records the last time this item was read as Unix nanoseconds.
+	// Used by the LRU eviction policy to determine least recently used keys, and
+	// persisted with the item so idle times survive a restart. Updated
+	// atomically so reads only need the db's read lock.
+	LastAccessed int64
+}
+
+// touch records an access of the item for LRU/LFU tracking. It is safe to call
+// concurrently, e.g. from readers holding only the db's read lock.
+func (i *Item) touch() {
+	atomic.AddInt64(&i.AccessCount, 1)
+	atomic.StoreInt64(&i.LastAccessed, time.Now().UnixNano())
+}
 
-	// LastUsedAt records the last time this item was read.
-	// Used by the LRU eviction policy to determine least recently used keys.
-	LastUsedAt time.Time
+// accessCount returns the number of recorded accesses of the item.
+func (i *Item) accessCount() int64 {
+	return atomic.LoadInt64(&i.AccessCount)
+}
+
+// frequency returns the access count of the item after applying any decay due
+// since it was last decayed, halving the count once per full period. Decay is
+// applied lazily when the count is read rather than on a timer; a period of 0
+// disables it. frequency is safe to call concurrently.
+func (i *Item) frequency(period time.Duration) int64 {
+	if period <= 0 {
+		return i.accessCount()
+	}
+	now := time.Now().UnixNano()
+	for {
+		last := atomic.LoadInt64(&i.DecayedAt)
+		periods := (now - last) / int64(period)
+		if periods <= 0 {
+			break
+		}
+		// Whoever advances DecayedAt owns this round of decay.
+		if !atomic.CompareAndSwapInt64(&i.DecayedAt, last, last+periods*int64(period)) {
+			continue
+		}
+		for {
+			count := atomic.LoadInt64(&i.AccessCount)
+			if atomic.CompareAndSwapInt64(&i.AccessCount, count, count>>min(periods, 63)) {
+				break
+			}
+		}
+		break
+	}
+	return i.accessCount()
+}
+
+// lastAccessed returns the time of the last recorded access of the item.
+func (i *Item) lastAccessed() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&i.LastAccessed))
+}
+
+// hasExpiry reports whether this item has an expiry set.
+func (i *Item) hasExpiry() bool {
+	return i.Expiration.Unix() != unixTSEpoch
 }
 
 // hasExpired reports whether this item has an expiry set and that expiry has
-// passed. An item with no expiry set (Exp.Unix() == unixTSEpoch) never expires.
+// passed. An item with no expiry set (Expiration.Unix() == unixTSEpoch) never
+// expires.
 func (i *Item) hasExpired() bool {
-	return i.Expiration.Unix() != unixTSEpoch && time.Until(i.Expiration) <= 0
+	return i.hasExpiry() && time.Until(i.Expiration) <= 0
+}
+
+// clone returns a deep copy of the item's value and expiry, sharing no memory
+// with the original so that either can be mutated independently. Access
+// tracking starts afresh on the copy.
+func (i *Item) clone() *Item {
+	cp := &Item{
+		Kind:       i.Kind,
+		Expiration: i.Expiration,
+		Value:      i.Value,
+		List:       slices.Clone(i.List),
+		Hash:       maps.Clone(i.Hash),
+		Set:        maps.Clone(i.Set),
+	}
+	if i.ZSet != nil {
+		cp.ZSet = &SortedSet{
+			Scores:  maps.Clone(i.ZSet.Scores),
+			Entries: slices.Clone(i.ZSet.Entries),
+		}
+	}
+	if i.Stream != nil {
+		cp.Stream = &Stream{
+			Entries: slices.Clone(i.Stream.Entries),
+			LastID:  i.Stream.LastID,
+		}
+	}
+	return cp
 }
 
+// elements returns the number of elements of a collection item, or 1 for a
+// string.
+func (i *Item) elements() int {
+	switch i.Kind {
+	case KindList:
+		return len(i.List)
+	case KindHash:
+		return len(i.Hash)
+	case KindSet:
+		return len(i.Set)
+	case KindZSet:
+		return i.ZSet.Len()
+	case KindStream:
+		return i.Stream.Len()
+	default:
+		return 1
+	}
+}
+
+// free drops the payload of an item that was removed from its database, so
+// that freeing a large collection can be left to another goroutine.
+func (i *Item) free() {
+	clear(i.List)
+	clear(i.Hash)
+	clear(i.Set)
+	if i.ZSet != nil {
+		clear(i.ZSet.Scores)
+		clear(i.ZSet.Entries)
+	}
+	if i.Stream != nil {
+		clear(i.Stream.Entries)
+	}
+}
+
+// Thresholds under which Redis keeps small values in their compact encodings,
+// used to report plausible encodings through OBJECT ENCODING.
+const (
+	embstrMaxLen     = 44
+	listpackMaxLen   = 128
+	listpackMaxValue = 64
+	intsetMaxLen     = 512
+)
+
+// encoding returns the name of the internal encoding Redis would use for the
+// item, as reported by OBJECT ENCODING.
+func (i *Item) encoding() string {
+	switch i.Kind {
+	case KindList:
+		if fitsListpack(len(i.List), i.List) {
+			return "listpack"
+		}
+		return "quicklist"
+	case KindHash:
+		fields := make([]string, 0, 2*len(i.Hash))
+		for field, val := range i.Hash {
+			fields = append(fields, field, val)
+		}
+		if fitsListpack(len(i.Hash), fields) {
+			return "listpack"
+		}
+		return "hashtable"
+	case KindSet:
+		members := make([]string, 0, len(i.Set))
+		for member := range i.Set {
+			members = append(members, member)
+		}
+		if len(members) <= intsetMaxLen && allInts(members) {
+			return "intset"
+		}
+		if fitsListpack(len(members), members) {
+			return "listpack"
+		}
+		return "hashtable"
+	case KindZSet:
+		members := make([]string, 0, i.ZSet.Len())
+		for _, entry := range i.ZSet.Entries {
+			members = append(members, entry.Member)
+		}
+		if fitsListpack(len(members), members) {
+			return "listpack"
+		}
+		return "skiplist"
+	case KindStream:
+		return "stream"
+	default:
+		if _, ok := intEncodable(i.Value); ok {
+			return "int"
+		}
+		if len(i.Value) <= embstrMaxLen {
+			return "embstr"
+		}
+		return "raw"
+	}
+}
+
+// fitsListpack reports whether a collection of n entries with the given
+// values is small enough for the listpack encoding.
+func fitsListpack(n int, vals []string) bool {
+	if n > listpackMaxLen {
+		return false
+	}
+	for _, val := range vals {
+		if len(val) > listpackMaxValue {
+			return false
+		}
+	}
+	return true
+}
+
+// allInts reports whether every value of vals is int encodable.
+func allInts(vals []string) bool {
+	for _, val := range vals {
+		if _, ok := intEncodable(val); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// intEncodable reports whether val is the canonical decimal form of a 64-bit
+// integer, without sign or leading zeros that wouldn't survive a round trip,
+// which Redis stores with the int encoding. It returns the integer.
+func intEncodable(val string) (int64, bool) {
+	if len(val) == 0 || len(val) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(val, 10, 64)
+	return n, err == nil && strconv.FormatInt(n, 10) == val
+}
+
+// sharedIntegers is the number of small integers, from 0, whose string values
+// all share a single copy, like Redis's shared integer objects.
+const sharedIntegers = 10000
+
+// sharedInts holds the shared string values of the integers below
+// sharedIntegers.
+var sharedInts = func() []string {
+	ints := make([]string, sharedIntegers)
+	for i := range ints {
+		ints[i] = strconv.Itoa(i)
+	}
+	return ints
+}()
+
+// sharedInt returns the shared copy of val if it is a small integer.
+func sharedInt(val string) (string, bool) {
+	if n, ok := intEncodable(val); ok && n >= 0 && n < sharedIntegers {
+		return sharedInts[n], true
+	}
+	return val, false
+}
+
+// shareValue makes a string item holding a small integer use the shared copy
+// of its value, releasing its own.
+func (i *Item) shareValue() {
+	if i.Kind == KindString {
+		i.Value, _ = sharedInt(i.Value)
+	}
+}
+
+// isShared reports whether the value of the item is a shared integer. Every
+// string item is stored through RedisDb.put, which shares such values.
+func (i *Item) isShared() bool {
+	if i.Kind != KindString {
+		return false
+	}
+	_, ok := sharedInt(i.Value)
+	return ok
+}
+
+// refCount returns the reference count Redis would report for the value of
+// the item: shared integers are never freed and report the largest count.
+func (i *Item) refCount() int64 {
+	if i.isShared() {
+		return math.MaxInt32
+	}
+	return 1
+}
+
+// Approximate sizes of Go runtime structures, used for memory accounting.
+// These estimates are based on Go runtime internals and could change in future
+// go versions.
+const (
+	stringHeader = 16 // pointer + length
+	sliceHeader  = 24 // pointer + length + capacity
+	timeSize     = 24
+	mapEntry     = 32
+)
+
 // approxMemUsage returns an approximate memory usage in bytes for this item,
-// including its key. These estimates are based on
-// Go runtime internals (could change in future go versions):
-//   - string header (pointer + length): 16 bytes
-//   - time.Time: 24 bytes
-//   - map entry overhead: ~32 bytes
+// including its key and the elements of a collection payload.
 //
 // Used by the eviction policy to track total memory usage. Precision is not
 // required since eviction decisions tolerate some inaccuracy.
 func (i *Item) approxMemUsage(key string) uint64 {
-	var total int
-	const (
-		stringHeader = 16
-		timeSize     = 24
-		mapEntry     = 32
-	)
+	var total uint64
 	total += timeSize + mapEntry
-	total += stringHeader + len(key)
-	total += stringHeader + len(i.Value)
-	return uint64(total)
+	total += stringHeader + uint64(len(key))
+	total += stringHeader
+	if !i.isShared() {
+		total += uint64(len(i.Value))
+	}
+
+	switch i.Kind {
+	case KindList:
+		total += sliceHeader
+		for _, elem := range i.List {
+			total += elemMemUsage(elem)
+		}
+	case KindHash:
+		for field, val := range i.Hash {
+			total += fieldMemUsage(field, val)
+		}
+	case KindSet:
+		for member := range i.Set {
+			total += memberMemUsage(member)
+		}
+	case KindZSet:
+		for _, entry := range i.ZSet.Entries {
+			total += zmemberMemUsage(entry.Member)
+		}
+	case KindStream:
+		for _, entry := range i.Stream.Entries {
+			total += streamEntryMemUsage(entry)
+		}
+	}
+	return total
+}
+
+// elemMemUsage returns the approximate memory usage of a single collection
+// element. Handlers mutating a collection in place use it to adjust the
+// database's memory usage by the same amount approxMemUsage accounts for.
+func elemMemUsage(elem string) uint64 {
+	return stringHeader + uint64(len(elem))
+}
+
+// fieldMemUsage returns the approximate memory usage of a single field-value
+// pair of a hash, including its map entry.
+func fieldMemUsage(field, val string) uint64 {
+	return mapEntry + elemMemUsage(field) + elemMemUsage(val)
+}
+
+// memberMemUsage returns the approximate memory usage of a single member of a
+// set, including its map entry.
+func memberMemUsage(member string) uint64 {
+	return mapEntry + elemMemUsage(member)
+}
+
+// zmemberMemUsage returns the approximate memory usage of a single member of a
+// sorted set, counting both its map entry and its entry in the ordered view.
+func zmemberMemUsage(member string) uint64 {
+	const float = 8
+	return mapEntry + elemMemUsage(member) + float + stringHeader + float
+}
+
+// streamEntryMemUsage returns the approximate memory usage of a single entry
+// of a stream, counting its ID and its fields.
+func streamEntryMemUsage(entry StreamEntry) uint64 {
+	const id = 16
+	total := uint64(id + sliceHeader)
+	for _, field := range entry.Fields {
+		total += elemMemUsage(field)
+	}
+	return total
 }
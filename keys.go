@@ -0,0 +1,310 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "del", handler: del, arity: -2, keys: allKeys, isWrite: true},
+		&Command{name: "unlink", handler: unlink, arity: -2, keys: allKeys, isWrite: true, fast: true},
+		&Command{name: "touch", handler: touch, arity: -2, keys: allKeys, fast: true},
+		&Command{name: "exists", handler: exists, arity: -2, keys: allKeys, fast: true},
+		&Command{name: "object", handler: object, arity: -2, keys: keySpec{2, 2, 1}, help: objectHelp},
+		&Command{name: "keys", handler: keys, arity: 2},
+		&Command{name: "copy", handler: copyCmd, arity: -3, keys: keySpec{1, 2, 1}, isWrite: true, denyOOM: true},
+		&Command{name: "select", handler: selectCmd, arity: 2, fast: true},
+		&Command{name: "move", handler: move, arity: 3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "swapdb", handler: swapDb, arity: 3, isWrite: true},
+		&Command{name: "dbsize", handler: dbSize, arity: 1, fast: true},
+		&Command{name: "randomkey", handler: randomKey, arity: 1},
+		&Command{name: "flushdb", handler: flushDb, arity: -1, isWrite: true},
+		&Command{name: "flushall", handler: flushAll, arity: -1, isWrite: true},
+	)
+}
+
+// objectHelp is the reply to OBJECT HELP.
+var objectHelp = []string{
+	"ENCODING <key>",
+	"    Return the kind of internal representation used in order to store the value",
+	"    associated with a <key>.",
+	"FREQ <key>",
+	"    Return the access frequency index of the <key>. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the <key>, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    <key>.",
+}
+
+// del implements DEL key [key ...], replying with the number of keys removed.
+func del(c *Client, v *Value, rg *RedisGo) *Value {
+	var n int64
+	for _, arg := range v.Array[1:] {
+		if rg.db(c).Delete(arg.Bulk) {
+			n++
+		}
+	}
+	return newInteger(n)
+}
+
+// unlink implements UNLINK key [key ...], replying with the number of keys
+// removed. Unlike DEL, large values are freed in the background.
+func unlink(c *Client, v *Value, rg *RedisGo) *Value {
+	var n int64
+	for _, arg := range v.Array[1:] {
+		if rg.db(c).Unlink(arg.Bulk) {
+			n++
+		}
+	}
+	return newInteger(n)
+}
+
+// touch implements TOUCH key [key ...], recording an access of every given key
+// that exists and replying with their number.
+func touch(c *Client, v *Value, rg *RedisGo) *Value {
+	var n int64
+	for _, arg := range v.Array[1:] {
+		if _, ok := rg.db(c).Get(arg.Bulk); ok {
+			n++
+		}
+	}
+	return newInteger(n)
+}
+
+// exists implements EXISTS key [key ...], replying with the number of given
+// keys that exist. A key repeated in the arguments is counted every time.
+func exists(c *Client, v *Value, rg *RedisGo) *Value {
+	var n int64
+	for _, arg := range v.Array[1:] {
+		if rg.db(c).Exists(arg.Bulk) {
+			n++
+		}
+	}
+	return newInteger(n)
+}
+
+// object implements OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key, exposing internals of
+// the value stored at key for debugging.
+func object(c *Client, v *Value, rg *RedisGo) *Value {
+	sub := strings.ToUpper(v.Array[1].Bulk)
+	if len(v.Array) != 3 {
+		return unknownSubcommand("object", v.Array[1].Bulk)
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[2].Bulk)
+	defer unlock()
+
+	item := db.peek(v.Array[2].Bulk)
+	if item == nil {
+		return newError("ERR no such key")
+	}
+	switch sub {
+	case "ENCODING":
+		return newBulk(item.encoding())
+	case "IDLETIME":
+		return newInteger(int64(time.Since(item.lastAccessed()) / time.Second))
+	case "FREQ":
+		return newInteger(item.frequency(rg.conf.lfuDecayPeriod()))
+	case "REFCOUNT":
+		return newInteger(item.refCount())
+	default:
+		return unknownSubcommand("object", v.Array[1].Bulk)
+	}
+}
+
+// keys implements KEYS pattern.
+func keys(c *Client, v *Value, rg *RedisGo) *Value {
+	return newArray(bulkValues(rg.db(c).Keys(v.Array[1].Bulk)))
+}
+
+// copyCmd implements COPY source destination [DB index] [REPLACE], replying 1
+// if the value was copied and 0 if the source is missing or the destination
+// exists without REPLACE.
+func copyCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	src, dest := v.Array[1].Bulk, v.Array[2].Bulk
+
+	var replace bool
+	destIdx := c.dbIndex
+	args := v.Array[3:]
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return newError(errSyntax)
+			}
+			i++
+			idx, errv := rg.parseDbIndex(args[i].Bulk)
+			if errv != nil {
+				return errv
+			}
+			destIdx = idx
+		default:
+			return newError(errSyntax)
+		}
+	}
+	if src == dest && destIdx == c.dbIndex {
+		return newError("ERR source and destination objects are the same")
+	}
+	srcDb, destDb := rg.db(c), rg.dbs[destIdx]
+	unlock := lockDbs(srcDb, destDb)
+	defer unlock()
+
+	item := srcDb.lookup(src)
+	if item == nil {
+		return newInteger(0)
+	}
+	if destDb.lookup(dest) != nil && !replace {
+		return newInteger(0)
+	}
+	destDb.put(dest, item.clone())
+	destDb.notify(notifyGeneric, "copy_to", dest)
+	return newInteger(1)
+}
+
+// lockDbs write-locks the whole of both databases, which may be the same one,
+// in index order so that concurrent commands spanning two databases can't
+// deadlock. It returns a func releasing the locks.
+func lockDbs(a, b *RedisDb) func() {
+	if a == b {
+		a.rwm.Lock()
+		return a.rwm.Unlock
+	}
+	if a.id > b.id {
+		a, b = b, a
+	}
+	a.rwm.Lock()
+	b.rwm.Lock()
+	return func() {
+		b.rwm.Unlock()
+		a.rwm.Unlock()
+	}
+}
+
+// parseDbIndex parses a logical database index, validating its range.
+func (rg *RedisGo) parseDbIndex(arg string) (int, *Value) {
+	idx, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, newError(errNotInt)
+	}
+	if idx < 0 || idx >= len(rg.dbs) {
+		return 0, newError("ERR DB index is out of range")
+	}
+	return idx, nil
+}
+
+// selectCmd implements SELECT index, switching the database the client's
+// commands operate on.
+func selectCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	idx, errv := rg.parseDbIndex(v.Array[1].Bulk)
+	if errv != nil {
+		return errv
+	}
+	rg.clientsMu.Lock()
+	c.dbIndex = idx
+	rg.clientsMu.Unlock()
+	return newOK()
+}
+
+// move implements MOVE key db, moving key with its expiry to another database
+// unless it already exists there. It replies 1 if the key was moved.
+func move(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	idx, errv := rg.parseDbIndex(v.Array[2].Bulk)
+	if errv != nil {
+		return errv
+	}
+	if idx == c.dbIndex {
+		return newError("ERR source and destination objects are the same")
+	}
+	srcDb, destDb := rg.db(c), rg.dbs[idx]
+	unlock := lockDbs(srcDb, destDb)
+	defer unlock()
+
+	item := srcDb.lookup(key)
+	if item == nil || destDb.lookup(key) != nil {
+		return newInteger(0)
+	}
+	srcDb.remove(key)
+	destDb.put(key, item)
+	srcDb.notify(notifyGeneric, "move_from", key)
+	destDb.notify(notifyGeneric, "move_to", key)
+	return newInteger(1)
+}
+
+// swapDb implements SWAPDB index1 index2, exchanging the contents of the two
+// databases so that clients connected to one see the data of the other.
+func swapDb(c *Client, v *Value, rg *RedisGo) *Value {
+	i, errv := rg.parseDbIndex(v.Array[1].Bulk)
+	if errv != nil {
+		return newError("ERR invalid first DB index")
+	}
+	j, errv := rg.parseDbIndex(v.Array[2].Bulk)
+	if errv != nil {
+		return newError("ERR invalid second DB index")
+	}
+	rg.dbs[i].swap(rg.dbs[j])
+	return newOK()
+}
+
+// randomKey implements RANDOMKEY, replying with a random key of the database
+// or a null if it is empty.
+func randomKey(c *Client, v *Value, rg *RedisGo) *Value {
+	key, ok := rg.db(c).RandomKey()
+	if !ok {
+		return newNull()
+	}
+	return newBulk(key)
+}
+
+// dbSize implements DBSIZE.
+func dbSize(c *Client, v *Value, rg *RedisGo) *Value {
+	return newInteger(int64(rg.db(c).Size()))
+}
+
+// parseFlushMode parses the optional ASYNC|SYNC argument of the flush
+// commands, reporting whether the flush should be asynchronous.
+func parseFlushMode(v *Value) (bool, *Value) {
+	switch {
+	case len(v.Array) == 1:
+		return false, nil
+	case len(v.Array) > 2:
+		return false, newError(errSyntax)
+	}
+	switch strings.ToUpper(v.Array[1].Bulk) {
+	case "ASYNC":
+		return true, nil
+	case "SYNC":
+		return false, nil
+	default:
+		return false, newError(errSyntax)
+	}
+}
+
+// flushDb implements FLUSHDB [ASYNC|SYNC].
+func flushDb(c *Client, v *Value, rg *RedisGo) *Value {
+	async, errv := parseFlushMode(v)
+	if errv != nil {
+		return errv
+	}
+	rg.db(c).Flush(async)
+	return newOK()
+}
+
+// flushAll implements FLUSHALL [ASYNC|SYNC].
+func flushAll(c *Client, v *Value, rg *RedisGo) *Value {
+	async, errv := parseFlushMode(v)
+	if errv != nil {
+		return errv
+	}
+	for _, db := range rg.dbs {
+		db.Flush(async)
+	}
+	return newOK()
+}
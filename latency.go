@@ -0,0 +1,145 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "latency", handler: latency, arity: -2, help: latencyHelp},
+	)
+}
+
+// latencyHelp is the reply to LATENCY HELP.
+var latencyHelp = []string{
+	"HISTORY <event>",
+	"    Return time-latency samples for the <event> class.",
+	"LATEST",
+	"    Return the latest latency samples for all events.",
+	"RESET [<event> ...]",
+	"    Reset latency data of one or more <event> classes.",
+	"    (default: reset all data for all event classes)",
+}
+
+// latencyHistoryLen is the number of samples kept per latency event.
+const latencyHistoryLen = 160
+
+// latencySample is the latency of an event, in milliseconds, as of a Unix
+// time in seconds. Samples taken within the same second are merged, keeping
+// the highest latency.
+type latencySample struct {
+	at      int64
+	latency int64
+}
+
+// latencyEvent holds the latencyHistoryLen most recent samples of an event,
+// oldest first, and the highest latency it ever had.
+type latencyEvent struct {
+	samples []latencySample
+	max     int64
+}
+
+// latencyMonitor records, per event, the pauses that lasted at least
+// latency-monitor-threshold: slow commands, the dataset copies that start a
+// background save or AOF rewrite, AOF rewrite completion and active expiry
+// cycles.
+type latencyMonitor struct {
+	mu     sync.Mutex
+	events map[string]*latencyEvent
+}
+
+// add records a latency of ms milliseconds for the event named event.
+func (m *latencyMonitor) add(event string, ms int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.events == nil {
+		m.events = make(map[string]*latencyEvent)
+	}
+	e := m.events[event]
+	if e == nil {
+		e = &latencyEvent{}
+		m.events[event] = e
+	}
+	e.max = max(e.max, ms)
+
+	now := time.Now().Unix()
+	if n := len(e.samples); n > 0 && e.samples[n-1].at == now {
+		e.samples[n-1].latency = max(e.samples[n-1].latency, ms)
+		return
+	}
+	e.samples = append(e.samples, latencySample{at: now, latency: ms})
+	if len(e.samples) > latencyHistoryLen {
+		e.samples = slices.Delete(e.samples, 0, len(e.samples)-latencyHistoryLen)
+	}
+}
+
+// sampleLatency records that the event named event took d, if latency
+// monitoring is enabled and d is at least latency-monitor-threshold.
+func (rg *RedisGo) sampleLatency(event string, d time.Duration) {
+	threshold := rg.conf.latencyThreshold()
+	if threshold == 0 || d < threshold {
+		return
+	}
+	rg.latency.add(event, d.Milliseconds())
+}
+
+// latency implements LATENCY LATEST, LATENCY HISTORY event and
+// LATENCY RESET [event ...]. LATEST replies with the name, time and latency
+// of the latest sample and the highest latency of every event, HISTORY with
+// the time and latency of each sample of event, and RESET with the number of
+// events whose samples it discarded.
+func latency(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[2:])
+	m := &rg.latency
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "LATEST" && len(args) == 0:
+		names := make([]string, 0, len(m.events))
+		for name := range m.events {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		vals := make([]Value, len(names))
+		for i, name := range names {
+			e := m.events[name]
+			last := e.samples[len(e.samples)-1]
+			vals[i] = *newArray([]Value{
+				{Type: Bulk, Bulk: name},
+				*newInteger(last.at),
+				*newInteger(last.latency),
+				*newInteger(e.max),
+			})
+		}
+		return newArray(vals)
+	case sub == "HISTORY" && len(args) == 1:
+		vals := make([]Value, 0)
+		if e := m.events[args[0]]; e != nil {
+			for _, s := range e.samples {
+				vals = append(vals, *newArray([]Value{*newInteger(s.at), *newInteger(s.latency)}))
+			}
+		}
+		return newArray(vals)
+	case sub == "RESET":
+		if len(args) == 0 {
+			n := len(m.events)
+			m.events = nil
+			return newInteger(int64(n))
+		}
+		var n int64
+		for _, name := range args {
+			if _, ok := m.events[name]; ok {
+				delete(m.events, name)
+				n++
+			}
+		}
+		return newInteger(n)
+	default:
+		return unknownSubcommand("latency", v.Array[1].Bulk)
+	}
+}
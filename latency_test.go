@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLatencyLatestExpireCycle(t *testing.T) {
+	rg := newTestServer(t, "latency-monitor-threshold 1")
+	rg.activeExpireOff.Store(true)
+	c := NewClient(1, nil)
+	// Enough expired keys to keep a cycle busy for its whole time budget,
+	// a quarter of the 100ms tick.
+	for i := range 50000 {
+		do(rg, c, "set", "k"+strconv.Itoa(i), "v", "px", "1")
+	}
+	time.Sleep(5 * time.Millisecond)
+	rg.activeExpireCycle()
+
+	reply := do(rg, c, "latency", "latest")
+	var event []Value
+	for _, e := range reply.Array {
+		if e.Array[0].Bulk == "expire-cycle" {
+			event = e.Array
+		}
+	}
+	if event == nil {
+		t.Fatalf("LATENCY LATEST = %v, has no expire-cycle event", reply)
+	}
+	if last, peak := event[2].Int, event[3].Int; last < 1 || peak < last {
+		t.Errorf("expire-cycle latest %dms and max %dms, want at least 1ms", last, peak)
+	}
+	if at := event[1].Int; time.Since(time.Unix(at, 0)) > time.Minute {
+		t.Errorf("expire-cycle sampled at %d, not now", at)
+	}
+
+	history := do(rg, c, "latency", "history", "expire-cycle")
+	if len(history.Array) != 1 {
+		t.Errorf("LATENCY HISTORY expire-cycle = %v, want one sample", history)
+	}
+	if reply := do(rg, c, "latency", "reset", "expire-cycle"); reply.Int != 1 {
+		t.Errorf("LATENCY RESET expire-cycle = %v, want 1", reply)
+	}
+	if reply := do(rg, c, "latency", "history", "expire-cycle"); len(reply.Array) != 0 {
+		t.Errorf("LATENCY HISTORY after RESET = %v, want none", reply)
+	}
+}
+
+func TestLatencyBelowThresholdIgnored(t *testing.T) {
+	rg := newTestServer(t, "latency-monitor-threshold 1000")
+	c := NewClient(1, nil)
+	rg.activeExpireCycle()
+	do(rg, c, "debug", "sleep", "0.01")
+	if reply := do(rg, c, "latency", "latest"); len(reply.Array) != 0 {
+		t.Errorf("LATENCY LATEST = %v, want no event under the threshold", reply)
+	}
+}
@@ -0,0 +1,537 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "lpush", handler: lpush, arity: -3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "rpush", handler: rpush, arity: -3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "lpop", handler: lpop, arity: -2, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "rpop", handler: rpop, arity: -2, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "blpop", handler: blpop, arity: -3, keys: keySpec{1, -2, 1}, isWrite: true},
+		&Command{name: "brpop", handler: brpop, arity: -3, keys: keySpec{1, -2, 1}, isWrite: true},
+		&Command{name: "lmpop", handler: lmpop, arity: -4, numKeys: 1, isWrite: true},
+		&Command{name: "lrange", handler: lrange, arity: 4, keys: oneKey},
+		&Command{name: "llen", handler: llen, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "lindex", handler: lindex, arity: 3, keys: oneKey},
+		&Command{name: "lset", handler: lset, arity: 4, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "linsert", handler: linsert, arity: 5, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "lrem", handler: lrem, arity: 4, keys: oneKey, isWrite: true},
+		&Command{name: "ltrim", handler: ltrim, arity: 4, keys: oneKey, isWrite: true},
+	)
+}
+
+// lpush implements LPUSH key element [element ...].
+func lpush(c *Client, v *Value, rg *RedisGo) *Value {
+	return pushGeneric(c, v, rg, true)
+}
+
+// rpush implements RPUSH key element [element ...].
+func rpush(c *Client, v *Value, rg *RedisGo) *Value {
+	return pushGeneric(c, v, rg, false)
+}
+
+// pushGeneric inserts the elements at the head (left) or tail of the list at
+// key, creating it if needed, and replies with the new length of the list.
+func pushGeneric(c *Client, v *Value, rg *RedisGo, left bool) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		item = &Item{Kind: KindList}
+		db.put(key, item)
+	}
+	elems := make([]string, 0, len(v.Array)-2)
+	for _, arg := range v.Array[2:] {
+		elems = append(elems, arg.Bulk)
+		db.memUsed.Add(elemMemUsage(arg.Bulk))
+	}
+	if left {
+		// Each element is pushed to the head in turn, so the last argument
+		// ends up first.
+		for i, j := 0, len(elems)-1; i < j; i, j = i+1, j-1 {
+			elems[i], elems[j] = elems[j], elems[i]
+		}
+		item.List = append(elems, item.List...)
+	} else {
+		item.List = append(item.List, elems...)
+	}
+	if left {
+		db.notify(notifyList, "lpush", key)
+	} else {
+		db.notify(notifyList, "rpush", key)
+	}
+	length := len(item.List)
+	// Clients blocked on the key take the new elements right away. The
+	// reply still counts them, as the push happened before the pops.
+	if pops := db.serveBlocked(key, item); len(pops) > 0 {
+		c.propagate = append([]Value{*v}, pops...)
+	}
+	return newInteger(int64(length))
+}
+
+// lpop implements LPOP key [count].
+func lpop(c *Client, v *Value, rg *RedisGo) *Value {
+	return popGeneric(c, v, rg, true)
+}
+
+// rpop implements RPOP key [count].
+func rpop(c *Client, v *Value, rg *RedisGo) *Value {
+	return popGeneric(c, v, rg, false)
+}
+
+// popGeneric removes elements from the head (left) or tail of the list at key.
+// Without a count it replies with a single bulk, with a count with an array
+// of up to count elements. A list left empty is deleted.
+func popGeneric(c *Client, v *Value, rg *RedisGo, left bool) *Value {
+	if len(v.Array) > 3 {
+		return newError(errSyntax)
+	}
+	key := v.Array[1].Bulk
+	hasCount, count := len(v.Array) == 3, int64(1)
+	if hasCount {
+		n, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+		if err != nil || n < 0 {
+			return newError("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		if hasCount {
+			return newNullArray()
+		}
+		return newNull()
+	}
+	popped := popList(db, key, item, int(min(count, int64(len(item.List)))), left)
+	if !hasCount {
+		return newBulk(popped[0])
+	}
+	return newArray(bulkValues(popped))
+}
+
+// popList removes n elements from the head (left) or tail of the list item
+// stored at key and returns them in the order they were popped. A list left
+// empty is deleted. The caller must hold the key's shard for writing.
+func popList(db *RedisDb, key string, item *Item, n int, left bool) []string {
+	popped := make([]string, n)
+	if left {
+		copy(popped, item.List[:n])
+		item.List = item.List[n:]
+	} else {
+		// Elements popped from the tail are returned tail first.
+		for i := range popped {
+			popped[i] = item.List[len(item.List)-1-i]
+		}
+		item.List = item.List[:len(item.List)-n]
+	}
+	for _, elem := range popped {
+		db.subMem(elemMemUsage(elem))
+	}
+	if n > 0 {
+		if left {
+			db.notify(notifyList, "lpop", key)
+		} else {
+			db.notify(notifyList, "rpop", key)
+		}
+	}
+	if len(item.List) == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return popped
+}
+
+// lmpop implements LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count],
+// popping up to count elements from the first non-empty list among the keys.
+// It replies with the key and the popped elements, or a null if every list is
+// empty.
+func lmpop(c *Client, v *Value, rg *RedisGo) *Value {
+	keys, rest, errv := parseNumKeys(v.Array[1:])
+	if errv != nil {
+		return errv
+	}
+	if len(rest) == 0 {
+		return newError(errSyntax)
+	}
+	var left bool
+	switch strings.ToUpper(rest[0].Bulk) {
+	case "LEFT":
+		left = true
+	case "RIGHT":
+	default:
+		return newError(errSyntax)
+	}
+	count, errv := parseMPopCount(rest[1:])
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		item, errv := db.getTyped(key, KindList)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		popped := popList(db, key, item, int(min(count, int64(len(item.List)))), left)
+		return newArray([]Value{
+			{Type: Bulk, Bulk: key},
+			*newArray(bulkValues(popped)),
+		})
+	}
+	return newNullArray()
+}
+
+// blpop implements BLPOP key [key ...] timeout.
+func blpop(c *Client, v *Value, rg *RedisGo) *Value {
+	return blockingPopGeneric(c, v, rg, true)
+}
+
+// brpop implements BRPOP key [key ...] timeout.
+func brpop(c *Client, v *Value, rg *RedisGo) *Value {
+	return blockingPopGeneric(c, v, rg, false)
+}
+
+// blockingPopGeneric pops an element from the head (left) or tail of the
+// first non-empty list among the keys, replying with the key and the
+// element. If every list is empty the client blocks until an element is
+// pushed to one of the keys, or replies with a null array once timeout
+// seconds elapse; a timeout of 0 blocks forever. Inside a transaction the
+// command never blocks.
+func blockingPopGeneric(c *Client, v *Value, rg *RedisGo, left bool) *Value {
+	keys := bulkArgs(v.Array[1 : len(v.Array)-1])
+	secs, err := parseFloat(v.Array[len(v.Array)-1].Bulk)
+	if err != nil || math.IsInf(secs, 0) {
+		return newError("ERR timeout is not a float or out of range")
+	}
+	if secs < 0 {
+		return newError("ERR timeout is negative")
+	}
+	if secs >= math.MaxInt64/float64(time.Second) {
+		return newError("ERR timeout is out of range")
+	}
+	timeout := time.Duration(secs * float64(time.Second))
+	if secs > 0 {
+		// Don't let a tiny timeout round down to blocking forever.
+		timeout = max(timeout, time.Nanosecond)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		item, errv := db.getTyped(key, KindList)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		elem := popList(db, key, item, 1, left)[0]
+		if left {
+			c.propagateAs("lpop", key)
+		} else {
+			c.propagateAs("rpop", key)
+		}
+		return newArray([]Value{
+			{Type: Bulk, Bulk: key},
+			{Type: Bulk, Bulk: elem},
+		})
+	}
+	c.propagateNone()
+	if c.multi || rg.loading {
+		return newNullArray()
+	}
+	c.blocked = &blockedClient{
+		db:      db,
+		keys:    keys,
+		left:    left,
+		timeout: timeout,
+		reply:   make(chan *Value, 1),
+	}
+	db.block(c.blocked)
+	// serve replaces this reply once the client is unblocked.
+	return newNullArray()
+}
+
+// parseMPopCount parses the optional COUNT count trailing LMPOP and ZMPOP,
+// defaulting to 1.
+func parseMPopCount(args []Value) (int64, *Value) {
+	switch {
+	case len(args) == 0:
+		return 1, nil
+	case len(args) != 2 || !strings.EqualFold(args[0].Bulk, "COUNT"):
+		return 0, newError(errSyntax)
+	}
+	count, err := strconv.ParseInt(args[1].Bulk, 10, 64)
+	if err != nil || count <= 0 {
+		return 0, newError("ERR count should be greater than 0")
+	}
+	return count, nil
+}
+
+// lrange implements LRANGE key start stop.
+func lrange(c *Client, v *Value, rg *RedisGo) *Value {
+	start, err1 := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	stop, err2 := strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+	if err1 != nil || err2 != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newArray([]Value{})
+	}
+	from, to, ok := normRange(start, stop, len(item.List))
+	if !ok {
+		return newArray([]Value{})
+	}
+	vals := make([]Value, 0, to-from+1)
+	for _, elem := range item.List[from : to+1] {
+		vals = append(vals, Value{Type: Bulk, Bulk: elem})
+	}
+	return newArray(vals)
+}
+
+// llen implements LLEN key, replying 0 for a missing key.
+func llen(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(len(item.List)))
+}
+
+// lindex implements LINDEX key index, replying with Null if index is out of
+// range.
+func lindex(c *Client, v *Value, rg *RedisGo) *Value {
+	idx, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	if idx < 0 {
+		idx += int64(len(item.List))
+	}
+	if idx < 0 || idx >= int64(len(item.List)) {
+		return newNull()
+	}
+	return newBulk(item.List[idx])
+}
+
+// lset implements LSET key index element.
+func lset(c *Client, v *Value, rg *RedisGo) *Value {
+	key, elem := v.Array[1].Bulk, v.Array[3].Bulk
+	idx, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newError("ERR no such key")
+	}
+	if idx < 0 {
+		idx += int64(len(item.List))
+	}
+	if idx < 0 || idx >= int64(len(item.List)) {
+		return newError("ERR index out of range")
+	}
+	db.subMem(elemMemUsage(item.List[idx]))
+	db.memUsed.Add(elemMemUsage(elem))
+	item.List[idx] = elem
+	db.notify(notifyList, "lset", key)
+
+	return newOK()
+}
+
+// linsert implements LINSERT key BEFORE|AFTER pivot element, replying with the
+// new length of the list, -1 if pivot was not found or 0 if key is missing.
+func linsert(c *Client, v *Value, rg *RedisGo) *Value {
+	key, pivot, elem := v.Array[1].Bulk, v.Array[3].Bulk, v.Array[4].Bulk
+
+	var after bool
+	switch strings.ToUpper(v.Array[2].Bulk) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return newError(errSyntax)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	for i, e := range item.List {
+		if e != pivot {
+			continue
+		}
+		if after {
+			i++
+		}
+		item.List = append(item.List, "")
+		copy(item.List[i+1:], item.List[i:])
+		item.List[i] = elem
+		db.memUsed.Add(elemMemUsage(elem))
+		db.notify(notifyList, "linsert", key)
+
+		return newInteger(int64(len(item.List)))
+	}
+	return newInteger(-1)
+}
+
+// lrem implements LREM key count element. A positive count removes up to count
+// matching elements starting from the head, a negative one from the tail, and
+// zero removes them all. A list left empty is deleted.
+func lrem(c *Client, v *Value, rg *RedisGo) *Value {
+	key, elem := v.Array[1].Bulk, v.Array[3].Bulk
+	count, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	n := len(item.List)
+	keep := make([]bool, n)
+	var removed int64
+	for i := 0; i < n; i++ {
+		// Walk from the tail when count is negative.
+		idx := i
+		if count < 0 {
+			idx = n - 1 - i
+		}
+		if item.List[idx] == elem && (limit == 0 || removed < limit) {
+			removed++
+			continue
+		}
+		keep[idx] = true
+	}
+	if removed == 0 {
+		return newInteger(0)
+	}
+	list := item.List[:0]
+	for i, e := range item.List {
+		if keep[i] {
+			list = append(list, e)
+		}
+	}
+	clear(item.List[len(list):])
+	item.List = list
+	db.subMem(uint64(removed) * elemMemUsage(elem))
+	db.notify(notifyList, "lrem", key)
+
+	if len(item.List) == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return newInteger(removed)
+}
+
+// ltrim implements LTRIM key start stop, trimming the list to the inclusive
+// range. A list left empty is deleted.
+func ltrim(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	start, err1 := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	stop, err2 := strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+	if err1 != nil || err2 != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindList)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newOK()
+	}
+	db.notify(notifyList, "ltrim", key)
+	from, to, ok := normRange(start, stop, len(item.List))
+	if !ok {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+		return newOK()
+	}
+	for i, e := range item.List {
+		if i < from || i > to {
+			db.subMem(elemMemUsage(e))
+		}
+	}
+	item.List = item.List[from : to+1]
+	return newOK()
+}
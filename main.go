@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"os"
 )
@@ -12,5 +11,13 @@ func init() {
 }
 
 func main() {
-	fmt.Println("server main")
+	fpath := "./redis.conf"
+	if len(os.Args) > 1 {
+		fpath = os.Args[1]
+	}
+	conf := readConfig(fpath)
+	if err := server(conf); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("redisgo is now ready to exit, bye bye...")
 }
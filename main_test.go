@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer starts a server from a config file made of lines, with its
+// dir set to a temporary directory unless lines set one. The server is shut
+// down, and its AOF closed, when the test ends.
+func newTestServer(t testing.TB, lines ...string) *RedisGo {
+	t.Helper()
+	dir := t.TempDir()
+	for _, line := range lines {
+		if strings.HasPrefix(line, "dir ") {
+			dir = ""
+			break
+		}
+	}
+	if dir != "" {
+		lines = append([]string{"dir " + dir}, lines...)
+	}
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rg, err := NewRedisGo(readConfig(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { closeTestServer(rg) })
+	return rg
+}
+
+// closeTestServer shuts rg down and closes its AOF, so that another server
+// can load it. It may be called more than once.
+func closeTestServer(rg *RedisGo) {
+	rg.conf.shutdown()
+	if rg.aof != nil {
+		_ = rg.aof.Close()
+		rg.aof = nil
+	}
+}
+
+// do runs the command args on behalf of c and returns its reply.
+func do(rg *RedisGo, c *Client, args ...string) *Value {
+	v := newCommand(args...)
+	return rg.dispatch(c, &v)
+}
+
+// listen serves rg on a TCP listener on the loopback interface, the way the
+// server serves the connections it accepts, until the test ends. It returns
+// the address of the listener.
+func listen(t testing.TB, rg *RedisGo) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if c := rg.addClient(conn); c != nil {
+				go c.serve(rg)
+			}
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// connect returns a connection to rg over TCP.
+func connect(t testing.TB, rg *RedisGo) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", listen(t, rg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// testConn is a client connection to a test server, for tests that need the
+// network side of a command, such as blocking or replication.
+type testConn struct {
+	t    testing.TB
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial returns a testConn connected to rg.
+func dial(t testing.TB, rg *RedisGo) *testConn {
+	t.Helper()
+	conn := connect(t, rg)
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send writes the command args without waiting for its reply.
+func (tc *testConn) send(args ...string) {
+	tc.t.Helper()
+	_ = tc.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(tc.conn, respOf(newCommand(args...))); err != nil {
+		tc.t.Fatal(err)
+	}
+}
+
+// read reads a reply, failing the test if none arrives within timeout.
+func (tc *testConn) read(timeout time.Duration) Value {
+	tc.t.Helper()
+	_ = tc.conn.SetReadDeadline(time.Now().Add(timeout))
+	v, err := readReply(tc.r)
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return v
+}
+
+// do sends the command args and returns its reply.
+func (tc *testConn) do(args ...string) Value {
+	tc.t.Helper()
+	tc.send(args...)
+	return tc.read(5 * time.Second)
+}
+
+// readReply reads a RESP2 or RESP3 reply from r.
+func readReply(r *bufio.Reader) (Value, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return Value{}, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return Value{}, fmt.Errorf("empty reply line")
+	}
+	typ, rest := ValueType(line[:1]), line[1:]
+	switch typ {
+	case String, BigNumber:
+		return Value{Type: typ, Str: rest}, nil
+	case Error:
+		return Value{Type: Error, Err: rest}, nil
+	case Integer:
+		n, err := strconv.ParseInt(rest, 10, 64)
+		return Value{Type: Integer, Int: n}, err
+	case Double:
+		f, err := strconv.ParseFloat(rest, 64)
+		return Value{Type: Double, Double: f}, err
+	case Boolean:
+		return *newBool(rest == "t"), nil
+	case "_":
+		return Value{Type: Null}, nil
+	case Bulk:
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return Value{Type: Null}, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return Value{}, err
+		}
+		return Value{Type: Bulk, Bulk: string(buf[:n])}, nil
+	case Array, Map, Set, Push:
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return Value{Type: NullArray}, err
+		}
+		if typ == Map {
+			n *= 2
+		}
+		v := Value{Type: typ, Array: make([]Value, n)}
+		for i := range v.Array {
+			if v.Array[i], err = readReply(r); err != nil {
+				return Value{}, err
+			}
+		}
+		return v, nil
+	}
+	return Value{}, fmt.Errorf("unknown reply %q", line)
+}
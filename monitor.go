@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "monitor", handler: monitor, arity: 1, noMulti: true},
+	)
+}
+
+// monitor implements MONITOR, making the connection receive a line for every
+// command the server processes from then on.
+func monitor(c *Client, v *Value, rg *RedisGo) *Value {
+	if c.monitor {
+		return newOK()
+	}
+	rg.monitorsMu.Lock()
+	defer rg.monitorsMu.Unlock()
+
+	c.monitor = true
+	c.startPushLoop()
+	rg.monitors = append(rg.monitors, c)
+	return newOK()
+}
+
+// removeMonitor unregisters c if it is a monitor. removeMonitor is
+// thread-safe.
+func (rg *RedisGo) removeMonitor(c *Client) {
+	if !c.monitor {
+		return
+	}
+	rg.monitorsMu.Lock()
+	defer rg.monitorsMu.Unlock()
+
+	if i := slices.Index(rg.monitors, c); i >= 0 {
+		rg.monitors = slices.Delete(rg.monitors, i, i+1)
+	}
+}
+
+// feedMonitors sends the command v run by client c to every monitor, as a
+// line like `1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value"`.
+// Credentials given to AUTH and HELLO are redacted. feedMonitors is
+// thread-safe.
+func (rg *RedisGo) feedMonitors(c *Client, v *Value) {
+	rg.monitorsMu.RLock()
+	defer rg.monitorsMu.RUnlock()
+
+	if len(rg.monitors) == 0 {
+		return
+	}
+	now := time.Now()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, c.dbIndex, c.addr())
+
+	name := strings.ToLower(v.Array[0].Bulk)
+	for i, arg := range v.Array {
+		sb.WriteByte(' ')
+		if i > 0 && (name == "auth" || name == "hello") {
+			sb.WriteString(`"(redacted)"`)
+			continue
+		}
+		writeRepr(&sb, arg.Bulk)
+	}
+	line := *newString(sb.String())
+	for _, m := range rg.monitors {
+		m.push(line)
+	}
+}
+
+// addr returns the remote address of the client, or "" for the pseudo client
+// replaying the AOF.
+func (c *Client) addr() string {
+	if c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// writeRepr writes str to sb quoted and escaped the way Redis prints
+// arguments in MONITOR output.
+func writeRepr(sb *strings.Builder, str string) {
+	sb.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		switch b := str[i]; b {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		default:
+			if b < 0x20 || b >= 0x7f {
+				fmt.Fprintf(sb, `\x%02x`, b)
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
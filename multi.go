@@ -0,0 +1,155 @@
+package main
+
+import "strings"
+
+func init() {
+	register(
+		&Command{name: "multi", handler: multi, arity: 1, fast: true},
+		&Command{name: "exec", handler: execCmd, arity: 1},
+		&Command{name: "discard", handler: discard, arity: 1, fast: true},
+		&Command{name: "watch", handler: watch, arity: -2, keys: allKeys, fast: true},
+		&Command{name: "unwatch", handler: unwatch, arity: 1, fast: true},
+	)
+}
+
+// watchedKey is a key watched by a client along with its version at the time
+// of the WATCH.
+type watchedKey struct {
+	db      *RedisDb
+	key     string
+	version uint64
+}
+
+// controlsTx reports whether the command named name runs right away rather
+// than being queued while the client is in a transaction.
+func controlsTx(name string) bool {
+	switch name {
+	case "multi", "exec", "discard", "watch", "quit":
+		return true
+	}
+	return false
+}
+
+// failTx marks the transaction of c, if any, as failed since a command could
+// not be queued, and returns errv.
+func (c *Client) failTx(errv *Value) *Value {
+	if c.multi {
+		c.txFailed = true
+	}
+	return errv
+}
+
+// resetTx leaves the transaction and forgets the queued commands and watched
+// keys.
+func (c *Client) resetTx() {
+	c.multi = false
+	c.queued = nil
+	c.txFailed = false
+	c.unwatchAll()
+}
+
+// unwatchAll stops watching every key watched by c.
+func (c *Client) unwatchAll() {
+	for _, w := range c.watched {
+		w.db.unwatch(w.key)
+	}
+	c.watched = nil
+}
+
+// watchesTouched reports whether any key watched by c was modified since it
+// was watched.
+func (c *Client) watchesTouched() bool {
+	for _, w := range c.watched {
+		if w.db.watchVersion(w.key) != w.version {
+			return true
+		}
+	}
+	return false
+}
+
+// multi implements MULTI.
+func multi(c *Client, v *Value, rg *RedisGo) *Value {
+	if c.multi {
+		return newError("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	return newOK()
+}
+
+// execCmd implements EXEC, running the queued commands atomically and replying
+// with an array of their replies. The transaction is aborted with a null
+// array if a watched key was modified, or with an EXECABORT error if a
+// command failed to queue. Either way the watched keys are unwatched.
+func execCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	if !c.multi {
+		return newError("ERR EXEC without MULTI")
+	}
+	defer c.resetTx()
+	if c.txFailed {
+		return newError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	rg.txMu.Lock()
+	defer rg.txMu.Unlock()
+
+	if c.watchesTouched() {
+		return newNullArray()
+	}
+	// Wrap the writes in MULTI/EXEC in the AOF and the replication stream as
+	// well, so a replay or a replica applies the transaction all at once or,
+	// if the file was cut short, not at all.
+	logged := false
+	for i := range c.queued {
+		if commands[strings.ToLower(c.queued[i].Array[0].Bulk)].isWrite {
+			logged = true
+			break
+		}
+	}
+	if logged {
+		rg.propagate(c.dbIndex, newCommand("multi"))
+	}
+	replies := make([]Value, len(c.queued))
+	for i := range c.queued {
+		cmd := commands[strings.ToLower(c.queued[i].Array[0].Bulk)]
+		replies[i] = *rg.call(c, cmd, &c.queued[i])
+	}
+	if logged {
+		rg.propagate(c.dbIndex, newCommand("exec"))
+	}
+	return newArray(replies)
+}
+
+// discard implements DISCARD.
+func discard(c *Client, v *Value, rg *RedisGo) *Value {
+	if !c.multi {
+		return newError("ERR DISCARD without MULTI")
+	}
+	c.resetTx()
+	return newOK()
+}
+
+// watch implements WATCH key [key ...].
+func watch(c *Client, v *Value, rg *RedisGo) *Value {
+	if c.multi {
+		return newError("ERR WATCH inside MULTI is not allowed")
+	}
+	db := rg.db(c)
+	for _, arg := range v.Array[1:] {
+		watched := false
+		for _, w := range c.watched {
+			if w.db == db && w.key == arg.Bulk {
+				watched = true
+				break
+			}
+		}
+		if !watched {
+			c.watched = append(c.watched, watchedKey{db: db, key: arg.Bulk, version: db.watch(arg.Bulk)})
+		}
+	}
+	return newOK()
+}
+
+// unwatch implements UNWATCH.
+func unwatch(c *Client, v *Value, rg *RedisGo) *Value {
+	c.unwatchAll()
+	return newOK()
+}
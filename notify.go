@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// notifyClass is a set of keyspace event classes, as configured with
+// notify-keyspace-events. Each class is named by a single character.
+type notifyClass int
+
+const (
+	notifyKeyspace notifyClass = 1 << iota // K: publish to __keyspace@<db>__:<key>
+	notifyKeyevent                         // E: publish to __keyevent@<db>__:<event>
+	notifyGeneric                          // g: type-independent commands such as DEL and EXPIRE
+	notifyString                           // $: string commands
+	notifyList                             // l: list commands
+	notifySet                              // s: set commands
+	notifyHash                             // h: hash commands
+	notifyZSet                             // z: sorted set commands
+	notifyExpired                          // x: keys deleted as they expire
+	notifyEvicted                          // e: keys evicted under maxmemory
+	notifyStream                           // t: stream commands
+	notifyKeyMiss                          // m: lookups of missing keys
+	notifyNew                              // n: keys added to the database
+
+	// notifyAll is the A alias, every class but key misses and new keys,
+	// which are noisy and must be asked for explicitly.
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream
+)
+
+// notifyFlags maps the characters of notify-keyspace-events to the classes
+// they enable, in the order they are formatted.
+var notifyFlags = []struct {
+	flag  byte
+	class notifyClass
+}{
+	{'g', notifyGeneric},
+	{'$', notifyString},
+	{'l', notifyList},
+	{'s', notifySet},
+	{'h', notifyHash},
+	{'z', notifyZSet},
+	{'x', notifyExpired},
+	{'e', notifyEvicted},
+	{'t', notifyStream},
+	{'K', notifyKeyspace},
+	{'E', notifyKeyevent},
+	{'m', notifyKeyMiss},
+	{'n', notifyNew},
+}
+
+// parseNotifyClasses parses a notify-keyspace-events value such as "Ex" or
+// "KA". An empty value disables notifications.
+func parseNotifyClasses(str string) (notifyClass, error) {
+	var classes notifyClass
+	for i := 0; i < len(str); i++ {
+		if str[i] == 'A' {
+			classes |= notifyAll
+			continue
+		}
+		found := false
+		for _, f := range notifyFlags {
+			if f.flag == str[i] {
+				classes |= f.class
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid event class %q", str[i])
+		}
+	}
+	return classes, nil
+}
+
+// String formats classes the way CONFIG GET notify-keyspace-events reports
+// them, using the A alias when it applies.
+func (classes notifyClass) String() string {
+	var sb strings.Builder
+	if classes&notifyAll == notifyAll {
+		sb.WriteByte('A')
+		classes &^= notifyAll
+	}
+	for _, f := range notifyFlags {
+		if classes&f.class != 0 {
+			sb.WriteByte(f.flag)
+		}
+	}
+	return sb.String()
+}
+
+// notify reports the keyspace event named event of the given class on key,
+// through the onEvent hook. The caller must hold the key's shard for writing.
+func (rdb *RedisDb) notify(class notifyClass, event, key string) {
+	if rdb.onEvent != nil {
+		rdb.onEvent(class, event, key)
+	}
+}
+
+// notifyKeyspaceEvent publishes the event named event of the given class on
+// key of the database with index db, if notify-keyspace-events enables the
+// class. Depending on the configuration the event goes to the keyspace
+// channel of the key, with the event as the message, and to the keyevent
+// channel of the event, with the key as the message.
+func (rg *RedisGo) notifyKeyspaceEvent(db int, class notifyClass, event, key string) {
+	classes := rg.conf.keyspaceEvents()
+	if classes&class == 0 || classes&(notifyKeyspace|notifyKeyevent) == 0 {
+		return
+	}
+	if classes&notifyKeyspace != 0 {
+		rg.pubsub.publish("__keyspace@"+strconv.Itoa(db)+"__:"+key, event)
+	}
+	if classes&notifyKeyevent != 0 {
+		rg.pubsub.publish("__keyevent@"+strconv.Itoa(db)+"__:"+event, key)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredKeyeventNotification(t *testing.T) {
+	rg := newTestServer(t, "notify-keyspace-events Ex", "hz 100")
+	sub, writer := dial(t, rg), dial(t, rg)
+	if reply := sub.do("subscribe", "__keyevent@0__:expired"); len(reply.Array) != 3 || reply.Array[0].Bulk != "subscribe" {
+		t.Fatalf("SUBSCRIBE = %v", reply)
+	}
+
+	writer.do("set", "k", "v", "px", "20")
+	// No one reads k, so only the active expiry cycle can expire it.
+	reply := sub.read(5 * time.Second)
+	if reply.Type != Array || len(reply.Array) != 3 {
+		t.Fatalf("got %v, want a pubsub message", reply)
+	}
+	if reply.Array[0].Bulk != "message" || reply.Array[1].Bulk != "__keyevent@0__:expired" || reply.Array[2].Bulk != "k" {
+		t.Fatalf("got %v, want [message __keyevent@0__:expired k]", reply)
+	}
+	if reply := writer.do("exists", "k"); reply.Int != 0 {
+		t.Fatalf("EXISTS k after the notification = %v, want 0", reply)
+	}
+}
+
+func TestNoNotificationWhenDisabled(t *testing.T) {
+	rg := newTestServer(t, "hz 100")
+	sub, writer := dial(t, rg), dial(t, rg)
+	sub.do("psubscribe", "__key*__:*")
+
+	writer.do("set", "k", "v", "px", "20")
+	waitFor(t, "k did not expire", func() bool { return rg.dbs[0].Size() == 0 })
+	// A PING reply comes back first if nothing was published before it.
+	if reply := sub.do("ping"); reply.Type == Array && len(reply.Array) > 0 && reply.Array[0].Bulk == "pmessage" {
+		t.Fatalf("got %v with notify-keyspace-events unset", reply)
+	}
+}
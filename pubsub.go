@@ -0,0 +1,262 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+func init() {
+	register(
+		&Command{name: "subscribe", handler: subscribe, arity: -2, noMulti: true},
+		&Command{name: "unsubscribe", handler: unsubscribe, arity: -1, noMulti: true},
+		&Command{name: "psubscribe", handler: psubscribe, arity: -2, noMulti: true},
+		&Command{name: "punsubscribe", handler: punsubscribe, arity: -1, noMulti: true},
+		&Command{name: "publish", handler: publish, arity: 3, fast: true},
+		&Command{name: "pubsub", handler: pubsubCmd, arity: -2, help: pubsubHelp},
+	)
+}
+
+// pubsubHelp is the reply to PUBSUB HELP.
+var pubsubHelp = []string{
+	"CHANNELS [<pattern>]",
+	"    Return the currently active channels matching a <pattern> (default: '*').",
+	"NUMPAT",
+	"    Return number of subscriptions to patterns.",
+	"NUMSUB [<channel> ...]",
+	"    Return the number of subscribers for the specified channels, excluding",
+	"    pattern subscriptions(default: no channels).",
+}
+
+// PubSub is the registry of pub/sub subscriptions. It is shared by every
+// client and guarded by mu.
+type PubSub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Client]struct{} // channels maps a channel to its subscribers
+	patterns map[string]map[*Client]struct{} // patterns maps a glob pattern to its subscribers
+}
+
+// subscriptions returns the number of channels and patterns c is subscribed
+// to. The caller must hold the pubsub lock or be the goroutine serving c.
+func (c *Client) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+// allowedSubscribed reports whether the command named name may run while a
+// RESP2 client is subscribed, as the connection is then reserved for pushes.
+func allowedSubscribed(name string) bool {
+	switch name {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping", "quit":
+		return true
+	}
+	return false
+}
+
+// subscribeReply returns the push confirming kind, such as subscribe or
+// punsubscribe, for target, carrying the client's subscription count.
+func subscribeReply(kind string, target *Value, count int) Value {
+	return *newPush([]Value{
+		{Type: Bulk, Bulk: kind},
+		*target,
+		{Type: Integer, Int: int64(count)},
+	})
+}
+
+// subscribe implements SUBSCRIBE channel [channel ...]. Every channel is
+// confirmed with a push of its own, so there is no reply as such.
+func subscribe(c *Client, v *Value, rg *RedisGo) *Value {
+	rg.pubsub.subscribe(c, "subscribe", bulkArgs(v.Array[1:]))
+	return nil
+}
+
+// psubscribe implements PSUBSCRIBE pattern [pattern ...], subscribing to the
+// channels matching each glob pattern.
+func psubscribe(c *Client, v *Value, rg *RedisGo) *Value {
+	rg.pubsub.subscribe(c, "psubscribe", bulkArgs(v.Array[1:]))
+	return nil
+}
+
+// unsubscribe implements UNSUBSCRIBE [channel ...], unsubscribing from every
+// channel when none is given.
+func unsubscribe(c *Client, v *Value, rg *RedisGo) *Value {
+	rg.pubsub.unsubscribe(c, "unsubscribe", bulkArgs(v.Array[1:]))
+	return nil
+}
+
+// punsubscribe implements PUNSUBSCRIBE [pattern ...], unsubscribing from
+// every pattern when none is given.
+func punsubscribe(c *Client, v *Value, rg *RedisGo) *Value {
+	rg.pubsub.unsubscribe(c, "punsubscribe", bulkArgs(v.Array[1:]))
+	return nil
+}
+
+// registries returns the subscriptions of c and the server-wide registry
+// that kind, a (un)subscribe or p(un)subscribe command, applies to. The
+// client's map is created if needed. The caller must hold mu.
+func (ps *PubSub) registries(c *Client, kind string) (map[string]struct{}, map[string]map[*Client]struct{}) {
+	if strings.HasPrefix(kind, "p") {
+		if c.patterns == nil {
+			c.patterns = make(map[string]struct{})
+		}
+		return c.patterns, ps.patterns
+	}
+	if c.channels == nil {
+		c.channels = make(map[string]struct{})
+	}
+	return c.channels, ps.channels
+}
+
+// subscribe subscribes c to targets, channels or patterns depending on kind,
+// confirming each with a push. subscribe is thread-safe.
+func (ps *PubSub) subscribe(c *Client, kind string, targets []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	own, registry := ps.registries(c, kind)
+	c.startPushLoop()
+	for _, target := range targets {
+		if _, ok := own[target]; !ok {
+			own[target] = struct{}{}
+			subs, ok := registry[target]
+			if !ok {
+				subs = make(map[*Client]struct{})
+				registry[target] = subs
+			}
+			subs[c] = struct{}{}
+		}
+		c.push(subscribeReply(kind, newBulk(target), c.subscriptions()))
+	}
+}
+
+// unsubscribe unsubscribes c from targets, channels or patterns depending on
+// kind, or from all of them if targets is empty, confirming each with a
+// push. unsubscribe is thread-safe.
+func (ps *PubSub) unsubscribe(c *Client, kind string, targets []string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	own, registry := ps.registries(c, kind)
+	if len(targets) == 0 {
+		for target := range own {
+			targets = append(targets, target)
+		}
+		if len(targets) == 0 {
+			c.push(subscribeReply(kind, newNull(), c.subscriptions()))
+			return
+		}
+	}
+	for _, target := range targets {
+		ps.remove(c, own, registry, target)
+		c.push(subscribeReply(kind, newBulk(target), c.subscriptions()))
+	}
+}
+
+// remove drops target from the subscriptions own of c and from registry. The
+// caller must hold mu.
+func (ps *PubSub) remove(c *Client, own map[string]struct{}, registry map[string]map[*Client]struct{}, target string) {
+	if _, ok := own[target]; !ok {
+		return
+	}
+	delete(own, target)
+	if subs := registry[target]; subs != nil {
+		if delete(subs, c); len(subs) == 0 {
+			delete(registry, target)
+		}
+	}
+}
+
+// unsubscribeAll removes every subscription of c, as it disconnects.
+// unsubscribeAll is thread-safe.
+func (ps *PubSub) unsubscribeAll(c *Client) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for channel := range c.channels {
+		ps.remove(c, c.channels, ps.channels, channel)
+	}
+	for pattern := range c.patterns {
+		ps.remove(c, c.patterns, ps.patterns, pattern)
+	}
+}
+
+// publish implements PUBLISH channel message, replying with the number of
+// clients the message was delivered to.
+func publish(c *Client, v *Value, rg *RedisGo) *Value {
+	return newInteger(int64(rg.pubsub.publish(v.Array[1].Bulk, v.Array[2].Bulk)))
+}
+
+// publish queues message on channel to every subscriber of the channel and of
+// every pattern matching it, returning the number of deliveries. A client
+// subscribed several ways receives the message once for each. publish is
+// thread-safe.
+func (ps *PubSub) publish(channel, message string) int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	n := 0
+	if subs := ps.channels[channel]; len(subs) > 0 {
+		msg := *newPush(bulkValues([]string{"message", channel, message}))
+		for sub := range subs {
+			sub.push(msg)
+		}
+		n += len(subs)
+	}
+	for pattern, subs := range ps.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+		msg := *newPush(bulkValues([]string{"pmessage", pattern, channel, message}))
+		for sub := range subs {
+			sub.push(msg)
+		}
+		n += len(subs)
+	}
+	return n
+}
+
+// pubsubCmd implements PUBSUB CHANNELS [pattern], PUBSUB NUMSUB [channel ...]
+// and PUBSUB NUMPAT.
+func pubsubCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	ps := &rg.pubsub
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	args := bulkArgs(v.Array[2:])
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "CHANNELS" && len(args) <= 1:
+		channels := make([]string, 0)
+		for channel := range ps.channels {
+			if len(args) == 0 || globMatch(args[0], channel) {
+				channels = append(channels, channel)
+			}
+		}
+		return newArray(bulkValues(channels))
+	case sub == "NUMSUB":
+		counts := make([]Value, 0, 2*len(args))
+		for _, channel := range args {
+			counts = append(counts, Value{Type: Bulk, Bulk: channel},
+				Value{Type: Integer, Int: int64(len(ps.channels[channel]))})
+		}
+		return newMap(counts)
+	case sub == "NUMPAT" && len(args) == 0:
+		return newInteger(int64(len(ps.patterns)))
+	default:
+		return unknownSubcommand("pubsub", v.Array[1].Bulk)
+	}
+}
+
+// subscribedPing is PING's reply to a subscribed RESP2 client, where it can
+// only answer with a push-like array.
+func subscribedPing(v *Value) *Value {
+	msg := ""
+	if len(v.Array) > 1 {
+		msg = v.Array[1].Bulk
+	}
+	return newArray(bulkValues([]string{"pong", msg}))
+}
+
+// subscribedError is the error replied to a subscribed RESP2 client running a
+// command other than those allowedSubscribed.
+func subscribedError(name string) *Value {
+	return newError("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are "+
+		"allowed in this context", strings.ToLower(name))
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "save", handler: save, arity: 1},
+		&Command{name: "bgsave", handler: bgsave, arity: 1},
+		&Command{name: "lastsave", handler: lastSave, arity: 1, fast: true},
+	)
+}
+
+// errSaveInProgress is returned when a snapshot is requested while another
+// one is still being written.
+var errSaveInProgress = errors.New("background save already in progress")
+
+// rdbFile is the content of an RDB file in the gob format: the store of
+// every database, indexed by database number.
+type rdbFile struct {
+	Dbs []map[string]*Item
+}
+
+// rdbPath returns the path of the RDB file configured by dir and dbfilename.
+func (rg *RedisGo) rdbPath() string {
+	return filepath.Join(rg.conf.dir, rg.conf.rdbFn)
+}
+
+// SaveRDB writes a snapshot of every database to path. The file is written
+// under a temporary name and renamed into place, so a crash mid-save never
+// leaves a truncated RDB behind. Only one snapshot may be in progress at a
+// time; a concurrent call fails with errSaveInProgress.
+func (rg *RedisGo) SaveRDB(path string) error {
+	if !rg.inRdbSnapshot.CompareAndSwap(false, true) {
+		return errSaveInProgress
+	}
+	defer rg.inRdbSnapshot.Store(false)
+
+	dirty := rg.dirty.Load()
+	return rg.writeRDB(path, rg.cloneDbs(), dirty)
+}
+
+// BgSaveRDB starts writing a snapshot of every database to path on a new
+// goroutine and returns once the snapshot has been taken, so writes issued
+// after it returns never appear in the file. Like SaveRDB it fails with
+// errSaveInProgress while another snapshot is being written.
+func (rg *RedisGo) BgSaveRDB(path string) error {
+	if !rg.inRdbSnapshot.CompareAndSwap(false, true) {
+		return errSaveInProgress
+	}
+	// dirty is read before cloning so that a write racing with the clone is
+	// counted as unsaved rather than dropped.
+	dirty := rg.dirty.Load()
+	start := time.Now()
+	rg.rdbCopy = rg.cloneDbs()
+	// The copy stands in for the fork of Redis, stalling writers the same way.
+	rg.sampleLatency("fork", time.Since(start))
+
+	go func() {
+		defer rg.inRdbSnapshot.Store(false)
+
+		if err := rg.writeRDB(path, rg.rdbCopy, dirty); err != nil {
+			log.Printf("background save failed: %v", err)
+		} else {
+			log.Println("background saving terminated with success")
+		}
+		rg.rdbCopy = nil
+	}()
+	return nil
+}
+
+// cloneDbs returns a deep copy of every database's store as of a single point
+// in time, leaving out keys that have already expired. All databases are read
+// locked together so no write lands in between two of them.
+func (rg *RedisGo) cloneDbs() []map[string]*Item {
+	unlocks := make([]func(), 0, len(rg.dbs))
+	for _, db := range rg.dbs {
+		unlocks = append(unlocks, db.rlockAll())
+	}
+	defer func() {
+		for _, unlock := range unlocks {
+			unlock()
+		}
+	}()
+
+	dbs := make([]map[string]*Item, len(rg.dbs))
+	for i, db := range rg.dbs {
+		dbs[i] = make(map[string]*Item, db.Size())
+		for j := range db.shards {
+			for key, item := range db.shards[j].store {
+				if item.hasExpired() {
+					continue
+				}
+				cp := item.clone()
+				cp.AccessCount = item.accessCount()
+				cp.LastAccessed = atomic.LoadInt64(&item.LastAccessed)
+				cp.DecayedAt = atomic.LoadInt64(&item.DecayedAt)
+				dbs[i][key] = cp
+			}
+		}
+	}
+	return dbs
+}
+
+// writeRDB encodes dbs to path through a temporary file in the same
+// directory, then records the save in the RDB stats and takes the dirty
+// changes the snapshot covered off the dirty counter.
+func (rg *RedisGo) writeRDB(path string, dbs []map[string]*Item, dirty int64) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-*.rdb")
+	if err != nil {
+		return fmt.Errorf("cannot create temp rdb file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	bw := bufio.NewWriter(tmp)
+	if err = encodeRDB(bw, dbs, rg.conf.rdbFileFormat()); err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot write rdb file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("cannot rename temp rdb file: %w", err)
+	}
+	rg.dirty.Add(-dirty)
+	rg.rbdState.lastSaveTs.Store(time.Now().Unix())
+	rg.rbdState.saves.Add(1)
+	return nil
+}
+
+// encodeRDB writes dbs to w in format, as saved to disk and sent to
+// replicas.
+func encodeRDB(w io.Writer, dbs []map[string]*Item, format RDBFormat) error {
+	if format == RedisRDB {
+		return encodeRedisRDB(w, dbs)
+	}
+	return gob.NewEncoder(w).Encode(rdbFile{Dbs: dbs})
+}
+
+// decodeRDB reads the databases encoded by encodeRDB from r, in either
+// format, told apart by the magic that starts the Redis format.
+func decodeRDB(r io.Reader) ([]map[string]*Item, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	if magic, err := br.Peek(len(rdbMagic)); err == nil && string(magic) == rdbMagic {
+		return decodeRedisRDB(br)
+	}
+	var rdb rdbFile
+	if err := gob.NewDecoder(br).Decode(&rdb); err != nil {
+		return nil, err
+	}
+	return rdb.Dbs, nil
+}
+
+// saveCron checks the save points configured with the save directive once a
+// second, starting a BGSAVE as soon as one of them is met: at least
+// KeysChanged writes within the last Secs seconds since the last save. It runs
+// until conf.quit is closed.
+func (rg *RedisGo) saveCron() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.conf.quit:
+			return
+		case <-ticker.C:
+			// A save already in progress is left to finish; the save
+			// points are checked again on the next tick.
+			if rg.savePointReached() {
+				_ = rg.BgSaveRDB(rg.rdbPath())
+			}
+		}
+	}
+}
+
+// savePointReached reports whether any configured save point is met.
+func (rg *RedisGo) savePointReached() bool {
+	dirty := rg.dirty.Load()
+	elapsed := time.Now().Unix() - rg.rbdState.lastSaveTs.Load()
+	for _, point := range rg.conf.rdb {
+		if dirty >= int64(point.KeysChanged) && elapsed >= int64(point.Secs) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadRDB replaces the contents of the databases with the snapshot stored at
+// path. Keys that expired while the server was down are skipped, as are
+// databases beyond the configured count.
+func (rg *RedisGo) LoadRDB(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	dbs, err := decodeRDB(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("cannot decode rdb file %q: %w", path, err)
+	}
+	rg.loadDbs(dbs)
+	return nil
+}
+
+// loadDbs replaces the contents of the databases with dbs, as decoded from an
+// RDB. Keys that have expired are skipped, as are databases beyond the
+// configured count.
+func (rg *RedisGo) loadDbs(dbs []map[string]*Item) {
+	if len(dbs) > len(rg.dbs) {
+		log.Printf("rdb has %d databases but only %d are configured, ignoring the rest",
+			len(dbs), len(rg.dbs))
+	}
+	for i, db := range rg.dbs {
+		db.Flush(false)
+		if i >= len(dbs) {
+			continue
+		}
+		db.rwm.Lock()
+		for key, item := range dbs[i] {
+			if !item.hasExpired() {
+				db.put(key, item)
+			}
+		}
+		db.rwm.Unlock()
+	}
+}
+
+// saveError converts a failed save into an error reply.
+func saveError(err error) *Value {
+	if errors.Is(err, errSaveInProgress) {
+		return newError("ERR Background save already in progress")
+	}
+	return newError("ERR %v", err)
+}
+
+// save implements SAVE, writing the snapshot before replying.
+func save(c *Client, v *Value, rg *RedisGo) *Value {
+	if err := rg.SaveRDB(rg.rdbPath()); err != nil {
+		return saveError(err)
+	}
+	return newOK()
+}
+
+// lastSave implements LASTSAVE, replying with the Unix time of the last
+// successful save, or of the server start if there was none.
+func lastSave(c *Client, v *Value, rg *RedisGo) *Value {
+	return newInteger(rg.rbdState.lastSaveTs.Load())
+}
+
+// bgsave implements BGSAVE, replying as soon as the snapshot is taken and
+// leaving the write to a background goroutine.
+func bgsave(c *Client, v *Value, rg *RedisGo) *Value {
+	if err := rg.BgSaveRDB(rg.rdbPath()); err != nil {
+		return saveError(err)
+	}
+	return newString("Background saving started")
+}
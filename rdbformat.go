@@ -0,0 +1,767 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Redis RDB format, version 9, as written by Redis 5 and 6: the magic
+// "REDIS" and a four-digit version, then opcodes and key-value pairs, and
+// finally an EOF opcode followed by a CRC-64 of everything before it.
+const (
+	rdbVersion = 9
+
+	rdbOpModuleAux = 0xF7 // rdbOpModuleAux is module data, which can't be loaded
+	rdbOpIdle      = 0xF8 // rdbOpIdle is the LRU idle time of the next key
+	rdbOpFreq      = 0xF9 // rdbOpFreq is the LFU counter of the next key
+	rdbOpAux       = 0xFA // rdbOpAux is a field of metadata about the file
+	rdbOpResizeDB  = 0xFB // rdbOpResizeDB sizes the database being loaded
+	rdbOpExpireMs  = 0xFC // rdbOpExpireMs is the expiry of the next key in ms
+	rdbOpExpireSec = 0xFD // rdbOpExpireSec is the expiry of the next key in s
+	rdbOpSelectDB  = 0xFE // rdbOpSelectDB switches to another database
+	rdbOpEOF       = 0xFF // rdbOpEOF ends the file, followed by its checksum
+
+	rdbTypeString        = 0
+	rdbTypeList          = 1
+	rdbTypeSet           = 2
+	rdbTypeZSet          = 3
+	rdbTypeHash          = 4
+	rdbTypeZSet2         = 5
+	rdbTypeListZiplist   = 10
+	rdbTypeSetIntset     = 11
+	rdbTypeZSetZiplist   = 12
+	rdbTypeHashZiplist   = 13
+	rdbTypeListQuicklist = 14
+
+	// Special string encodings, flagged by the top two bits of a length.
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+)
+
+// rdbMagic starts every file in the Redis RDB format.
+const rdbMagic = "REDIS"
+
+// rdbCRCTable is the table of the CRC-64 variant, Jones, that Redis
+// checksums RDB files with.
+var rdbCRCTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// rdbCRC returns crc updated with p. Unlike the Go implementation, the Redis
+// CRC-64 is neither inverted before nor after.
+func rdbCRC(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, rdbCRCTable, p)
+}
+
+// errBadRDB is returned for a file in the Redis RDB format that is
+// truncated or malformed.
+var errBadRDB = errors.New("malformed rdb")
+
+// rdbEncoder writes the Redis RDB format to w, keeping a checksum of what it
+// wrote. The first error is kept in err and makes further writes no-ops.
+type rdbEncoder struct {
+	w   io.Writer
+	crc uint64
+	err error
+	buf []byte
+}
+
+func (e *rdbEncoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = rdbCRC(e.crc, p)
+	_, e.err = e.w.Write(p)
+}
+
+func (e *rdbEncoder) writeByte(b byte) {
+	e.write([]byte{b})
+}
+
+// writeLength writes n in the length encoding, with 6, 14, 32 or 64 bits.
+func (e *rdbEncoder) writeLength(n uint64) {
+	e.buf = e.buf[:0]
+	switch {
+	case n < 1<<6:
+		e.buf = append(e.buf, byte(n))
+	case n < 1<<14:
+		e.buf = append(e.buf, byte(n>>8)|0x40, byte(n))
+	case n <= math.MaxUint32:
+		e.buf = binary.BigEndian.AppendUint32(append(e.buf, 0x80), uint32(n))
+	default:
+		e.buf = binary.BigEndian.AppendUint64(append(e.buf, 0x81), n)
+	}
+	e.write(e.buf)
+}
+
+// writeString writes s prefixed with its length. Strings are never
+// compressed or encoded as integers, which readers need not expect.
+func (e *rdbEncoder) writeString(s string) {
+	e.writeLength(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+// writeDouble writes f as a little-endian IEEE 754 double.
+func (e *rdbEncoder) writeDouble(f float64) {
+	e.write(binary.LittleEndian.AppendUint64(e.buf[:0], math.Float64bits(f)))
+}
+
+// encodeRedisRDB writes dbs to w in the Redis RDB format. Every value uses
+// the plain encoding of its type: lists, sets and hashes as sequences of
+// strings and sorted sets as members with binary scores. Streams are left
+// out with a logged warning.
+func encodeRedisRDB(w io.Writer, dbs []map[string]*Item) error {
+	e := &rdbEncoder{w: w}
+	e.write(fmt.Appendf(nil, "%s%04d", rdbMagic, rdbVersion))
+	for _, aux := range [][2]string{
+		{"redis-ver", redisVersion},
+		{"redis-bits", strconv.Itoa(strconv.IntSize)},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+	} {
+		e.writeByte(rdbOpAux)
+		e.writeString(aux[0])
+		e.writeString(aux[1])
+	}
+	skipped := 0
+	for i, db := range dbs {
+		keys, expires := 0, 0
+		for _, item := range db {
+			// Streams are stored as listpacks, which this encoder doesn't
+			// write, so they are left out rather than failing the save.
+			if item.Kind == KindStream {
+				skipped++
+				continue
+			}
+			keys++
+			if item.hasExpiry() {
+				expires++
+			}
+		}
+		if keys == 0 {
+			continue
+		}
+		e.writeByte(rdbOpSelectDB)
+		e.writeLength(uint64(i))
+		e.writeByte(rdbOpResizeDB)
+		e.writeLength(uint64(keys))
+		e.writeLength(uint64(expires))
+		for key, item := range db {
+			if item.Kind == KindStream {
+				continue
+			}
+			if item.hasExpiry() {
+				e.writeByte(rdbOpExpireMs)
+				e.write(binary.LittleEndian.AppendUint64(e.buf[:0], uint64(item.Expiration.UnixMilli())))
+			}
+			e.writeItem(key, item)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("leaving %d stream keys out of the rdb, the redis rdb format can't hold them", skipped)
+	}
+	e.writeByte(rdbOpEOF)
+	if e.err == nil {
+		_, e.err = w.Write(binary.LittleEndian.AppendUint64(nil, e.crc))
+	}
+	return e.err
+}
+
+// writeItem writes the type of item, key and the value of item.
+func (e *rdbEncoder) writeItem(key string, item *Item) {
+	switch item.Kind {
+	case KindString:
+		e.writeByte(rdbTypeString)
+		e.writeString(key)
+		e.writeString(item.Value)
+	case KindList:
+		e.writeByte(rdbTypeList)
+		e.writeString(key)
+		e.writeLength(uint64(len(item.List)))
+		for _, elem := range item.List {
+			e.writeString(elem)
+		}
+	case KindSet:
+		e.writeByte(rdbTypeSet)
+		e.writeString(key)
+		e.writeLength(uint64(len(item.Set)))
+		for member := range item.Set {
+			e.writeString(member)
+		}
+	case KindHash:
+		e.writeByte(rdbTypeHash)
+		e.writeString(key)
+		e.writeLength(uint64(len(item.Hash)))
+		for field, value := range item.Hash {
+			e.writeString(field)
+			e.writeString(value)
+		}
+	case KindZSet:
+		e.writeByte(rdbTypeZSet2)
+		e.writeString(key)
+		e.writeLength(uint64(item.ZSet.Len()))
+		for _, entry := range item.ZSet.Entries {
+			e.writeString(entry.Member)
+			e.writeDouble(entry.Score)
+		}
+	}
+}
+
+// rdbDecoder reads the Redis RDB format from r, keeping a checksum of what
+// it read.
+type rdbDecoder struct {
+	r   *bufio.Reader
+	crc uint64
+}
+
+func (d *rdbDecoder) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.crc = rdbCRC(d.crc, p[:n])
+	return n, err
+}
+
+// readFull reads exactly n bytes. Truncation is reported as errBadRDB.
+func (d *rdbDecoder) readFull(n int) ([]byte, error) {
+	p := make([]byte, n)
+	if _, err := io.ReadFull(d, p); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errBadRDB
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (d *rdbDecoder) readByte() (byte, error) {
+	p, err := d.readFull(1)
+	if err != nil {
+		return 0, err
+	}
+	return p[0], nil
+}
+
+// readLength reads a length. If encoded is set, n is instead the special
+// encoding of the string that follows.
+func (d *rdbDecoder) readLength() (n uint64, encoded bool, err error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3F), false, nil
+	case 1:
+		next, err := d.readByte()
+		return uint64(b&0x3F)<<8 | uint64(next), false, err
+	case 2:
+		switch b {
+		case 0x80:
+			p, err := d.readFull(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(p)), false, nil
+		case 0x81:
+			p, err := d.readFull(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(p), false, nil
+		}
+		return 0, false, errBadRDB
+	default:
+		return uint64(b & 0x3F), true, nil
+	}
+}
+
+// readCount reads a length counting elements or bytes, which can't exceed
+// the size of an int.
+func (d *rdbDecoder) readCount() (int, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || n > math.MaxInt32 {
+		return 0, errBadRDB
+	}
+	return int(n), nil
+}
+
+// readString reads a string, whether stored as is, as an integer or
+// compressed with LZF.
+func (d *rdbDecoder) readString() (string, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return "", err
+	}
+	if !encoded {
+		if n > math.MaxInt32 {
+			return "", errBadRDB
+		}
+		// Copied in chunks so that a corrupt length fails at the end of the
+		// input instead of allocating it all up front.
+		var sb strings.Builder
+		if _, err := io.CopyN(&sb, d, int64(n)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", errBadRDB
+			}
+			return "", err
+		}
+		return sb.String(), nil
+	}
+	switch n {
+	case rdbEncInt8:
+		b, err := d.readByte()
+		return strconv.Itoa(int(int8(b))), err
+	case rdbEncInt16:
+		p, err := d.readFull(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(p)))), nil
+	case rdbEncInt32:
+		p, err := d.readFull(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(p)))), nil
+	case rdbEncLZF:
+		clen, err := d.readCount()
+		if err != nil {
+			return "", err
+		}
+		ulen, err := d.readCount()
+		if err != nil {
+			return "", err
+		}
+		data, err := d.readFull(clen)
+		if err != nil {
+			return "", err
+		}
+		out, err := lzfDecompress(data, ulen)
+		return string(out), err
+	default:
+		return "", errBadRDB
+	}
+}
+
+// readScore reads a sorted set score stored as text, as in the oldest sorted
+// set encoding: a length byte, with three values reserved for NaN and the
+// infinities, and the digits.
+func (d *rdbDecoder) readScore() (float64, error) {
+	n, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	p, err := d.readFull(int(n))
+	if err != nil {
+		return 0, err
+	}
+	score, err := strconv.ParseFloat(string(p), 64)
+	if err != nil {
+		return 0, errBadRDB
+	}
+	return score, nil
+}
+
+// decodeRedisRDB reads the databases of a file in the Redis RDB format, of
+// version 9 or older, from r. Values using encodings of later versions, or
+// types other than strings, lists, sets, hashes and sorted sets, fail to
+// load. The LRU and LFU hints and the metadata are skipped, and empty
+// collections, which Redis never saves, dropped.
+func decodeRedisRDB(r *bufio.Reader) ([]map[string]*Item, error) {
+	d := &rdbDecoder{r: r}
+	header, err := d.readFull(len(rdbMagic) + 4)
+	if err != nil {
+		return nil, err
+	}
+	version, err := strconv.Atoi(string(header[len(rdbMagic):]))
+	if !strings.HasPrefix(string(header), rdbMagic) || err != nil {
+		return nil, errBadRDB
+	}
+	if version < 1 || version > rdbVersion {
+		return nil, fmt.Errorf("unsupported rdb version %d", version)
+	}
+
+	var dbs []map[string]*Item
+	db := 0
+	expiry := time.Unix(unixTSEpoch, 0)
+	for {
+		op, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case rdbOpAux:
+			for range 2 {
+				if _, err := d.readString(); err != nil {
+					return nil, err
+				}
+			}
+		case rdbOpResizeDB:
+			for range 2 {
+				if _, _, err := d.readLength(); err != nil {
+					return nil, err
+				}
+			}
+		case rdbOpExpireMs:
+			p, err := d.readFull(8)
+			if err != nil {
+				return nil, err
+			}
+			expiry = time.UnixMilli(int64(binary.LittleEndian.Uint64(p)))
+		case rdbOpExpireSec:
+			p, err := d.readFull(4)
+			if err != nil {
+				return nil, err
+			}
+			expiry = time.Unix(int64(binary.LittleEndian.Uint32(p)), 0)
+		case rdbOpIdle:
+			if _, _, err := d.readLength(); err != nil {
+				return nil, err
+			}
+		case rdbOpFreq:
+			if _, err := d.readByte(); err != nil {
+				return nil, err
+			}
+		case rdbOpSelectDB:
+			n, err := d.readCount()
+			if err != nil {
+				return nil, err
+			}
+			if n >= math.MaxUint16 {
+				return nil, fmt.Errorf("invalid database number %d", n)
+			}
+			db = n
+		case rdbOpModuleAux:
+			return nil, errors.New("rdb holds module data, which can't be loaded")
+		case rdbOpEOF:
+			if version >= 5 {
+				crc := d.crc
+				p, err := d.readFull(8)
+				if err != nil {
+					return nil, err
+				}
+				// A checksum of 0 means the file was saved without one.
+				if sum := binary.LittleEndian.Uint64(p); sum != 0 && sum != crc {
+					return nil, errors.New("rdb checksum mismatch")
+				}
+			}
+			return dbs, nil
+		default:
+			key, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			item, err := d.readItem(op)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load key %q: %w", key, err)
+			}
+			if item.elements() > 0 {
+				item.Expiration = expiry
+				for len(dbs) <= db {
+					dbs = append(dbs, make(map[string]*Item))
+				}
+				dbs[db][key] = item
+			}
+			expiry = time.Unix(unixTSEpoch, 0)
+		}
+	}
+}
+
+// readItem reads a value of type typ.
+func (d *rdbDecoder) readItem(typ byte) (*Item, error) {
+	switch typ {
+	case rdbTypeString:
+		s, err := d.readString()
+		return &Item{Kind: KindString, Value: s}, err
+	case rdbTypeList, rdbTypeSet:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		elems := make([]string, 0, min(n, 1024))
+		for range n {
+			s, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, s)
+		}
+		if typ == rdbTypeList {
+			return &Item{Kind: KindList, List: elems}, nil
+		}
+		return newSetItem(setOf(elems)), nil
+	case rdbTypeHash:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		hash := make(map[string]string, min(n, 1024))
+		for range n {
+			field, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			if hash[field], err = d.readString(); err != nil {
+				return nil, err
+			}
+		}
+		return &Item{Kind: KindHash, Hash: hash}, nil
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		zs := NewSortedSet()
+		for range n {
+			member, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			var score float64
+			if typ == rdbTypeZSet {
+				score, err = d.readScore()
+			} else {
+				var p []byte
+				if p, err = d.readFull(8); err == nil {
+					score = math.Float64frombits(binary.LittleEndian.Uint64(p))
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			if math.IsNaN(score) {
+				return nil, errBadRDB
+			}
+			zs.Add(member, score)
+		}
+		return newZSetItem(zs), nil
+	case rdbTypeListQuicklist:
+		n, err := d.readCount()
+		if err != nil {
+			return nil, err
+		}
+		var elems []string
+		for range n {
+			zl, err := d.readString()
+			if err != nil {
+				return nil, err
+			}
+			entries, err := ziplistEntries(zl)
+			if err != nil {
+				return nil, err
+			}
+			elems = append(elems, entries...)
+		}
+		return &Item{Kind: KindList, List: elems}, nil
+	case rdbTypeListZiplist, rdbTypeZSetZiplist, rdbTypeHashZiplist:
+		zl, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := ziplistEntries(zl)
+		if err != nil {
+			return nil, err
+		}
+		if typ == rdbTypeListZiplist {
+			return &Item{Kind: KindList, List: entries}, nil
+		}
+		if len(entries)%2 != 0 {
+			return nil, errBadRDB
+		}
+		if typ == rdbTypeHashZiplist {
+			hash := make(map[string]string, len(entries)/2)
+			for i := 0; i < len(entries); i += 2 {
+				hash[entries[i]] = entries[i+1]
+			}
+			return &Item{Kind: KindHash, Hash: hash}, nil
+		}
+		zs := NewSortedSet()
+		for i := 0; i < len(entries); i += 2 {
+			score, err := strconv.ParseFloat(entries[i+1], 64)
+			if err != nil || math.IsNaN(score) {
+				return nil, errBadRDB
+			}
+			zs.Add(entries[i], score)
+		}
+		return newZSetItem(zs), nil
+	case rdbTypeSetIntset:
+		is, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		members, err := intsetMembers(is)
+		if err != nil {
+			return nil, err
+		}
+		return newSetItem(setOf(members)), nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %d", typ)
+	}
+}
+
+// setOf returns the set of members.
+func setOf(members []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	return set
+}
+
+// ziplistEntries returns the entries of a ziplist, the compact encoding of
+// small lists, hashes and sorted sets: a 10-byte header, then every entry as
+// the length of the previous one, an encoding and the data, and a 0xFF end
+// marker. Integers are returned formatted in decimal.
+func ziplistEntries(zl string) ([]string, error) {
+	var entries []string
+	p := 10
+	for p < len(zl) {
+		if zl[p] == 0xFF {
+			return entries, nil
+		}
+		if zl[p] == 0xFE {
+			p += 5
+		} else {
+			p++
+		}
+		if p >= len(zl) {
+			break
+		}
+		enc := zl[p]
+		var n, size int // n is the length of a string entry, size of an integer
+		switch {
+		case enc>>6 == 0:
+			n, p = int(enc&0x3F), p+1
+		case enc>>6 == 1 && p+1 < len(zl):
+			n, p = int(enc&0x3F)<<8|int(zl[p+1]), p+2
+		case enc == 0x80 && p+4 < len(zl):
+			n, p = int(binary.BigEndian.Uint32([]byte(zl[p+1:p+5]))), p+5
+		case enc == 0xFE:
+			size = 1
+		case enc == 0xC0:
+			size = 2
+		case enc == 0xF0:
+			size = 3
+		case enc == 0xD0:
+			size = 4
+		case enc == 0xE0:
+			size = 8
+		case enc >= 0xF1 && enc <= 0xFD:
+			entries = append(entries, strconv.Itoa(int(enc&0x0F)-1))
+			p++
+			continue
+		default:
+			return nil, errBadRDB
+		}
+		if size > 0 {
+			p++
+			if p+size > len(zl) {
+				return nil, errBadRDB
+			}
+			entries = append(entries, strconv.FormatInt(leInt(zl[p:p+size]), 10))
+			p += size
+			continue
+		}
+		if n < 0 || p+n > len(zl) {
+			return nil, errBadRDB
+		}
+		entries = append(entries, zl[p:p+n])
+		p += n
+	}
+	return nil, errBadRDB
+}
+
+// intsetMembers returns the members of an intset, the compact encoding of
+// small sets of integers: the size of each integer, 2, 4 or 8 bytes, and
+// their count, both 32-bit, then the integers, all little-endian.
+func intsetMembers(is string) ([]string, error) {
+	if len(is) < 8 {
+		return nil, errBadRDB
+	}
+	size := int(binary.LittleEndian.Uint32([]byte(is[:4])))
+	count := int(binary.LittleEndian.Uint32([]byte(is[4:8])))
+	if size != 2 && size != 4 && size != 8 || len(is)-8 != count*size {
+		return nil, errBadRDB
+	}
+	members := make([]string, count)
+	for i := range members {
+		off := 8 + i*size
+		members[i] = strconv.FormatInt(leInt(is[off:off+size]), 10)
+	}
+	return members, nil
+}
+
+// leInt decodes a signed little-endian integer of 1 to 8 bytes.
+func leInt(b string) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	shift := 64 - 8*len(b)
+	return int64(u<<shift) >> shift
+}
+
+// lzfDecompress decompresses in, compressed with LZF into ulen bytes. The
+// input is a sequence of literal runs, whose control byte below 32 is the
+// length minus one, and back references, whose control byte holds the
+// length minus two in its top three bits, 7 meaning a further length byte
+// follows, and the high bits of the offset, whose low byte follows.
+func lzfDecompress(in []byte, ulen int) ([]byte, error) {
+	out := make([]byte, 0, min(ulen, 1<<20))
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > ulen {
+				return nil, errBadRDB
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errBadRDB
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errBadRDB
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > ulen {
+			return nil, errBadRDB
+		}
+		// The reference may overlap the bytes being appended.
+		for j := range n {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != ulen {
+		return nil, errBadRDB
+	}
+	return out, nil
+}
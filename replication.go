@@ -0,0 +1,833 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "wait", handler: wait, arity: 3},
+		&Command{name: "role", handler: role, arity: 1, fast: true},
+		&Command{name: "failover", handler: failover, arity: -1},
+		&Command{name: "sync", handler: syncCmd, arity: 1, noMulti: true},
+		&Command{name: "psync", handler: psync, arity: -3, noMulti: true},
+		&Command{name: "replconf", handler: replconf, arity: -1},
+		&Command{name: "replicaof", handler: replicaOf, arity: 3, noMulti: true},
+		&Command{name: "slaveof", handler: replicaOf, arity: 3, noMulti: true},
+	)
+}
+
+const (
+	// replPingPeriod is how often a master with replicas pings them through
+	// the replication stream, so that they can tell an idle master from a
+	// dead link.
+	replPingPeriod = 10 * time.Second
+
+	// replTimeout is how long a replica waits for data from its master
+	// before dropping the link and reconnecting.
+	replTimeout = 60 * time.Second
+
+	// replRetryPeriod is how long a replica waits before reconnecting to its
+	// master after the link failed.
+	replRetryPeriod = time.Second
+
+	// replAckPeriod is how often a replica acknowledges the offset it
+	// processed to its master.
+	replAckPeriod = time.Second
+)
+
+// replStream tracks the replication stream of the server as a master: the
+// write commands it executed, in the form they are propagated, preceded by a
+// SELECT whenever the database changes. Every command of the stream is pushed
+// to the connected replicas.
+type replStream struct {
+	mu sync.Mutex
+
+	// order is held for reading by the writes that run without mu, which
+	// they do while no replica or AOF consumes the stream, and for writing
+	// while a replica registers, so that the copy of the dataset it gets
+	// has every write before its offset in the stream and none after.
+	order sync.RWMutex
+
+	// numReplicas is the length of replicas, readable without mu.
+	numReplicas atomic.Int32
+
+	// id is the replication ID of the stream, random for every run of the
+	// server.
+	id string
+
+	// offset is the number of bytes of the stream so far, the
+	// master_repl_offset of Redis.
+	offset int64
+
+	// db is the database the last command of the stream ran in, -1 before
+	// the first one and after a replica synchronized.
+	db int
+
+	// replicas holds the clients that synchronized with SYNC or PSYNC, in
+	// the order they did.
+	replicas []*Client
+
+	// expired holds the keys deleted on expiry that are yet to be
+	// propagated, guarded by expiredMu. Keys expire with their shard
+	// locked, and possibly mu as well, so they are queued here and
+	// propagated by the next holder of mu.
+	expired   []expiredKey
+	expiredMu sync.Mutex
+}
+
+// expiredKey is a key deleted on expiry from database db.
+type expiredKey struct {
+	db  int
+	key string
+}
+
+// newReplID returns a random replication ID of 40 hexadecimal digits.
+func newReplID() string {
+	b := make([]byte, 20)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// feedReplication appends cmds, executed in database db, to the replication
+// stream and pushes them to the replicas. A negative db, for commands that
+// don't depend on the database, never causes a SELECT. The caller must hold
+// repl.mu.
+func (rg *RedisGo) feedReplication(db int, cmds []Value) {
+	r := &rg.repl
+	if db >= 0 && r.db != db {
+		r.send(newCommand("select", strconv.Itoa(db)))
+		r.db = db
+	}
+	for _, cmd := range cmds {
+		r.send(cmd)
+	}
+}
+
+// send appends cmd to the stream and pushes it to every replica. The caller
+// must hold mu.
+func (r *replStream) send(cmd Value) {
+	r.offset += respLen(&cmd)
+	for _, c := range r.replicas {
+		c.push(cmd)
+	}
+}
+
+// execWrite runs the write command in v and, once it succeeds, appends it to
+// the replication stream, or the commands the handler chose to propagate in
+// its place, recording them in the AOF as well if it is enabled. While the
+// AOF or a replica consumes the stream, repl.mu is held throughout, so that
+// the stream follows the order in which writes were applied even when they
+// ran on different keys. Otherwise writes run in parallel, only taking
+// repl.mu to advance the stream.
+func (rg *RedisGo) execWrite(c *Client, v *Value, cmd *Command) *Value {
+	r := &rg.repl
+	if rg.aof == nil {
+		r.order.RLock()
+		if r.numReplicas.Load() == 0 {
+			defer r.order.RUnlock()
+			reply := cmd.handler(c, v, rg)
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return rg.feedWrite(c, v, reply)
+		}
+		r.order.RUnlock()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var reply *Value
+	if rg.aof != nil {
+		reply = rg.execLogged(c, v, cmd)
+	} else {
+		reply = cmd.handler(c, v, rg)
+	}
+	return rg.feedWrite(c, v, reply)
+}
+
+// feedWrite appends the write command in v, which replied reply, to the
+// replication stream as execWrite describes, and returns reply. The caller
+// must hold repl.mu.
+func (rg *RedisGo) feedWrite(c *Client, v *Value, reply *Value) *Value {
+	rg.flushExpired(false)
+	if reply == nil || reply.Type == Error || rg.loading {
+		return reply
+	}
+	cmds := c.propagate
+	if cmds == nil {
+		cmds = []Value{*v}
+	}
+	rg.feedReplication(c.dbIndex, cmds)
+	return reply
+}
+
+// propagate records cmds, executed in database db but not by a write command
+// run through execWrite, in the AOF and the replication stream.
+func (rg *RedisGo) propagate(db int, cmds ...Value) {
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	rg.flushExpired(false)
+	if rg.aof != nil {
+		rg.aof.log(db, cmds...)
+	}
+	if !rg.loading {
+		rg.feedReplication(db, cmds)
+	}
+}
+
+// queueExpired queues a DEL of key, deleted on expiry from database db, to be
+// propagated by flushExpired. Like Redis, a master propagates the expiry of
+// keys rather than leaving the AOF and replicas to expire them on their own
+// clock, so that a key read on the master as expired is gone from them too
+// and a write recreating it is applied after its deletion.
+func (rg *RedisGo) queueExpired(db int, key string) {
+	r := &rg.repl
+	r.expiredMu.Lock()
+	r.expired = append(r.expired, expiredKey{db, key})
+	r.expiredMu.Unlock()
+}
+
+// flushExpired propagates the DELs queued by queueExpired. Write commands
+// flush them once they ran and before they are propagated themselves, which
+// keeps the deletion of a key ahead of any write that saw it missing. The
+// caller must hold repl.mu, and aof.mu as well when aofLocked.
+func (rg *RedisGo) flushExpired(aofLocked bool) {
+	r := &rg.repl
+	r.expiredMu.Lock()
+	expired := r.expired
+	r.expired = nil
+	r.expiredMu.Unlock()
+
+	for len(expired) > 0 {
+		db, n := expired[0].db, 1
+		for n < len(expired) && expired[n].db == db {
+			n++
+		}
+		dels := make([]Value, n)
+		for i := range dels {
+			dels[i] = newCommand("del", expired[i].key)
+		}
+		expired = expired[n:]
+
+		switch {
+		case rg.aof == nil:
+		case aofLocked:
+			if err := rg.aof.append(db, dels); err != nil {
+				log.Printf("cannot append to aof: %v", err)
+			}
+		default:
+			rg.aof.log(db, dels...)
+		}
+		if !rg.loading {
+			rg.feedReplication(db, dels)
+		}
+	}
+}
+
+// propagateExpired propagates the DELs queued by queueExpired outside of a
+// write command, as the active expiry cycle does after deleting keys.
+func (rg *RedisGo) propagateExpired() {
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	rg.flushExpired(false)
+}
+
+// replOffset returns the current offset of the replication stream.
+func (rg *RedisGo) replOffset() int64 {
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	return rg.repl.offset
+}
+
+// respLen returns the length of cmd, an array of bulk strings, encoded in
+// RESP.
+func respLen(cmd *Value) int64 {
+	n := 1 + len(strconv.Itoa(len(cmd.Array))) + 2
+	for _, arg := range cmd.Array {
+		n += 1 + len(strconv.Itoa(len(arg.Bulk))) + 2 + len(arg.Bulk) + 2
+	}
+	return int64(n)
+}
+
+// replPingLoop pings the replicas every replPingPeriod through the
+// replication stream until conf.quit is closed.
+func (rg *RedisGo) replPingLoop() {
+	ticker := time.NewTicker(replPingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rg.conf.quit:
+			return
+		case <-ticker.C:
+			rg.repl.mu.Lock()
+			if len(rg.repl.replicas) > 0 {
+				rg.feedReplication(-1, []Value{newCommand("ping")})
+			}
+			rg.repl.mu.Unlock()
+		}
+	}
+}
+
+// syncCmd implements SYNC, the full synchronization of replicas predating
+// PSYNC: the client is sent a snapshot of the dataset and then the
+// replication stream.
+func syncCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	return rg.fullSync(c, false)
+}
+
+// psync implements PSYNC replicationid offset. Partial resynchronization
+// needs a backlog of the stream, which is not kept, so every replica gets a
+// full resynchronization whatever it asks for.
+func psync(c *Client, v *Value, rg *RedisGo) *Value {
+	return rg.fullSync(c, true)
+}
+
+// fullSync turns c into a replica. The dataset is copied and the client
+// registered as a replica at the same point of the stream, then sent the
+// +FULLRESYNC reply for PSYNC and the copy in the RDB format, as a bulk
+// string without the trailing CRLF. The stream follows as push messages.
+func (rg *RedisGo) fullSync(c *Client, psync bool) *Value {
+	if c.replica {
+		return nil
+	}
+	if c.conn == nil {
+		return newError("ERR SYNC is not allowed from this client")
+	}
+	r := &rg.repl
+	r.order.Lock()
+	r.mu.Lock()
+	// The copy has no key expired so far, so their DELs go before it.
+	rg.flushExpired(false)
+	start := time.Now()
+	dbs := rg.cloneDbs()
+	id, offset := r.id, r.offset
+	// The stream the replica receives starts in an unknown database.
+	r.db = -1
+	r.replicas = append(r.replicas, c)
+	r.numReplicas.Store(int32(len(r.replicas)))
+	c.replica = true
+	r.mu.Unlock()
+	r.order.Unlock()
+	rg.sampleLatency("fork", time.Since(start))
+
+	var buf bytes.Buffer
+	err := encodeRDB(&buf, dbs, rg.conf.rdbFileFormat())
+	if err == nil {
+		c.writeMu.Lock()
+		if psync {
+			err = c.writer.Write(newString(fmt.Sprintf("FULLRESYNC %s %d", id, offset)))
+		}
+		if err == nil {
+			err = c.writer.Flush()
+		}
+		if err == nil {
+			_, err = fmt.Fprintf(c.conn, "$%d\r\n", buf.Len())
+		}
+		if err == nil {
+			_, err = buf.WriteTo(c.conn)
+		}
+		c.writeMu.Unlock()
+	}
+	if err != nil {
+		log.Printf("full sync of replica %s failed: %v", c.addr(), err)
+		_ = c.conn.Close()
+		return nil
+	}
+	log.Printf("replica %s synchronized at offset %d", c.addr(), offset)
+	c.startPushLoop()
+	return nil
+}
+
+// removeReplica stops sending the replication stream to c, if it is a
+// replica.
+func (rg *RedisGo) removeReplica(c *Client) {
+	if !c.replica {
+		return
+	}
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	rg.repl.replicas = slices.DeleteFunc(rg.repl.replicas, func(r *Client) bool { return r == c })
+	rg.repl.numReplicas.Store(int32(len(rg.repl.replicas)))
+}
+
+// dropReplicas disconnects every replica, making them resynchronize, for
+// when the dataset was replaced by one the stream doesn't lead to.
+func (rg *RedisGo) dropReplicas() {
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	for _, c := range rg.repl.replicas {
+		_ = c.conn.Close()
+	}
+	rg.repl.replicas = nil
+	rg.repl.numReplicas.Store(0)
+}
+
+// replconf implements REPLCONF option value [option value ...], through which
+// replicas describe themselves to their master. ACK offset, sent by a
+// replica once a second, records the offset it processed and gets no reply.
+func replconf(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[1:])
+	if len(args)%2 != 0 {
+		return newError(errSyntax)
+	}
+	for i := 0; i < len(args); i += 2 {
+		switch strings.ToLower(args[i]) {
+		case "listening-port":
+			port, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return newError(errNotInt)
+			}
+			c.replPort = port
+		case "ack":
+			offset, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err == nil && c.replica {
+				c.replAck.Store(offset)
+				c.replAckAt.Store(time.Now().UnixNano())
+			}
+			return nil
+		case "getack":
+			return nil
+		case "capa", "ip-address":
+		default:
+			return newError("ERR Unrecognized REPLCONF option: %s", args[i])
+		}
+	}
+	return newOK()
+}
+
+// wait implements WAIT numreplicas timeout. Replicas acknowledge the stream
+// once a second rather than as they apply it, so instead of blocking it
+// replies right away with the number of replicas that acknowledged every
+// write so far.
+func wait(c *Client, v *Value, rg *RedisGo) *Value {
+	if _, err := strconv.ParseInt(v.Array[1].Bulk, 10, 64); err != nil {
+		return newError(errNotInt)
+	}
+	timeout, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	if timeout < 0 {
+		return newError("ERR timeout is negative")
+	}
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	var n int64
+	for _, r := range rg.repl.replicas {
+		if r.replAck.Load() >= rg.repl.offset {
+			n++
+		}
+	}
+	return newInteger(n)
+}
+
+// replicaInfo describes a replica connected to this server.
+type replicaInfo struct {
+	ip     string
+	port   int
+	ack    int64     // ack is the offset the replica last acknowledged
+	ackAt  time.Time // ackAt is when it did, the zero time if never
+	online bool      // online is false until the first acknowledgement
+}
+
+// replicas returns the replicas connected to this server, in the order they
+// synchronized.
+func (rg *RedisGo) replicas() []replicaInfo {
+	rg.repl.mu.Lock()
+	defer rg.repl.mu.Unlock()
+
+	infos := make([]replicaInfo, len(rg.repl.replicas))
+	for i, c := range rg.repl.replicas {
+		ip, _, _ := net.SplitHostPort(c.addr())
+		infos[i] = replicaInfo{ip: ip, port: c.replPort, ack: c.replAck.Load()}
+		if at := c.replAckAt.Load(); at != 0 {
+			infos[i].ackAt, infos[i].online = time.Unix(0, at), true
+		}
+	}
+	return infos
+}
+
+// role implements ROLE, replying with the replication role of the server. A
+// master replies with its replication offset and, for every replica, its
+// address and acknowledged offset; a replica with the address of its master,
+// the state of the link and the offset it processed.
+func role(c *Client, v *Value, rg *RedisGo) *Value {
+	if m := rg.master.Load(); m != nil {
+		return newArray([]Value{
+			{Type: Bulk, Bulk: "slave"},
+			{Type: Bulk, Bulk: m.host},
+			*newInteger(int64(m.port)),
+			{Type: Bulk, Bulk: m.getState()},
+			*newInteger(m.offset.Load()),
+		})
+	}
+	replicas := rg.replicas()
+	vals := make([]Value, len(replicas))
+	for i, r := range replicas {
+		vals[i] = *newArray(bulkValues([]string{r.ip, strconv.Itoa(r.port), strconv.FormatInt(r.ack, 10)}))
+	}
+	return newArray([]Value{
+		{Type: Bulk, Bulk: "master"},
+		*newInteger(rg.replOffset()),
+		{Type: Array, Array: vals},
+	})
+}
+
+// failover implements FAILOVER [TO host port [FORCE]] [ABORT]
+// [TIMEOUT milliseconds]. Coordinated failover is not supported, so it only
+// validates its arguments and fails as Redis does when it can't start one.
+func failover(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[1:])
+	var to, force, abort, timeout bool
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "TO" && !to && i+2 < len(args):
+			if _, err := strconv.Atoi(args[i+2]); err != nil {
+				return newError(errNotInt)
+			}
+			to, i = true, i+2
+		case opt == "FORCE" && !force:
+			force = true
+		case opt == "ABORT" && !abort:
+			abort = true
+		case opt == "TIMEOUT" && !timeout && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return newError(errNotInt)
+			}
+			if ms <= 0 {
+				return newError("ERR FAILOVER timeout must be greater than 0")
+			}
+			timeout, i = true, i+1
+		default:
+			return newError(errSyntax)
+		}
+	}
+	switch {
+	case abort && (to || force || timeout):
+		return newError("ERR FAILOVER with ABORT can't be used with other arguments")
+	case force && (!to || !timeout):
+		return newError("ERR FAILOVER with force option requires both a timeout and target HOST and IP.")
+	case abort:
+		return newError("ERR No failover in progress.")
+	case rg.master.Load() != nil:
+		return newError("ERR FAILOVER is not valid when server is a replica.")
+	default:
+		return newError("ERR FAILOVER requires connected replicas.")
+	}
+}
+
+// masterLink is the link of a replica to its master, maintained by replicate
+// until it is closed.
+type masterLink struct {
+	host string
+	port int
+
+	// offset is the offset of the master's stream processed so far.
+	offset atomic.Int64
+
+	// mu guards state, conn and closed. state is the state of the link as
+	// reported by ROLE: connect, connecting, sync or connected. conn is the
+	// current connection to the master, if any.
+	mu     sync.Mutex
+	state  string
+	conn   net.Conn
+	closed bool
+	stop   chan struct{} // stop is closed along with the link
+}
+
+// addr returns the address of the master.
+func (m *masterLink) addr() string {
+	return net.JoinHostPort(m.host, strconv.Itoa(m.port))
+}
+
+// getState returns the state of the link.
+func (m *masterLink) getState() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state
+}
+
+// setState sets the state of the link.
+func (m *masterLink) setState(state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.state = state
+}
+
+// setConn records conn as the connection to the master. It reports false,
+// closing conn, if the link was closed meanwhile.
+func (m *masterLink) setConn(conn net.Conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		_ = conn.Close()
+		return false
+	}
+	m.conn = conn
+	return true
+}
+
+// close closes the link, interrupting its connection.
+func (m *masterLink) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+	close(m.stop)
+	if m.conn != nil {
+		_ = m.conn.Close()
+	}
+}
+
+// stopped reports whether the link was closed.
+func (m *masterLink) stopped() bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// replicaOf implements REPLICAOF host port and REPLICAOF NO ONE, also known
+// as SLAVEOF. The former makes the server a replica of the master at host
+// and port, discarding its dataset for a copy of the master's once it
+// connected; the latter turns a replica back into a master, keeping the
+// dataset it has.
+func replicaOf(c *Client, v *Value, rg *RedisGo) *Value {
+	host, port := v.Array[1].Bulk, v.Array[2].Bulk
+	if strings.EqualFold(host, "no") && strings.EqualFold(port, "one") {
+		rg.stopReplication()
+		return newOK()
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return newError("ERR Invalid master port")
+	}
+	if !rg.startReplication(host, n) {
+		return newString("OK Already connected to specified master")
+	}
+	return newOK()
+}
+
+// startReplication makes the server a replica of the master at host and
+// port, replacing the link to its current master, if any. It reports false
+// if the server already replicates that master.
+func (rg *RedisGo) startReplication(host string, port int) bool {
+	rg.masterMu.Lock()
+	defer rg.masterMu.Unlock()
+
+	if m := rg.master.Load(); m != nil {
+		if m.host == host && m.port == port {
+			return false
+		}
+		m.close()
+	}
+	m := &masterLink{host: host, port: port, state: "connect", stop: make(chan struct{})}
+	rg.master.Store(m)
+	log.Printf("replicating master %s", m.addr())
+	go rg.replicate(m)
+	return true
+}
+
+// stopReplication turns a replica back into a master.
+func (rg *RedisGo) stopReplication() {
+	rg.masterMu.Lock()
+	defer rg.masterMu.Unlock()
+
+	if m := rg.master.Load(); m != nil {
+		m.close()
+		rg.master.Store(nil)
+		log.Printf("stopped replicating master %s", m.addr())
+	}
+}
+
+// replicate keeps the link m to the master up, reconnecting every
+// replRetryPeriod when it fails, until it is closed or the server shuts
+// down.
+func (rg *RedisGo) replicate(m *masterLink) {
+	for {
+		err := rg.syncWithMaster(m)
+		m.setState("connect")
+		if m.stopped() {
+			return
+		}
+		log.Printf("link with master %s failed: %v", m.addr(), err)
+		select {
+		case <-m.stop:
+			return
+		case <-rg.conf.quit:
+			return
+		case <-time.After(replRetryPeriod):
+		}
+	}
+}
+
+// timeoutReader reads from conn, failing if no data arrives within timeout.
+type timeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (tr timeoutReader) Read(p []byte) (int, error) {
+	_ = tr.conn.SetReadDeadline(time.Now().Add(tr.timeout))
+	return tr.conn.Read(p)
+}
+
+// syncWithMaster connects to the master of m, loads a full copy of its
+// dataset and then applies the replication stream until the connection
+// fails or the link is closed.
+func (rg *RedisGo) syncWithMaster(m *masterLink) error {
+	m.setState("connecting")
+	conn, err := net.DialTimeout("tcp", m.addr(), replTimeout)
+	if err != nil {
+		return err
+	}
+	if !m.setConn(conn) {
+		return errors.New("link closed")
+	}
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(timeoutReader{conn, replTimeout})
+	w := NewWriter(conn)
+
+	// The handshake. Errors are fatal only for AUTH and PSYNC: a master
+	// requiring a password rejects PING, and one predating REPLCONF
+	// rejects it, but both still serve PSYNC.
+	user, pass := rg.conf.masterCredentials()
+	steps := [][]string{{"ping"}}
+	if pass != "" && user != "" {
+		steps = append(steps, []string{"auth", user, pass})
+	} else if pass != "" {
+		steps = append(steps, []string{"auth", pass})
+	}
+	steps = append(steps,
+		[]string{"replconf", "listening-port", strconv.Itoa(rg.conf.port)},
+		[]string{"replconf", "capa", "psync2"},
+		[]string{"psync", "?", "-1"},
+	)
+	var reply string
+	for _, args := range steps {
+		cmd := newCommand(args...)
+		if err = w.Write(&cmd); err == nil {
+			err = w.Flush()
+		}
+		if err == nil {
+			reply, err = readLine(r, maxInlineLen)
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(reply, "-") && (args[0] == "auth" || args[0] == "psync") {
+			return fmt.Errorf("%s failed: %s", strings.ToUpper(args[0]), reply[1:])
+		}
+	}
+	fields := strings.Fields(reply)
+	if len(fields) != 3 || fields[0] != "+FULLRESYNC" {
+		return fmt.Errorf("unexpected reply to PSYNC: %q", reply)
+	}
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("unexpected reply to PSYNC: %q", reply)
+	}
+
+	m.setState("sync")
+	line, err := readLine(r, maxInlineLen)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(line, "$"), 10, 64)
+	if err != nil || !strings.HasPrefix(line, "$") || size < 0 {
+		return fmt.Errorf("unexpected snapshot header: %q", line)
+	}
+	payload := io.LimitReader(r, size)
+	dbs, err := decodeRDB(payload)
+	if err != nil {
+		return fmt.Errorf("cannot decode snapshot: %w", err)
+	}
+	if _, err = io.Copy(io.Discard, payload); err != nil {
+		return err
+	}
+	if m.stopped() {
+		return errors.New("link closed")
+	}
+	rg.txMu.Lock()
+	rg.loadDbs(dbs)
+	rg.txMu.Unlock()
+	// Our own replicas hold a copy of the dataset just replaced.
+	rg.dropReplicas()
+	if rg.aof != nil {
+		if err := rg.BgRewriteAof(); err != nil {
+			log.Printf("cannot rewrite aof after sync: %v", err)
+		}
+	}
+	m.offset.Store(offset)
+	m.setState("connected")
+	log.Printf("synchronized with master %s at offset %d", m.addr(), offset)
+
+	done := make(chan struct{})
+	defer close(done)
+	go m.ackLoop(w, done)
+
+	c := &Client{authenticated: true, master: true}
+	for {
+		var v Value
+		if err := v.readArray(r, rg.conf.protoLimits()); err != nil {
+			return err
+		}
+		if m.stopped() {
+			return errors.New("link closed")
+		}
+		rg.dispatch(c, &v)
+		m.offset.Add(respLen(&v))
+	}
+}
+
+// ackLoop sends REPLCONF ACK with the processed offset to the master through
+// w every replAckPeriod, until done is closed or the write fails.
+func (m *masterLink) ackLoop(w *Writer, done chan struct{}) {
+	ticker := time.NewTicker(replAckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ack := newCommand("replconf", "ack", strconv.FormatInt(m.offset.Load(), 10))
+			if err := w.Write(&ack); err != nil {
+				return
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds, failing the test with msg if it still
+// doesn't after a few seconds.
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicaFollowsMaster(t *testing.T) {
+	master, replica := newTestServer(t), newTestServer(t)
+	mc, rc := NewClient(1, nil), NewClient(1, nil)
+	do(master, mc, "set", "before", "sync")
+	do(master, mc, "select", "2")
+	do(master, mc, "rpush", "list", "a", "b")
+	do(master, mc, "select", "0")
+	do(replica, rc, "set", "local", "x")
+
+	host, port, err := net.SplitHostPort(listen(t, master))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := do(replica, rc, "replicaof", host, port); reply.Type == Error {
+		t.Fatalf("REPLICAOF = %s", reply.Err)
+	}
+	waitFor(t, "the replica never synchronized", func() bool {
+		info := do(replica, rc, "info", "replication").Bulk
+		return infoField(info, "master_link_status") == "up"
+	})
+
+	// The full synchronization replaced the dataset of the replica.
+	if reply := do(replica, rc, "get", "before"); reply.Bulk != "sync" {
+		t.Errorf("GET before on the replica = %v, want sync", reply)
+	}
+	if reply := do(replica, rc, "exists", "local"); reply.Int != 0 {
+		t.Errorf("the replica kept its own key local")
+	}
+
+	// Writes made after the synchronization are streamed.
+	do(master, mc, "set", "k", "v")
+	do(master, mc, "select", "2")
+	do(master, mc, "lpush", "list", "z")
+	waitFor(t, "SET on the master never reached the replica", func() bool {
+		return do(replica, rc, "get", "k").Bulk == "v"
+	})
+	do(replica, rc, "select", "2")
+	waitFor(t, "LPUSH on the master never reached the replica", func() bool {
+		return do(replica, rc, "llen", "list").Int == 3
+	})
+	do(replica, rc, "select", "0")
+
+	if reply := do(replica, rc, "set", "k", "mine"); reply.Type != Error {
+		t.Errorf("SET on the replica = %v, want READONLY", reply)
+	}
+	if reply := do(master, mc, "role"); reply.Array[0].Bulk != "master" || len(reply.Array[2].Array) != 1 {
+		t.Errorf("ROLE on the master = %v, want one replica", reply)
+	}
+
+	// REPLICAOF NO ONE keeps the data and accepts writes again.
+	do(replica, rc, "replicaof", "no", "one")
+	if reply := do(replica, rc, "set", "k", "mine"); reply.Type == Error {
+		t.Errorf("SET after REPLICAOF NO ONE = %s", reply.Err)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
@@ -18,65 +19,344 @@ const (
 	Integer ValueType = ":"
 	Null    ValueType = ""
 	Error   ValueType = "-"
+
+	// NullArray is the RESP2 null array *-1, used where Redis replies with a
+	// missing aggregate rather than a missing bulk string.
+	NullArray ValueType = "*-1"
+
+	// The RESP3 types below are written as their RESP2 counterparts to
+	// clients that haven't switched protocols with HELLO: a map, set or push
+	// as a flat array, a double or big number as a bulk string and a boolean
+	// as 1 or 0.
+	Map       ValueType = "%"
+	Set       ValueType = "~"
+	Push      ValueType = ">"
+	Double    ValueType = ","
+	Boolean   ValueType = "#"
+	BigNumber ValueType = "("
 )
 
-// Value represents a RESP value.
+// Value represents a RESP value. Int holds Integer values and, as 1 or 0,
+// Boolean ones; Str also holds the digits of a BigNumber. Every aggregate
+// keeps its elements in Array, a Map with its keys and values interleaved.
 type Value struct {
-	Type  ValueType
-	Bulk  string
-	Str   string
-	Int   int64
-	Err   string
-	Array []Value
+	Type   ValueType
+	Bulk   string
+	Str    string
+	Int    int64
+	Double float64
+	Err    string
+	Array  []Value
 }
 
-// readLine reads a line from the reader, trimming the newline character.
-func readLine(r *bufio.Reader) (string, error) {
-	line, err := r.ReadString('\n')
-	if err != nil {
-		return "", err
+// Error messages shared by command handlers.
+const (
+	errSyntax   = "ERR syntax error"
+	errNotInt   = "ERR value is not an integer or out of range"
+	errNotFloat = "ERR value is not a valid float"
+
+	errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+)
+
+// newString returns a simple string value.
+func newString(str string) *Value {
+	return &Value{Type: String, Str: str}
+}
+
+// newOK returns the simple string reply +OK.
+func newOK() *Value {
+	return newString("OK")
+}
+
+// newError returns an error value formatted according to format. The error
+// prefix (ERR, WRONGTYPE, ...) is expected to be part of the message.
+func newError(format string, args ...any) *Value {
+	return &Value{Type: Error, Err: fmt.Sprintf(format, args...)}
+}
+
+// newInteger returns an integer value.
+func newInteger(n int64) *Value {
+	return &Value{Type: Integer, Int: n}
+}
+
+// newBulk returns a bulk string value.
+func newBulk(bulk string) *Value {
+	return &Value{Type: Bulk, Bulk: bulk}
+}
+
+// newNull returns a null bulk value.
+func newNull() *Value {
+	return &Value{Type: Null}
+}
+
+// newNullArray returns a null array value.
+func newNullArray() *Value {
+	return &Value{Type: NullArray}
+}
+
+// newArray returns an array value holding vals.
+func newArray(vals []Value) *Value {
+	return &Value{Type: Array, Array: vals}
+}
+
+// newMap returns a map value holding kvs, a flat list of alternating keys
+// and values.
+func newMap(kvs []Value) *Value {
+	return &Value{Type: Map, Array: kvs}
+}
+
+// newSet returns a set value holding members.
+func newSet(members []Value) *Value {
+	return &Value{Type: Set, Array: members}
+}
+
+// newPush returns an out-of-band push value holding vals, such as a pub/sub
+// message.
+func newPush(vals []Value) *Value {
+	return &Value{Type: Push, Array: vals}
+}
+
+// newDouble returns a double value.
+func newDouble(f float64) *Value {
+	return &Value{Type: Double, Double: f}
+}
+
+// newBool returns a boolean value.
+func newBool(b bool) *Value {
+	if b {
+		return &Value{Type: Boolean, Int: 1}
+	}
+	return &Value{Type: Boolean}
+}
+
+// errProtocol is wrapped by every error caused by a client breaking the
+// protocol, as opposed to the connection failing.
+var errProtocol = errors.New("Protocol error")
+
+// protoErr returns a protocol error described by msg.
+func protoErr(msg string) error {
+	return fmt.Errorf("%w: %s", errProtocol, msg)
+}
+
+// errLineTooLong is returned by readLine for a line over its length limit.
+var errLineTooLong = errors.New("line too long")
+
+// Limits applied to requests so that a client can't make the server allocate
+// unbounded memory just by declaring large lengths, mirroring Redis.
+const (
+	maxInlineLen = 64 * 1024   // maxInlineLen caps inline commands and RESP header lines.
+	maxArrayLen  = 1024 * 1024 // maxArrayLen caps the number of arguments of a command.
+
+	// maxArrayPrealloc caps the arguments allocated up front from a declared
+	// array length; larger arrays grow as their elements actually arrive.
+	maxArrayPrealloc = 1024
+)
+
+// protoLimits holds the request limits that can be changed at runtime.
+type protoLimits struct {
+	// maxBulkLen is the largest bulk string a client may send, set by
+	// proto-max-bulk-len.
+	maxBulkLen int64
+}
+
+// readLine reads a line of at most max bytes from the reader, trimming the
+// newline character. A longer line fails with errLineTooLong as soon as the
+// limit is crossed rather than after buffering all of it.
+func readLine(r *bufio.Reader, max int) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > max+2 {
+			return "", errLineTooLong
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(line), "\r\n"), nil
 	}
-	return strings.TrimSuffix(line, "\r\n"), nil
 }
 
-// readArray reads an array from the reader.
-func (v *Value) readArray(r *bufio.Reader) error {
-	line, err := readLine(r)
+// readArray reads an array from the reader. A line that doesn't start with *
+// is parsed as an inline command instead, as typed into telnet or nc.
+// Declared lengths beyond lim or the fixed limits fail with a protocol error
+// before anything is allocated for them.
+func (v *Value) readArray(r *bufio.Reader, lim protoLimits) error {
+	b, err := r.Peek(1)
 	if err != nil {
 		return err
 	}
-	if len(line) == 0 || line[0] != '*' {
-		return fmt.Errorf("expected array line, got %s", line)
+	if b[0] != '*' {
+		return v.readInline(r)
+	}
+	line, err := readLine(r, maxInlineLen)
+	if errors.Is(err, errLineTooLong) {
+		return protoErr("too big mbulk count string")
 	}
-	arrLen, err := strconv.Atoi(line[1:])
 	if err != nil {
 		return err
 	}
-	v.Array = make([]Value, arrLen)
+	arrLen, err := strconv.Atoi(line[1:])
+	if err != nil || arrLen < -1 || arrLen > maxArrayLen {
+		return protoErr("invalid multibulk length")
+	}
+	v.Array = make([]Value, 0, min(max(arrLen, 0), maxArrayPrealloc))
 
 	for i := 0; i < arrLen; i++ {
-		bulk, err := v.readBulk(r)
+		bulk, err := v.readBulk(r, lim)
 		if err != nil {
 			return err
 		}
-		v.Array[i] = bulk
+		v.Array = append(v.Array, bulk)
 	}
 	v.Type = Array
 	return nil
 }
 
-// readBulk reads a bulk string from the reader.
-func (v *Value) readBulk(r *bufio.Reader) (val Value, err error) {
-	line, err := readLine(r)
+// readInline reads an inline command: a single line of space separated
+// arguments, which may be quoted. Blank lines are skipped.
+func (v *Value) readInline(r *bufio.Reader) error {
+	for {
+		line, err := readLine(r, maxInlineLen)
+		if errors.Is(err, errLineTooLong) {
+			return protoErr("too big inline request")
+		}
+		if err != nil {
+			return err
+		}
+		args, err := splitArgs(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			continue
+		}
+		v.Type, v.Array = Array, bulkValues(args)
+		return nil
+	}
+}
+
+// splitArgs splits an inline command line into arguments the way redis-cli
+// and Redis do. Arguments are separated by whitespace and may be quoted:
+// double quotes support the escapes \n, \r, \t, \b, \a, \xHH and escaping
+// any other character, single quotes only \'. A closing quote must be
+// followed by whitespace or the end of the line.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg strings.Builder
+		var inDouble, inSingle bool
+		for done := false; !done; {
+			switch {
+			case inDouble:
+				if i == len(line) {
+					return nil, protoErr("unbalanced quotes in request")
+				}
+				switch c := line[i]; {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					arg.WriteByte(byte(n))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch e := line[i]; e {
+					case 'n':
+						arg.WriteByte('\n')
+					case 'r':
+						arg.WriteByte('\r')
+					case 't':
+						arg.WriteByte('\t')
+					case 'b':
+						arg.WriteByte('\b')
+					case 'a':
+						arg.WriteByte('\a')
+					default:
+						arg.WriteByte(e)
+					}
+				case c == '"':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protoErr("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+			case inSingle:
+				if i == len(line) {
+					return nil, protoErr("unbalanced quotes in request")
+				}
+				switch c := line[i]; {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					arg.WriteByte('\'')
+					i++
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, protoErr("unbalanced quotes in request")
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+			default:
+				if i == len(line) {
+					done = true
+					break
+				}
+				switch c := line[i]; c {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					arg.WriteByte(c)
+				}
+			}
+			if i < len(line) {
+				i++
+			}
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// isSpace reports whether c separates inline command arguments.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == 0
+}
+
+// isHex reports whether c is a hexadecimal digit.
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// readBulk reads a bulk string of at most lim.maxBulkLen bytes from the
+// reader.
+func (v *Value) readBulk(r *bufio.Reader, lim protoLimits) (val Value, err error) {
+	line, err := readLine(r, maxInlineLen)
+	if errors.Is(err, errLineTooLong) {
+		return val, protoErr("too big bulk count string")
+	}
 	if err != nil {
 		return val, err
 	}
 	if len(line) == 0 || line[0] != '$' {
-		return val, fmt.Errorf("expected bulk line, got %s", line)
+		return val, protoErr(fmt.Sprintf("expected '$', got '%s'", line[:min(len(line), 1)]))
 	}
 	bulkLen, err := strconv.Atoi(line[1:])
-	if err != nil {
-		return val, err
+	if err != nil || bulkLen < -1 || int64(bulkLen) > lim.maxBulkLen {
+		return val, protoErr("invalid bulk length")
 	}
 	if bulkLen == -1 {
 		val.Type = Null
@@ -87,30 +367,52 @@ func (v *Value) readBulk(r *bufio.Reader) (val Value, err error) {
 	if _, err = io.ReadFull(r, buf); err != nil {
 		return val, err
 	}
+	// A wrong terminator means the declared length doesn't match the data,
+	// and reading on would misparse everything after it.
+	if buf[bulkLen] != '\r' || buf[bulkLen+1] != '\n' {
+		return val, protoErr("invalid bulk length terminator")
+	}
 	val.Type, val.Bulk = Bulk, string(buf[:bulkLen])
 
 	return val, nil
 }
 
-// Writer writes RESP values to an io.Writer.
+// Writer writes RESP values to an io.Writer, in RESP2 unless switched to
+// RESP3 by setting proto.
 type Writer struct {
 	writer *bufio.Writer
+
+	// proto is the RESP version negotiated with HELLO, 2 or 3.
+	proto int
+
+	// line is scratch space to format the lines holding a length or an
+	// integer in, so that writing a value doesn't allocate.
+	line [32]byte
 }
 
-// NewWriter returns a new Writer that writes to w.
+// NewWriter returns a new Writer that writes RESP2 to w.
 func NewWriter(w io.Writer) *Writer {
 	return &Writer{
 		writer: bufio.NewWriter(w),
+		proto:  2,
 	}
 }
 
 // Write writes the given val to the writer.
-func (w *Writer) Write(val *Value) (err error) {
+func (w *Writer) Write(val *Value) error {
 	switch val.Type {
 	case String:
-		_, err = fmt.Fprintf(w.writer, "+%s\r\n", val.Str)
-	case Array:
-		_, err = fmt.Fprintf(w.writer, "*%d\r\n", len(val.Array))
+		return w.writeLine('+', val.Str)
+	case Array, Map, Set, Push:
+		var err error
+		switch {
+		case val.Type == Array || w.proto < 3:
+			err = w.writeInt('*', int64(len(val.Array)))
+		case val.Type == Map:
+			err = w.writeInt('%', int64(len(val.Array)/2))
+		default:
+			err = w.writeInt(val.Type[0], int64(len(val.Array)))
+		}
 		if err != nil {
 			return err
 		}
@@ -119,17 +421,78 @@ func (w *Writer) Write(val *Value) (err error) {
 				return err
 			}
 		}
+		return nil
 	case Bulk:
-		_, err = fmt.Fprintf(w.writer, "$%d\r\n%s\r\n", len(val.Bulk), val.Bulk)
+		return w.writeBulk(val.Bulk)
 	case Integer:
-		_, err = fmt.Fprintf(w.writer, ":%d\r\n", val.Int)
-	case Null:
-		_, err = fmt.Fprint(w.writer, "$-1\r\n")
+		return w.writeInt(':', val.Int)
+	case Double:
+		if w.proto >= 3 {
+			return w.writeLine(',', formatScore(val.Double))
+		}
+		return w.writeBulk(formatScore(val.Double))
+	case Boolean:
+		switch {
+		case w.proto < 3:
+			return w.writeInt(':', val.Int)
+		case val.Int != 0:
+			return w.writeString("#t\r\n")
+		default:
+			return w.writeString("#f\r\n")
+		}
+	case BigNumber:
+		if w.proto >= 3 {
+			return w.writeLine('(', val.Str)
+		}
+		return w.writeBulk(val.Str)
+	case Null, NullArray:
+		switch {
+		case w.proto >= 3:
+			return w.writeString("_\r\n")
+		case val.Type == Null:
+			return w.writeString("$-1\r\n")
+		default:
+			return w.writeString("*-1\r\n")
+		}
 	case Error:
-		_, err = fmt.Fprintf(w.writer, "-%s\r\n", val.Err)
+		return w.writeLine('-', val.Err)
 	default:
-		return fmt.Errorf("invalid val type: %s", val.Type)
+		return errors.New("invalid val type: " + string(val.Type))
+	}
+}
+
+// writeInt writes a line of n after the type byte typ, such as the length
+// line of an aggregate or an integer.
+func (w *Writer) writeInt(typ byte, n int64) error {
+	line := append(w.line[:0], typ)
+	line = strconv.AppendInt(line, n, 10)
+	line = append(line, '\r', '\n')
+	_, err := w.writer.Write(line)
+	return err
+}
+
+// writeLine writes a line of str after the type byte typ, such as a simple
+// string or an error.
+func (w *Writer) writeLine(typ byte, str string) error {
+	// bufio.Writer keeps returning the first error, so only the last one
+	// needs checking.
+	_ = w.writer.WriteByte(typ)
+	_, _ = w.writer.WriteString(str)
+	return w.writeString("\r\n")
+}
+
+// writeBulk writes str as a bulk string.
+func (w *Writer) writeBulk(str string) error {
+	if err := w.writeInt('$', int64(len(str))); err != nil {
+		return err
 	}
+	_, _ = w.writer.WriteString(str)
+	return w.writeString("\r\n")
+}
+
+// writeString writes str as is.
+func (w *Writer) writeString(str string) error {
+	_, err := w.writer.WriteString(str)
 	return err
 }
 
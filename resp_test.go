@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWriterGolden(t *testing.T) {
+	tests := []struct {
+		name  string
+		val   *Value
+		resp2 string
+		resp3 string
+	}{
+		{
+			name:  "string",
+			val:   newOK(),
+			resp2: "+OK\r\n",
+			resp3: "+OK\r\n",
+		},
+		{
+			name:  "error",
+			val:   newError("ERR bad %s", "thing"),
+			resp2: "-ERR bad thing\r\n",
+			resp3: "-ERR bad thing\r\n",
+		},
+		{
+			name:  "integer",
+			val:   newInteger(-42),
+			resp2: ":-42\r\n",
+			resp3: ":-42\r\n",
+		},
+		{
+			name:  "integer min",
+			val:   newInteger(math.MinInt64),
+			resp2: ":-9223372036854775808\r\n",
+			resp3: ":-9223372036854775808\r\n",
+		},
+		{
+			name:  "bulk",
+			val:   newBulk("a\x00b\r\n"),
+			resp2: "$5\r\na\x00b\r\n\r\n",
+			resp3: "$5\r\na\x00b\r\n\r\n",
+		},
+		{
+			name:  "empty bulk",
+			val:   newBulk(""),
+			resp2: "$0\r\n\r\n",
+			resp3: "$0\r\n\r\n",
+		},
+		{
+			name:  "null",
+			val:   newNull(),
+			resp2: "$-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			name:  "null array",
+			val:   newNullArray(),
+			resp2: "*-1\r\n",
+			resp3: "_\r\n",
+		},
+		{
+			name:  "array",
+			val:   newArray([]Value{*newBulk("a"), *newInteger(1), *newNull()}),
+			resp2: "*3\r\n$1\r\na\r\n:1\r\n$-1\r\n",
+			resp3: "*3\r\n$1\r\na\r\n:1\r\n_\r\n",
+		},
+		{
+			name:  "empty array",
+			val:   newArray(nil),
+			resp2: "*0\r\n",
+			resp3: "*0\r\n",
+		},
+		{
+			name:  "nested array",
+			val:   newArray([]Value{*newArray([]Value{*newString("x")})}),
+			resp2: "*1\r\n*1\r\n+x\r\n",
+			resp3: "*1\r\n*1\r\n+x\r\n",
+		},
+		{
+			name:  "map",
+			val:   newMap([]Value{*newBulk("k"), *newInteger(1), *newBulk("l"), *newBulk("v")}),
+			resp2: "*4\r\n$1\r\nk\r\n:1\r\n$1\r\nl\r\n$1\r\nv\r\n",
+			resp3: "%2\r\n$1\r\nk\r\n:1\r\n$1\r\nl\r\n$1\r\nv\r\n",
+		},
+		{
+			name:  "set",
+			val:   newSet([]Value{*newBulk("m")}),
+			resp2: "*1\r\n$1\r\nm\r\n",
+			resp3: "~1\r\n$1\r\nm\r\n",
+		},
+		{
+			name:  "push",
+			val:   newPush([]Value{*newBulk("message"), *newBulk("ch"), *newBulk("hi")}),
+			resp2: "*3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n",
+			resp3: ">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n",
+		},
+		{
+			name:  "double",
+			val:   newDouble(1.5),
+			resp2: "$3\r\n1.5\r\n",
+			resp3: ",1.5\r\n",
+		},
+		{
+			name:  "double inf",
+			val:   newDouble(math.Inf(-1)),
+			resp2: "$4\r\n-inf\r\n",
+			resp3: ",-inf\r\n",
+		},
+		{
+			name:  "boolean true",
+			val:   newBool(true),
+			resp2: ":1\r\n",
+			resp3: "#t\r\n",
+		},
+		{
+			name:  "boolean false",
+			val:   newBool(false),
+			resp2: ":0\r\n",
+			resp3: "#f\r\n",
+		},
+		{
+			name:  "big number",
+			val:   &Value{Type: BigNumber, Str: "3492890328409238509324850943850943825024385"},
+			resp2: "$43\r\n3492890328409238509324850943850943825024385\r\n",
+			resp3: "(3492890328409238509324850943850943825024385\r\n",
+		},
+	}
+	for _, tt := range tests {
+		for proto, want := range map[int]string{2: tt.resp2, 3: tt.resp3} {
+			var b strings.Builder
+			w := NewWriter(&b)
+			w.proto = proto
+			if err := w.Write(tt.val); err != nil {
+				t.Fatalf("%s in RESP%d: %v", tt.name, proto, err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != want {
+				t.Errorf("%s in RESP%d: got %q, want %q", tt.name, proto, got, want)
+			}
+		}
+	}
+}
+
+func TestWriterInvalidType(t *testing.T) {
+	w := NewWriter(io.Discard)
+	if err := w.Write(&Value{Type: "?"}); err == nil {
+		t.Error("writing an invalid type succeeded")
+	}
+}
+
+func BenchmarkWriteArray(b *testing.B) {
+	vals := make([]Value, 100)
+	for i := range vals {
+		vals[i] = *newBulk("value:" + strconv.Itoa(i))
+	}
+	reply := newArray(vals)
+	w := NewWriter(io.Discard)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := w.Write(reply); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "scan", handler: scan, arity: -2},
+		&Command{name: "hscan", handler: hscan, arity: -3, keys: oneKey},
+		&Command{name: "sscan", handler: sscan, arity: -3, keys: oneKey},
+		&Command{name: "zscan", handler: zscan, arity: -3, keys: oneKey},
+	)
+}
+
+// scanHash maps name to its position in the cursor space. Iterating in hash
+// order rather than insertion or lexical order means a cursor stays valid
+// while the collection is modified between calls: every element present for
+// the whole iteration is returned at least once. The result is never 0, which
+// is reserved for the start and end of an iteration.
+//
+// The hash is FNV-1a, which only mixes the last bytes of name into the low
+// bits, followed by the finalizer of MurmurHash3 so that the top bits, which
+// select the shard of a key, depend on every byte.
+func scanHash(name string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		h ^= uint64(name[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h>>1 | 1
+}
+
+// scanPage returns the names whose scanHash is at or after cursor, in hash
+// order, stopping after roughly count names. It returns the cursor to resume
+// from, 0 once the iteration is complete. Names sharing a hash are always
+// returned together so that none is skipped.
+func scanPage(names []string, cursor uint64, count int) ([]string, uint64) {
+	type hashed struct {
+		name string
+		hash uint64
+	}
+	pending := make([]hashed, 0)
+	for _, name := range names {
+		if h := scanHash(name); h >= cursor {
+			pending = append(pending, hashed{name: name, hash: h})
+		}
+	}
+	slices.SortFunc(pending, func(a, b hashed) int {
+		return cmp.Compare(a.hash, b.hash)
+	})
+	page := make([]string, 0, min(count, len(pending)))
+	for i, p := range pending {
+		if len(page) >= count && p.hash != pending[i-1].hash {
+			return page, p.hash
+		}
+		page = append(page, p.name)
+	}
+	return page, 0
+}
+
+// scanOpts holds the parsed options shared by the SCAN family.
+type scanOpts struct {
+	cursor uint64
+	match  string
+	count  int
+	kind   string // kind filters SCAN by type name, empty for any
+}
+
+// parseScanOpts parses cursor [MATCH pattern] [COUNT count], plus [TYPE type]
+// if allowType is set.
+func parseScanOpts(args []Value, allowType bool) (scanOpts, *Value) {
+	opts := scanOpts{match: "*", count: 10}
+
+	cursor, err := strconv.ParseUint(args[0].Bulk, 10, 64)
+	if err != nil {
+		return opts, newError("ERR invalid cursor")
+	}
+	opts.cursor = cursor
+
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return opts, newError(errSyntax)
+		}
+		switch strings.ToUpper(args[i].Bulk) {
+		case "MATCH":
+			opts.match = args[i+1].Bulk
+		case "COUNT":
+			n, err := strconv.Atoi(args[i+1].Bulk)
+			if err != nil {
+				return opts, newError(errNotInt)
+			}
+			if n < 1 {
+				return opts, newError(errSyntax)
+			}
+			opts.count = n
+		case "TYPE":
+			if !allowType {
+				return opts, newError(errSyntax)
+			}
+			opts.kind = strings.ToLower(args[i+1].Bulk)
+		default:
+			return opts, newError(errSyntax)
+		}
+	}
+	return opts, nil
+}
+
+// scanReply builds the two-element reply of the SCAN family.
+func scanReply(cursor uint64, elems []Value) *Value {
+	return newArray([]Value{
+		{Type: Bulk, Bulk: strconv.FormatUint(cursor, 10)},
+		{Type: Array, Array: elems},
+	})
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+func scan(c *Client, v *Value, rg *RedisGo) *Value {
+	opts, errv := parseScanOpts(v.Array[1:], true)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	db.rwm.RLock()
+	defer db.rwm.RUnlock()
+
+	// The top bits of the cursor select the shard, so the page is made of
+	// the keys of the shards from the cursor's on, read locked in turn until
+	// they hold enough keys. The cursor then resumes within the last shard
+	// read, or at the start of the next one.
+	names := make([]string, 0)
+	last := numShards - 1
+	for i := int(opts.cursor >> (63 - shardBits)); i < numShards; i++ {
+		s := &db.shards[i]
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for key := range s.store {
+			names = append(names, key)
+		}
+		if len(names) > opts.count {
+			last = i
+			break
+		}
+	}
+	page, next := scanPage(names, opts.cursor, opts.count)
+	if next == 0 && last < numShards-1 {
+		next = uint64(last+1) << (63 - shardBits)
+	}
+
+	elems := make([]Value, 0, len(page))
+	for _, key := range page {
+		item := db.peek(key)
+		if item == nil || !globMatch(opts.match, key) {
+			continue
+		}
+		if opts.kind != "" && item.Kind.String() != opts.kind {
+			continue
+		}
+		elems = append(elems, Value{Type: Bulk, Bulk: key})
+	}
+	return scanReply(next, elems)
+}
+
+// scanCollection pages through the names of a collection of size n. Small
+// collections are returned in one pass with cursor 0, like Redis does for
+// listpack encoded values.
+func scanCollection(names func() []string, n int, opts scanOpts) ([]string, uint64) {
+	all := names()
+	if n <= listpackMaxLen {
+		return all, 0
+	}
+	return scanPage(all, opts.cursor, opts.count)
+}
+
+// hscan implements HSCAN key cursor [MATCH pattern] [COUNT count], replying
+// with field-value pairs.
+func hscan(c *Client, v *Value, rg *RedisGo) *Value {
+	opts, errv := parseScanOpts(v.Array[2:], false)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindHash)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return scanReply(0, []Value{})
+	}
+	page, next := scanCollection(func() []string {
+		fields := make([]string, 0, len(item.Hash))
+		for field := range item.Hash {
+			fields = append(fields, field)
+		}
+		return fields
+	}, len(item.Hash), opts)
+
+	elems := make([]Value, 0, 2*len(page))
+	for _, field := range page {
+		if globMatch(opts.match, field) {
+			elems = append(elems, Value{Type: Bulk, Bulk: field}, Value{Type: Bulk, Bulk: item.Hash[field]})
+		}
+	}
+	return scanReply(next, elems)
+}
+
+// sscan implements SSCAN key cursor [MATCH pattern] [COUNT count].
+func sscan(c *Client, v *Value, rg *RedisGo) *Value {
+	opts, errv := parseScanOpts(v.Array[2:], false)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return scanReply(0, []Value{})
+	}
+	page, next := scanCollection(func() []string {
+		members := make([]string, 0, len(item.Set))
+		for member := range item.Set {
+			members = append(members, member)
+		}
+		return members
+	}, len(item.Set), opts)
+
+	elems := make([]Value, 0, len(page))
+	for _, member := range page {
+		if globMatch(opts.match, member) {
+			elems = append(elems, Value{Type: Bulk, Bulk: member})
+		}
+	}
+	return scanReply(next, elems)
+}
+
+// zscan implements ZSCAN key cursor [MATCH pattern] [COUNT count], replying
+// with member-score pairs.
+func zscan(c *Client, v *Value, rg *RedisGo) *Value {
+	opts, errv := parseScanOpts(v.Array[2:], false)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return scanReply(0, []Value{})
+	}
+	page, next := scanCollection(func() []string {
+		members := make([]string, 0, item.ZSet.Len())
+		for _, entry := range item.ZSet.Entries {
+			members = append(members, entry.Member)
+		}
+		return members
+	}, item.ZSet.Len(), opts)
+
+	elems := make([]Value, 0, 2*len(page))
+	for _, member := range page {
+		if globMatch(opts.match, member) {
+			score, _ := item.ZSet.Score(member)
+			elems = append(elems, Value{Type: Bulk, Bulk: member}, Value{Type: Bulk, Bulk: formatScore(score)})
+		}
+	}
+	return scanReply(next, elems)
+}
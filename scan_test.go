@@ -0,0 +1,120 @@
+package main
+
+import (
+	"maps"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scanAll runs the SCAN family command cmd over key until the cursor comes
+// back to 0, passing the extra args to every call. It returns the counts of
+// the names replied, with the values of pairs skipped, and the number of
+// calls made.
+func scanAll(t *testing.T, rg *RedisGo, c *Client, cmd, key string, pairs bool, args ...string) (map[string]int, int) {
+	t.Helper()
+	seen := map[string]int{}
+	cursor := "0"
+	for calls := 1; ; calls++ {
+		if calls > 1000 {
+			t.Fatalf("%s %s did not terminate", cmd, key)
+		}
+		reply := do(rg, c, append([]string{cmd, key, cursor}, args...)...)
+		if reply.Type != Array || len(reply.Array) != 2 {
+			t.Fatalf("%s %s %s = %v", cmd, key, cursor, reply)
+		}
+		step := 1
+		if pairs {
+			step = 2
+		}
+		for i := 0; i < len(reply.Array[1].Array); i += step {
+			seen[reply.Array[1].Array[i].Bulk]++
+		}
+		if cursor = reply.Array[0].Bulk; cursor == "0" {
+			return seen, calls
+		}
+	}
+}
+
+// scanNames returns n names made of prefix and an index.
+func scanNames(prefix string, n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = prefix + strconv.Itoa(i)
+	}
+	return names
+}
+
+func TestCollectionScans(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	fill := map[string]func(key string, names []string){
+		"hscan": func(key string, names []string) {
+			args := []string{"hset", key}
+			for _, name := range names {
+				args = append(args, name, "v")
+			}
+			do(rg, c, args...)
+		},
+		"sscan": func(key string, names []string) {
+			do(rg, c, append([]string{"sadd", key}, names...)...)
+		},
+		"zscan": func(key string, names []string) {
+			args := []string{"zadd", key}
+			for i, name := range names {
+				args = append(args, strconv.Itoa(i), name)
+			}
+			do(rg, c, args...)
+		},
+	}
+	for cmd, fill := range fill {
+		pairs := cmd != "sscan"
+		// Both sides of listpackMaxLen, so that paging is covered too.
+		for _, n := range []int{10, 3 * listpackMaxLen} {
+			key := cmd + ":" + strconv.Itoa(n)
+			names := append(scanNames("a", n), scanNames("b", n)...)
+			fill(key, names)
+
+			seen, calls := scanAll(t, rg, c, cmd, key, pairs, "count", "20")
+			want := map[string]int{}
+			for _, name := range names {
+				want[name] = 1
+			}
+			if !maps.Equal(seen, want) {
+				t.Errorf("%s of %d names replied %d distinct names, want each once", cmd, 2*n, len(seen))
+			}
+			if n <= listpackMaxLen && calls != 1 {
+				t.Errorf("%s of %d names took %d calls, want 1", cmd, 2*n, calls)
+			}
+			if n > listpackMaxLen && calls < 2 {
+				t.Errorf("%s of %d names with COUNT 20 took %d call, want it paged", cmd, 2*n, calls)
+			}
+
+			seen, _ = scanAll(t, rg, c, cmd, key, pairs, "match", "a*", "count", "20")
+			for name := range seen {
+				if !strings.HasPrefix(name, "a") {
+					t.Errorf("%s MATCH a* replied %q", cmd, name)
+				}
+			}
+			if len(seen) != n {
+				t.Errorf("%s MATCH a* replied %d names, want %d", cmd, len(seen), n)
+			}
+		}
+	}
+}
+
+func TestCollectionScanPairs(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "hset", "h", "f", "v")
+	do(rg, c, "zadd", "z", "1.5", "m")
+	if reply := do(rg, c, "hscan", "h", "0"); len(reply.Array[1].Array) != 2 || reply.Array[1].Array[1].Bulk != "v" {
+		t.Errorf("HSCAN h 0 = %v, want [0 [f v]]", reply)
+	}
+	if reply := do(rg, c, "zscan", "z", "0"); len(reply.Array[1].Array) != 2 || reply.Array[1].Array[1].Bulk != "1.5" {
+		t.Errorf("ZSCAN z 0 = %v, want [0 [m 1.5]]", reply)
+	}
+	if reply := do(rg, c, "sscan", "missing", "0"); reply.Array[0].Bulk != "0" || len(reply.Array[1].Array) != 0 {
+		t.Errorf("SSCAN missing 0 = %v, want [0 []]", reply)
+	}
+}
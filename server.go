@@ -1,65 +1,434 @@
 package main
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-// RDbStats tracks redis's persistence activity.
+func init() {
+	register(
+		&Command{name: "shutdown", handler: shutdown, arity: -1, noMulti: true},
+	)
+}
+
+// RDbStats tracks redis's persistence activity. Saves complete on background
+// goroutines, hence atomic.
 type RDbStats struct {
-	lastSaveTs int64
-	saves      int
+	lastSaveTs atomic.Int64
+	saves      atomic.Int64
 }
 
-// AofStats tracks AOF's persistence activity.
+// AofStats tracks AOF's persistence activity. Rewrites complete on background
+// goroutines, hence atomic.
 type AofStats struct {
-	rewrites int
+	rewrites atomic.Int64
+	baseSize atomic.Int64 // baseSize is the AOF size at startup or after the last rewrite.
 }
 
-// GeneralStats tracks server-wide command and connection activity.
+// GeneralStats tracks server-wide command and connection activity. Counters
+// are updated from every client goroutine, hence atomic.
 type GeneralStats struct {
-	totalConnections int
-	expiredKeys      int
-	evictedKeys      int
-	totalCommands    int
+	totalConnections atomic.Int64
+	expiredKeys      atomic.Int64
+	evictedKeys      atomic.Int64
+	totalCommands    atomic.Int64
+	rejectedConns    atomic.Int64
+}
+
+// reset zeroes the counters, as CONFIG RESETSTAT does.
+func (s *GeneralStats) reset() {
+	s.totalConnections.Store(0)
+	s.expiredKeys.Store(0)
+	s.evictedKeys.Store(0)
+	s.totalCommands.Store(0)
+	s.rejectedConns.Store(0)
+}
+
+// CommandStats tracks the executions of a single command, as reported by INFO
+// commandstats. Counters are updated from every client goroutine, hence
+// atomic.
+type CommandStats struct {
+	calls    atomic.Int64 // calls counts the executions, failed ones included.
+	duration atomic.Int64 // duration is the total execution time, in nanoseconds.
+	rejected atomic.Int64 // rejected counts the calls refused before executing.
+	failed   atomic.Int64 // failed counts the executions replying with an error.
+}
+
+// reset zeroes the counters, as CONFIG RESETSTAT does.
+func (s *CommandStats) reset() {
+	s.calls.Store(0)
+	s.duration.Store(0)
+	s.rejected.Store(0)
+	s.failed.Store(0)
 }
 
 // RedisGo is the single shared state for the server. One instance exists per
 // running server and is passed to every handler. Fields are not individually
-// synchronized — callers are responsible for holding db.rwm where needed.
+// synchronized — callers are responsible for locking the keys of a db where needed.
 type RedisGo struct {
-	redisDb *RedisDb
-	conf    *Config
-	// aof  *Aof
+	dbs  []*RedisDb // dbs holds the logical databases, selected per client by index
+	conf *Config
+	aof  *Aof // aof is the append only file, nil unless appendonly is enabled
+
+	// monitors holds the clients that ran MONITOR, guarded by monitorsMu.
+	monitors   []*Client
+	monitorsMu sync.RWMutex
+
+	startedAt time.Time
+
+	// clients holds every connected client keyed by id, guarded by clientsMu.
+	clients      map[int64]*Client
+	clientsMu    sync.Mutex
+	clientCount  int
+	nextClientID atomic.Int64
+
+	// blockedClients counts the clients blocked in BLPOP, BRPOP or XREAD.
+	blockedClients atomic.Int64
+
+	peakMem       atomic.Uint64 // peakMem is the highest memory usage observed, in bytes.
+	inCompaction  atomic.Bool   // true if the server is currently running Aof compaction.
+	inRdbSnapshot atomic.Bool   // true if the server is currently snapshotting Rdb.
+	loading       bool          // true while the dataset is being loaded at startup.
+
+	// activeExpireOff pauses the active expiry cycle, as set by DEBUG
+	// SET-ACTIVE-EXPIRE 0. Expired keys are still deleted when accessed.
+	activeExpireOff atomic.Bool
+
+	// txMu is held for reading by every command and for writing by EXEC, so
+	// that a transaction runs without other commands interleaving.
+	txMu sync.RWMutex
+
+	// rng is the source of randomness for commands such as SPOP, guarded by
+	// rngMu. Tests may replace it with a fixed seed for determinism.
+	rng   *rand.Rand
+	rngMu sync.Mutex
+
+	pubsub PubSub
+
+	// acl holds the users clients authenticate as.
+	acl *ACL
 
-	// monitors []*Client
-	startedAt     time.Time
-	clientCount   int
-	peakMem       uint64
-	inCompaction  bool // true if the server is currently running Aof compaction.
-	inRdbSnapshot bool // true if the server is currently snapshotting Rdb.
+	// repl is the replication stream of the write commands executed.
+	repl replStream
 
-	// todo: check if operations on redisDb can be transferred to rdbCopy.
-	rdbCopy map[string]*Item
+	// master is the link to the master this server replicates, nil unless
+	// it is a replica. masterMu serializes changes to it.
+	master   atomic.Pointer[masterLink]
+	masterMu sync.Mutex
+
+	// slowlog records the commands that ran longer than
+	// slowlog-log-slower-than.
+	slowlog slowLog
+
+	// latency records the pauses that lasted longer than
+	// latency-monitor-threshold.
+	latency latencyMonitor
+
+	// rdbCopy is the point-in-time copy of every database that a running
+	// BGSAVE is writing out, nil otherwise.
+	rdbCopy []map[string]*Item
+
+	// dirty counts the write commands executed since the last successful
+	// save, driving the save points configured with the save directive.
+	dirty atomic.Int64
 
 	rbdState RDbStats
 	aofStats AofStats
 	genStats GeneralStats
+
+	// cmdStats holds the stats of every command keyed by name. The map is
+	// filled in when the server is created and never modified.
+	cmdStats map[string]*CommandStats
 }
 
-// NewRedisGo initializes a new RedisGo server from conf. If Aof is enabled,
-// the Aof file is opened and EverySec fsync goroutine is started if configured.
-func NewRedisGo(conf *Config) *RedisGo {
+// NewRedisGo initializes a new RedisGo server from conf, loads the dataset and
+// starts the background goroutines. If Aof is enabled, the Aof file is
+// replayed and opened for appending and EverySec fsync goroutine is started if
+// configured; otherwise the RDB file is loaded if there is one.
+func NewRedisGo(conf *Config) (*RedisGo, error) {
 	server := &RedisGo{
-		redisDb:   NewRedisDb(),
+		dbs:       make([]*RedisDb, conf.databases),
 		conf:      conf,
 		startedAt: time.Now(),
+		clients:   make(map[int64]*Client),
+		cmdStats:  make(map[string]*CommandStats, len(commands)),
+		acl:       newACL(conf.password),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		pubsub: PubSub{
+			channels: make(map[string]map[*Client]struct{}),
+			patterns: make(map[string]map[*Client]struct{}),
+		},
+	}
+	for name := range commands {
+		server.cmdStats[name] = &CommandStats{}
+	}
+	server.repl.id, server.repl.db = newReplID(), -1
+	// Like Redis, the save points count from startup until the first save.
+	server.rbdState.lastSaveTs.Store(server.startedAt.Unix())
+	for i := range server.dbs {
+		server.dbs[i] = NewRedisDb(i)
+		server.dbs[i].onExpire = func(key string) {
+			server.genStats.expiredKeys.Add(1)
+			server.queueExpired(i, key)
+		}
+		server.dbs[i].onEvent = func(class notifyClass, event, key string) {
+			server.notifyKeyspaceEvent(i, class, event, key)
+		}
 	}
 	if conf.aofEnabled {
-		// todo: create a new aof, and sync EverySec in a goroutine.
+		// The AOF is the more complete record, so when enabled it is
+		// replayed instead of loading the RDB.
+		path := server.aofPath()
+		if err := server.loadAof(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		aof, err := NewAof(path, conf.aofFsync)
+		if err != nil {
+			return nil, err
+		}
+		server.aof = aof
+		size, err := aof.Size()
+		if err != nil {
+			return nil, err
+		}
+		server.aofStats.baseSize.Store(size)
+	} else {
+		path := server.rdbPath()
+		if err := server.LoadRDB(path); err == nil {
+			log.Printf("db loaded from disk: %q", path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("cannot load rdb: %v", err)
+		}
+	}
+	go server.activeExpire()
+	go server.replPingLoop()
+	if conf.masterHost != "" {
+		server.startReplication(conf.masterHost, conf.masterPort)
+	}
+	if len(conf.rdb) > 0 {
+		go server.saveCron()
 	}
-	return server
+	if server.aof != nil {
+		if conf.aofFsync == EverySec {
+			go server.aofSyncLoop()
+		}
+		go server.aofRewriteCron()
+	}
+	return server, nil
 }
 
 // sample is a key-value pair used during eviction candidate selection.
 type sample struct {
 	key string
 	val *Item
+	// expiration is the expiry of val when sampled, copied under the shard
+	// lock since EXPIRE may change it once the lock is released.
+	expiration time.Time
+}
+
+// updatePeakMem raises peakMem to the current memory usage if it is higher.
+// It is called after commands execute rather than polled, and uses a CAS loop
+// since commands on different clients finish concurrently.
+func (rg *RedisGo) updatePeakMem() {
+	used := rg.memUsed()
+	for {
+		peak := rg.peakMem.Load()
+		if used <= peak || rg.peakMem.CompareAndSwap(peak, used) {
+			return
+		}
+	}
+}
+
+// db returns the database currently selected by client c.
+func (rg *RedisGo) db(c *Client) *RedisDb {
+	return rg.dbs[c.dbIndex]
+}
+
+// randIntn returns a pseudo-random number in [0, n) from the server's rng.
+func (rg *RedisGo) randIntn(n int) int {
+	rg.rngMu.Lock()
+	defer rg.rngMu.Unlock()
+
+	return rg.rng.Intn(n)
+}
+
+// addClient registers a new client for conn. If the server is already shutting
+// down, or maxclients clients are connected already, the connection is closed
+// and nil is returned.
+func (rg *RedisGo) addClient(conn net.Conn) *Client {
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	select {
+	case <-rg.conf.quit:
+		_ = conn.Close()
+		return nil
+	default:
+	}
+	if rg.clientCount >= rg.conf.maxClientsLimit() {
+		rg.genStats.rejectedConns.Add(1)
+		go rejectConn(conn, "ERR max number of clients reached")
+		return nil
+	}
+	c := NewClient(rg.nextClientID.Add(1), conn)
+	// Clients connecting while no password is needed stay authenticated as
+	// the default user if one is set later.
+	c.user, c.authenticated = rg.acl.defaultUser(), !rg.acl.authRequired()
+	rg.clients[c.id] = c
+	rg.clientCount++
+	return c
+}
+
+// rejectConn replies to the client on conn with the error msg and closes the
+// connection, for connections refused before they became clients. The reply
+// is best effort and bounded in time.
+func rejectConn(conn net.Conn, msg string) {
+	_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+	w := NewWriter(conn)
+	if err := w.Write(newError("%s", msg)); err == nil {
+		_ = w.Flush()
+	}
+	_ = conn.Close()
+}
+
+// removeClient unregisters c and closes its connection.
+func (rg *RedisGo) removeClient(c *Client) {
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	if _, ok := rg.clients[c.id]; ok {
+		delete(rg.clients, c.id)
+		rg.clientCount--
+		close(c.done)
+	}
+	c.unwatchAll()
+	rg.pubsub.unsubscribeAll(c)
+	rg.removeMonitor(c)
+	rg.removeReplica(c)
+	_ = c.conn.Close()
+}
+
+// drainClients expires the read deadline of every connected client so that
+// each finishes its in-flight command, writes the reply and then disconnects.
+func (rg *RedisGo) drainClients() {
+	rg.clientsMu.Lock()
+	defer rg.clientsMu.Unlock()
+
+	for _, c := range rg.clients {
+		_ = c.conn.SetReadDeadline(time.Now())
+	}
+}
+
+// setKeepalive enables TCP keepalive probes on conn every period, or disables
+// them if period is 0.
+func setKeepalive(conn net.Conn, period time.Duration) {
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if err := tc.SetKeepAlive(period > 0); err != nil {
+		log.Printf("cannot set keepalive: %v", err)
+		return
+	}
+	if period > 0 {
+		_ = tc.SetKeepAlivePeriod(period)
+	}
+}
+
+// shutdown implements SHUTDOWN [NOSAVE|SAVE], stopping the server once every
+// client is served. The dataset is saved first with SAVE, or by default when
+// save points are configured; if that fails the server keeps running. On
+// success the connection is closed without a reply.
+func shutdown(c *Client, v *Value, rg *RedisGo) *Value {
+	doSave := len(rg.conf.rdb) > 0
+	for _, arg := range v.Array[1:] {
+		switch strings.ToUpper(arg.Bulk) {
+		case "NOSAVE":
+			doSave = false
+		case "SAVE":
+			doSave = true
+		default:
+			return newError(errSyntax)
+		}
+	}
+	if doSave {
+		log.Println("saving the final RDB snapshot before exiting")
+		err := rg.SaveRDB(rg.rdbPath())
+		// A background save would not finish in time; wait it out and
+		// write a fresh snapshot instead.
+		for errors.Is(err, errSaveInProgress) {
+			time.Sleep(100 * time.Millisecond)
+			err = rg.SaveRDB(rg.rdbPath())
+		}
+		if err != nil {
+			log.Printf("error trying to save the db, can't exit: %v", err)
+			return newError("ERR Errors trying to SHUTDOWN. Check logs.")
+		}
+	}
+	log.Println("user requested shutdown")
+	rg.conf.shutdown()
+	c.closeAfterReply = true
+	return nil
+}
+
+// server listens on conf.port and serves every accepted connection on its own
+// goroutine until conf.quit is closed. On shutdown the listener is closed and
+// in-flight connections are drained before server returns nil.
+func server(conf *Config) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", conf.port))
+	if err != nil {
+		return fmt.Errorf("cannot listen on port %d: %w", conf.port, err)
+	}
+	rg, err := NewRedisGo(conf)
+	if err != nil {
+		_ = ln.Close()
+		return err
+	}
+	log.Printf("listening on port %d", conf.port)
+
+	go func() {
+		<-conf.quit
+		_ = ln.Close()
+		rg.drainClients()
+	}()
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-conf.quit:
+				wg.Wait()
+				if rg.aof != nil {
+					if err := rg.aof.Close(); err != nil {
+						log.Printf("cannot close aof: %v", err)
+					}
+				}
+				return nil
+			default:
+			}
+			log.Printf("cannot accept connection: %v", err)
+			continue
+		}
+		rg.genStats.totalConnections.Add(1)
+		setKeepalive(conn, rg.conf.keepalivePeriod())
+
+		c := rg.addClient(conn)
+		if c == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.serve(rg)
+		}()
+	}
 }
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "sadd", handler: sadd, arity: -3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "srem", handler: srem, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "smembers", handler: smembers, arity: 2, keys: oneKey},
+		&Command{name: "sismember", handler: sismember, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "scard", handler: scard, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "sinter", handler: sinter, arity: -2, keys: allKeys},
+		&Command{name: "sunion", handler: sunion, arity: -2, keys: allKeys},
+		&Command{name: "sdiff", handler: sdiff, arity: -2, keys: allKeys},
+		&Command{name: "sintercard", handler: sinterCard, arity: -3, numKeys: 1},
+		&Command{name: "sinterstore", handler: sinterStore, arity: -3, keys: allKeys, isWrite: true, denyOOM: true},
+		&Command{name: "sunionstore", handler: sunionStore, arity: -3, keys: allKeys, isWrite: true, denyOOM: true},
+		&Command{name: "sdiffstore", handler: sdiffStore, arity: -3, keys: allKeys, isWrite: true, denyOOM: true},
+		&Command{name: "spop", handler: spop, arity: -2, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "srandmember", handler: srandMember, arity: -2, keys: oneKey, fast: true},
+	)
+}
+
+// newSetItem returns a KindSet item holding members.
+func newSetItem(members map[string]struct{}) *Item {
+	return &Item{Kind: KindSet, Set: members}
+}
+
+// setMembers converts the members of set into an array of bulk values in no
+// particular order.
+func setMembers(set map[string]struct{}) []Value {
+	vals := make([]Value, 0, len(set))
+	for member := range set {
+		vals = append(vals, Value{Type: Bulk, Bulk: member})
+	}
+	return vals
+}
+
+// sadd implements SADD key member [member ...], replying with the number of
+// members that were not already in the set.
+func sadd(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		item = newSetItem(make(map[string]struct{}))
+		db.put(key, item)
+	}
+	var added int64
+	for _, arg := range v.Array[2:] {
+		if _, ok := item.Set[arg.Bulk]; ok {
+			continue
+		}
+		item.Set[arg.Bulk] = struct{}{}
+		db.memUsed.Add(memberMemUsage(arg.Bulk))
+		added++
+	}
+	if added > 0 {
+		db.notify(notifySet, "sadd", key)
+	}
+	return newInteger(added)
+}
+
+// srem implements SREM key member [member ...], replying with the number of
+// members removed. A set left empty is deleted.
+func srem(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	var removed int64
+	for _, arg := range v.Array[2:] {
+		if _, ok := item.Set[arg.Bulk]; !ok {
+			continue
+		}
+		delete(item.Set, arg.Bulk)
+		db.subMem(memberMemUsage(arg.Bulk))
+		removed++
+	}
+	if removed > 0 {
+		db.notify(notifySet, "srem", key)
+	}
+	if len(item.Set) == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return newInteger(removed)
+}
+
+// smembers implements SMEMBERS key.
+func smembers(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newSet([]Value{})
+	}
+	return newSet(setMembers(item.Set))
+}
+
+// sismember implements SISMEMBER key member.
+func sismember(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	if _, ok := item.Set[v.Array[2].Bulk]; !ok {
+		return newInteger(0)
+	}
+	return newInteger(1)
+}
+
+// scard implements SCARD key.
+func scard(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(len(item.Set)))
+}
+
+// setOp is a set algebra operation.
+type setOp int
+
+const (
+	setInter setOp = iota
+	setUnion
+	setDiff
+)
+
+// combineSets applies op to the sets stored at keys in order, treating missing
+// keys as empty sets. The caller must hold the shards of the keys.
+func combineSets(db *RedisDb, keys []string, op setOp) (map[string]struct{}, *Value) {
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		item, errv := db.peekTyped(key, KindSet)
+		if errv != nil {
+			return nil, errv
+		}
+		if item != nil {
+			sets[i] = item.Set
+		}
+	}
+	result := make(map[string]struct{})
+	switch op {
+	case setInter:
+		for member := range sets[0] {
+			inAll := true
+			for _, set := range sets[1:] {
+				if _, ok := set[member]; !ok {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result[member] = struct{}{}
+			}
+		}
+	case setUnion:
+		for _, set := range sets {
+			for member := range set {
+				result[member] = struct{}{}
+			}
+		}
+	case setDiff:
+		for member := range sets[0] {
+			result[member] = struct{}{}
+		}
+		for _, set := range sets[1:] {
+			for member := range set {
+				delete(result, member)
+			}
+		}
+	}
+	return result, nil
+}
+
+// sinter implements SINTER key [key ...].
+func sinter(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpGeneric(c, v, rg, setInter)
+}
+
+// sunion implements SUNION key [key ...].
+func sunion(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpGeneric(c, v, rg, setUnion)
+}
+
+// sdiff implements SDIFF key [key ...].
+func sdiff(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpGeneric(c, v, rg, setDiff)
+}
+
+// setOpGeneric replies with the members resulting from applying op to the
+// sets given as arguments.
+func setOpGeneric(c *Client, v *Value, rg *RedisGo, op setOp) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(bulkArgs(v.Array[1:])...)
+	defer unlock()
+
+	result, errv := combineSets(db, bulkArgs(v.Array[1:]), op)
+	if errv != nil {
+		return errv
+	}
+	return newSet(setMembers(result))
+}
+
+// sinterCard implements SINTERCARD numkeys key [key ...] [LIMIT limit],
+// replying with the cardinality of the intersection. Counting stops once
+// limit members are found; a limit of 0 means no limit.
+func sinterCard(c *Client, v *Value, rg *RedisGo) *Value {
+	keys, rest, errv := parseNumKeys(v.Array[1:])
+	if errv != nil {
+		return errv
+	}
+	var limit int64
+	for i := 0; i < len(rest); i++ {
+		if !strings.EqualFold(rest[i].Bulk, "LIMIT") || i+1 >= len(rest) {
+			return newError(errSyntax)
+		}
+		n, err := strconv.ParseInt(rest[i+1].Bulk, 10, 64)
+		if err != nil {
+			return newError(errNotInt)
+		}
+		if n < 0 {
+			return newError("ERR LIMIT can't be negative")
+		}
+		limit = n
+		i++
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(keys...)
+	defer unlock()
+
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		item, errv := db.peekTyped(key, KindSet)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			return newInteger(0)
+		}
+		sets[i] = item.Set
+	}
+	// Walk the smallest set, so each member costs one lookup per other set.
+	slices.SortFunc(sets, func(a, b map[string]struct{}) int {
+		return len(a) - len(b)
+	})
+	var card int64
+	for member := range sets[0] {
+		inAll := true
+		for _, set := range sets[1:] {
+			if _, ok := set[member]; !ok {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			card++
+			if card == limit {
+				break
+			}
+		}
+	}
+	return newInteger(card)
+}
+
+// sinterStore implements SINTERSTORE destination key [key ...].
+func sinterStore(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpStoreGeneric(c, v, rg, setInter)
+}
+
+// sunionStore implements SUNIONSTORE destination key [key ...].
+func sunionStore(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpStoreGeneric(c, v, rg, setUnion)
+}
+
+// sdiffStore implements SDIFFSTORE destination key [key ...].
+func sdiffStore(c *Client, v *Value, rg *RedisGo) *Value {
+	return setOpStoreGeneric(c, v, rg, setDiff)
+}
+
+// setOpStoreGeneric stores the result of applying op to the source sets in the
+// destination key, overwriting it, and replies with the result cardinality.
+// An empty result deletes the destination.
+func setOpStoreGeneric(c *Client, v *Value, rg *RedisGo, op setOp) *Value {
+	dest := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(bulkArgs(v.Array[1:])...)
+	defer unlock()
+
+	result, errv := combineSets(db, bulkArgs(v.Array[2:]), op)
+	if errv != nil {
+		return errv
+	}
+	if len(result) == 0 {
+		if db.remove(dest) {
+			db.notify(notifyGeneric, "del", dest)
+		}
+		return newInteger(0)
+	}
+	db.put(dest, newSetItem(result))
+	db.notify(notifySet, strings.ToLower(v.Array[0].Bulk), dest)
+	return newInteger(int64(len(result)))
+}
+
+// maxRandCount bounds the number of repeated members a negative SRANDMEMBER
+// count may ask for, so a single command can't allocate unbounded memory.
+const maxRandCount = 1 << 24
+
+// membersAt returns the members found at positions of a walk over set, in the
+// order of positions, which may repeat. The walk stops at the highest position,
+// so nothing is copied or sorted beyond the members asked for.
+func membersAt(set map[string]struct{}, positions []int) []string {
+	want := make(map[int]string, len(positions))
+	last := 0
+	for _, pos := range positions {
+		want[pos] = ""
+		last = max(last, pos)
+	}
+	i := 0
+	for member := range set {
+		if _, ok := want[i]; ok {
+			want[i] = member
+		}
+		if i == last {
+			break
+		}
+		i++
+	}
+	picked := make([]string, len(positions))
+	for j, pos := range positions {
+		picked[j] = want[pos]
+	}
+	return picked
+}
+
+// pickDistinct returns up to count distinct members of set chosen at random.
+func (rg *RedisGo) pickDistinct(set map[string]struct{}, count int) []string {
+	if count >= len(set) {
+		members := make([]string, 0, len(set))
+		for member := range set {
+			members = append(members, member)
+		}
+		return members
+	}
+	// Floyd's algorithm draws count distinct positions with count draws.
+	n := len(set)
+	chosen := make(map[int]struct{}, count)
+	positions := make([]int, 0, count)
+	for j := n - count; j < n; j++ {
+		pos := rg.randIntn(j + 1)
+		if _, ok := chosen[pos]; ok {
+			pos = j
+		}
+		chosen[pos] = struct{}{}
+		positions = append(positions, pos)
+	}
+	return membersAt(set, positions)
+}
+
+// parseCount parses the optional count argument of SPOP and SRANDMEMBER.
+func parseCount(v *Value) (count int64, hasCount bool, errv *Value) {
+	if len(v.Array) > 3 {
+		return 0, false, newError(errSyntax)
+	}
+	if len(v.Array) < 3 {
+		return 1, false, nil
+	}
+	n, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return 0, false, newError(errNotInt)
+	}
+	return n, true, nil
+}
+
+// bulkValues converts strs into an array of bulk values.
+func bulkValues(strs []string) []Value {
+	vals := make([]Value, len(strs))
+	for i, str := range strs {
+		vals[i] = Value{Type: Bulk, Bulk: str}
+	}
+	return vals
+}
+
+// spop implements SPOP key [count], removing and replying with random members.
+// A set left empty is deleted.
+func spop(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	count, hasCount, errv := parseCount(v)
+	if errv != nil {
+		return errv
+	}
+	if count < 0 {
+		return newError("ERR value is out of range, must be positive")
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		if hasCount {
+			return newArray([]Value{})
+		}
+		return newNull()
+	}
+	popped := rg.pickDistinct(item.Set, int(min(count, int64(len(item.Set)))))
+	for _, member := range popped {
+		delete(item.Set, member)
+		db.subMem(memberMemUsage(member))
+	}
+	if len(popped) > 0 {
+		db.notify(notifySet, "spop", key)
+	}
+	if len(item.Set) == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	// The members are picked at random, so replaying SPOP would pop others.
+	if len(popped) > 0 {
+		c.propagateAs(append([]string{"srem", key}, popped...)...)
+	} else {
+		c.propagateNone()
+	}
+	if !hasCount {
+		return newBulk(popped[0])
+	}
+	return newArray(bulkValues(popped))
+}
+
+// srandMember implements SRANDMEMBER key [count]. A positive count replies
+// with up to count distinct members, a negative one with exactly -count
+// members that may repeat.
+func srandMember(c *Client, v *Value, rg *RedisGo) *Value {
+	count, hasCount, errv := parseCount(v)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		if hasCount {
+			return newArray([]Value{})
+		}
+		return newNull()
+	}
+	if !hasCount {
+		return newBulk(rg.pickDistinct(item.Set, 1)[0])
+	}
+	if count >= 0 {
+		return newArray(bulkValues(rg.pickDistinct(item.Set, int(min(count, int64(len(item.Set)))))))
+	}
+	if count < -maxRandCount {
+		return newError("ERR value is out of range")
+	}
+	positions := make([]int, -count)
+	for i := range positions {
+		positions[i] = rg.randIntn(len(item.Set))
+	}
+	return newArray(bulkValues(membersAt(item.Set, positions)))
+}
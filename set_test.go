@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// bulkStrings returns the bulk strings of an array reply.
+func bulkStrings(reply *Value) []string {
+	strs := make([]string, len(reply.Array))
+	for i, v := range reply.Array {
+		strs[i] = v.Bulk
+	}
+	return strs
+}
+
+func TestSPopCount(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "sadd", "s", "a", "b", "c", "d", "e")
+
+	if reply := do(rg, c, "spop", "s", "0"); reply.Type != Array || len(reply.Array) != 0 {
+		t.Fatalf("SPOP s 0 = %v, want an empty array", reply)
+	}
+	if reply := do(rg, c, "spop", "s", "-1"); reply.Type != Error {
+		t.Fatalf("SPOP s -1 = %v, want an error", reply)
+	}
+	if reply := do(rg, c, "scard", "s"); reply.Int != 5 {
+		t.Fatalf("SCARD after SPOP 0 and -1 = %v, want 5", reply)
+	}
+
+	popped := map[string]bool{}
+	reply := do(rg, c, "spop", "s", "2")
+	for _, member := range bulkStrings(reply) {
+		popped[member] = true
+	}
+	if len(popped) != 2 {
+		t.Fatalf("SPOP s 2 = %v, want two distinct members", reply)
+	}
+	if reply := do(rg, c, "scard", "s"); reply.Int != 3 {
+		t.Fatalf("SCARD after SPOP 2 = %v, want 3", reply)
+	}
+
+	// A count past the cardinality pops the rest and deletes the key.
+	reply = do(rg, c, "spop", "s", "100")
+	for _, member := range bulkStrings(reply) {
+		if popped[member] {
+			t.Errorf("SPOP s 100 popped %q twice", member)
+		}
+		popped[member] = true
+	}
+	if len(reply.Array) != 3 || len(popped) != 5 {
+		t.Fatalf("SPOP s 100 = %v, want the three remaining members", reply)
+	}
+	if reply := do(rg, c, "exists", "s"); reply.Int != 0 {
+		t.Fatalf("EXISTS s after popping every member = %v, want 0", reply)
+	}
+}
+
+func TestSRandMemberCount(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "sadd", "s", "a", "b", "c")
+	inSet := map[string]bool{"a": true, "b": true, "c": true}
+
+	if reply := do(rg, c, "srandmember", "s", "0"); reply.Type != Array || len(reply.Array) != 0 {
+		t.Fatalf("SRANDMEMBER s 0 = %v, want an empty array", reply)
+	}
+
+	// A positive count replies with distinct members, at most all of them.
+	for _, count := range []int{1, 2, 3, 10} {
+		reply := do(rg, c, "srandmember", "s", strconv.Itoa(count))
+		seen := map[string]bool{}
+		for _, member := range bulkStrings(reply) {
+			if !inSet[member] || seen[member] {
+				t.Fatalf("SRANDMEMBER s %d = %v, want distinct members of s", count, reply)
+			}
+			seen[member] = true
+		}
+		if len(seen) != min(count, 3) {
+			t.Fatalf("SRANDMEMBER s %d = %v, want %d members", count, reply, min(count, 3))
+		}
+	}
+
+	// A negative count replies with exactly -count members that may repeat.
+	reply := do(rg, c, "srandmember", "s", "-100")
+	seen := map[string]bool{}
+	for _, member := range bulkStrings(reply) {
+		if !inSet[member] {
+			t.Fatalf("SRANDMEMBER s -100 replied with %q, not a member of s", member)
+		}
+		seen[member] = true
+	}
+	if len(reply.Array) != 100 || len(seen) != 3 {
+		t.Fatalf("SRANDMEMBER s -100 = %d members, %d distinct, want 100 covering all 3", len(reply.Array), len(seen))
+	}
+	if reply := do(rg, c, "scard", "s"); reply.Int != 3 {
+		t.Fatalf("SCARD after SRANDMEMBER = %v, want 3", reply)
+	}
+}
+
+func TestSRandMemberLargeSet(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	args := []string{"sadd", "s"}
+	for i := range 1000 {
+		args = append(args, strconv.Itoa(i))
+	}
+	do(rg, c, args...)
+
+	// Every member is picked sooner or later, not only those early in a walk.
+	seen := map[string]bool{}
+	for range 400 {
+		for _, member := range bulkStrings(do(rg, c, "srandmember", "s", "50")) {
+			seen[member] = true
+		}
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("400 rounds of SRANDMEMBER s 50 saw %d members, want 1000", len(seen))
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "slowlog", handler: slowlogCmd, arity: -2, help: slowlogHelp},
+	)
+}
+
+// slowlogHelp is the reply to SLOWLOG HELP.
+var slowlogHelp = []string{
+	"GET [<count>]",
+	"    Return top <count> entries from the slowlog (default: 10, -1 mean all).",
+	"    Entries are made of:",
+	"    id, timestamp, time in microseconds, arguments array, client IP and port,",
+	"    client name",
+	"LEN",
+	"    Return the length of the slowlog.",
+	"RESET",
+	"    Reset the slowlog.",
+}
+
+const (
+	// slowlogMaxArgs is the number of arguments kept per entry; the last
+	// kept one is replaced by a count of the omitted ones.
+	slowlogMaxArgs = 32
+
+	// slowlogMaxArgLen is the number of bytes kept of each argument.
+	slowlogMaxArgLen = 128
+)
+
+// slowlogEntry is a command recorded in the slow log.
+type slowlogEntry struct {
+	id       int64
+	at       time.Time     // at is when the command started
+	duration time.Duration // duration is how long the command ran
+	args     []string      // args holds the command and its arguments, abridged
+	addr     string        // addr is the address of the client
+	name     string        // name is the connection name of the client
+}
+
+// slowLog holds the commands that took longer than slowlog-log-slower-than
+// to execute, the slowlog-max-len most recent ones, in a ring buffer.
+type slowLog struct {
+	mu sync.Mutex
+
+	// entries is the ring buffer, whose oldest entry is at head once it is
+	// full.
+	entries []slowlogEntry
+	head    int
+
+	nextID int64 // nextID is the id of the next entry, not reset by SLOWLOG RESET
+}
+
+// add appends e to the log, dropping the oldest entries beyond maxLen.
+func (l *slowLog) add(e slowlogEntry, maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.id = l.nextID
+	l.nextID++
+	switch {
+	case maxLen <= 0:
+		l.entries, l.head = nil, 0
+	case len(l.entries) < maxLen:
+		// Not full yet, or slowlog-max-len was raised since it was.
+		l.entries, l.head = append(l.oldestFirst(), e), 0
+	case len(l.entries) > maxLen:
+		// slowlog-max-len was lowered.
+		all := append(l.oldestFirst(), e)
+		l.entries, l.head = all[len(all)-maxLen:], 0
+	default:
+		l.entries[l.head] = e
+		l.head = (l.head + 1) % maxLen
+	}
+}
+
+// oldestFirst returns the entries from the oldest to the most recent. The
+// caller must hold mu.
+func (l *slowLog) oldestFirst() []slowlogEntry {
+	if l.head == 0 {
+		return l.entries
+	}
+	return slices.Concat(l.entries[l.head:], l.entries[:l.head])
+}
+
+// recent returns the count most recent entries, the most recent first, or
+// every entry if count is negative.
+func (l *slowLog) recent(count int) []slowlogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := slices.Clone(l.oldestFirst())
+	slices.Reverse(entries)
+	if count >= 0 && count < len(entries) {
+		entries = entries[:count]
+	}
+	return entries
+}
+
+// len returns the number of entries in the log.
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// reset empties the log.
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries, l.head = nil, 0
+}
+
+// logIfSlow records the command v, started at start by client c and run for
+// duration, in the slow log if it ran for at least slowlog-log-slower-than.
+func (rg *RedisGo) logIfSlow(c *Client, v *Value, start time.Time, duration time.Duration) {
+	threshold, maxLen := rg.conf.slowlogLimits()
+	if threshold < 0 || duration < threshold || rg.loading {
+		return
+	}
+	rg.slowlog.add(slowlogEntry{
+		at:       start,
+		duration: duration,
+		args:     slowlogArgs(v),
+		addr:     c.addr(),
+		name:     c.name,
+	}, maxLen)
+}
+
+// slowlogArgs returns the arguments of v as recorded in the slow log: at most
+// slowlogMaxArgs of them and slowlogMaxArgLen bytes of each, with the
+// credentials given to AUTH and HELLO redacted.
+func slowlogArgs(v *Value) []string {
+	n := min(len(v.Array), slowlogMaxArgs)
+	args := make([]string, n)
+	name := strings.ToLower(v.Array[0].Bulk)
+	for i := range args {
+		arg := v.Array[i].Bulk
+		switch {
+		case i == slowlogMaxArgs-1 && len(v.Array) > slowlogMaxArgs:
+			arg = fmt.Sprintf("... (%d more arguments)", len(v.Array)-slowlogMaxArgs+1)
+		case i > 0 && (name == "auth" || name == "hello"):
+			arg = "(redacted)"
+		case len(arg) > slowlogMaxArgLen:
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		args[i] = arg
+	}
+	return args
+}
+
+// slowlogCmd implements SLOWLOG GET [count], SLOWLOG LEN and SLOWLOG RESET.
+// GET replies with the count most recent entries, 10 by default or all of
+// them for -1, each as its id, Unix start time, duration in microseconds,
+// arguments, client address and client name.
+func slowlogCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[2:])
+
+	switch sub := strings.ToUpper(v.Array[1].Bulk); {
+	case sub == "GET" && len(args) <= 1:
+		count := 10
+		if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil {
+				return newError(errNotInt)
+			}
+			if n < -1 {
+				return newError("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		entries := rg.slowlog.recent(count)
+		vals := make([]Value, len(entries))
+		for i, e := range entries {
+			vals[i] = *newArray([]Value{
+				*newInteger(e.id),
+				*newInteger(e.at.Unix()),
+				*newInteger(e.duration.Microseconds()),
+				*newArray(bulkValues(e.args)),
+				*newBulk(e.addr),
+				*newBulk(e.name),
+			})
+		}
+		return newArray(vals)
+	case sub == "LEN" && len(args) == 0:
+		return newInteger(int64(rg.slowlog.len()))
+	case sub == "RESET" && len(args) == 0:
+		rg.slowlog.reset()
+		return newOK()
+	default:
+		return unknownSubcommand("slowlog", v.Array[1].Bulk)
+	}
+}
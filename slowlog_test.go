@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSlowlogRecordsDebugSleep(t *testing.T) {
+	rg := newTestServer(t, "slowlog-log-slower-than 20000")
+	conn := dial(t, rg)
+	conn.do("client", "setname", "sleeper")
+	conn.do("ping")
+	if reply := conn.do("debug", "sleep", "0.05"); reply.Type != String {
+		t.Fatalf("DEBUG SLEEP = %v", reply)
+	}
+	conn.do("ping")
+
+	if reply := conn.do("slowlog", "len"); reply.Int != 1 {
+		t.Fatalf("SLOWLOG LEN = %v, want 1", reply)
+	}
+	reply := conn.do("slowlog", "get")
+	if reply.Type != Array || len(reply.Array) != 1 {
+		t.Fatalf("SLOWLOG GET = %v, want one entry", reply)
+	}
+	entry := reply.Array[0].Array
+	if len(entry) != 6 {
+		t.Fatalf("slow log entry has %d fields, want 6", len(entry))
+	}
+	if duration := entry[2].Int; duration < 50000 {
+		t.Errorf("slow log entry lasted %dus, want at least 50000", duration)
+	}
+	var args []string
+	for _, arg := range entry[3].Array {
+		args = append(args, arg.Bulk)
+	}
+	if want := []string{"debug", "sleep", "0.05"}; !slices.Equal(args, want) {
+		t.Errorf("slow log entry arguments = %q, want %q", args, want)
+	}
+	if entry[5].Bulk != "sleeper" {
+		t.Errorf("slow log entry client name = %q, want sleeper", entry[5].Bulk)
+	}
+
+	conn.do("slowlog", "reset")
+	if reply := conn.do("slowlog", "len"); reply.Int != 0 {
+		t.Errorf("SLOWLOG LEN after RESET = %v, want 0", reply)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// ZEntry is a single member of a sorted set along with its score.
+type ZEntry struct {
+	Member string
+	Score  float64
+}
+
+// compareZEntry orders entries by score, breaking ties lexically by member.
+func compareZEntry(a, b ZEntry) int {
+	if c := cmp.Compare(a.Score, b.Score); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Member, b.Member)
+}
+
+// SortedSet is the payload of a sorted set: a member to score map plus a view
+// of the entries ordered by (score, member). All fields are exported to
+// support gob encoding for RDB persistence.
+//
+// The ordered view is a sorted slice, so updates cost O(n) for the shift while
+// lookups by rank are O(1); it is only ever accessed through the methods below
+// so it can be swapped for a skiplist without touching the commands.
+type SortedSet struct {
+	Scores  map[string]float64
+	Entries []ZEntry
+}
+
+// NewSortedSet returns an empty sorted set.
+func NewSortedSet() *SortedSet {
+	return &SortedSet{Scores: make(map[string]float64)}
+}
+
+// Len returns the number of members in the set.
+func (zs *SortedSet) Len() int {
+	return len(zs.Entries)
+}
+
+// Score returns the score of member and whether it is in the set.
+func (zs *SortedSet) Score(member string) (float64, bool) {
+	score, ok := zs.Scores[member]
+	return score, ok
+}
+
+// search returns the position of entry in the ordered view, or where it would
+// be inserted, and whether it is present.
+func (zs *SortedSet) search(entry ZEntry) (int, bool) {
+	return slices.BinarySearchFunc(zs.Entries, entry, compareZEntry)
+}
+
+// Add sets the score of member, inserting it if needed. It reports whether the
+// member is new.
+func (zs *SortedSet) Add(member string, score float64) bool {
+	old, exists := zs.Scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		i, _ := zs.search(ZEntry{Member: member, Score: old})
+		zs.Entries = slices.Delete(zs.Entries, i, i+1)
+	}
+	zs.Scores[member] = score
+
+	entry := ZEntry{Member: member, Score: score}
+	i, _ := zs.search(entry)
+	zs.Entries = slices.Insert(zs.Entries, i, entry)
+	return !exists
+}
+
+// Remove deletes member from the set, reporting whether it was present.
+func (zs *SortedSet) Remove(member string) bool {
+	score, ok := zs.Scores[member]
+	if !ok {
+		return false
+	}
+	delete(zs.Scores, member)
+	i, _ := zs.search(ZEntry{Member: member, Score: score})
+	zs.Entries = slices.Delete(zs.Entries, i, i+1)
+	return true
+}
+
+// Pop removes and returns up to n entries with the lowest scores, or the
+// highest with rev, in the order they were removed.
+func (zs *SortedSet) Pop(n int, rev bool) []ZEntry {
+	n = min(n, len(zs.Entries))
+	var popped []ZEntry
+	if rev {
+		popped = slices.Clone(zs.Entries[len(zs.Entries)-n:])
+		slices.Reverse(popped)
+		zs.Entries = zs.Entries[:len(zs.Entries)-n]
+	} else {
+		popped = slices.Clone(zs.Entries[:n])
+		zs.Entries = zs.Entries[n:]
+	}
+	for _, entry := range popped {
+		delete(zs.Scores, entry.Member)
+	}
+	return popped
+}
+
+// Range returns the entries between the inclusive ranks start and end, which
+// must be valid indices into the ordered view. With rev, ranks count from the
+// highest score and the entries are returned highest first.
+func (zs *SortedSet) Range(start, end int, rev bool) []ZEntry {
+	entries := make([]ZEntry, 0, end-start+1)
+	for rank := start; rank <= end; rank++ {
+		if rev {
+			entries = append(entries, zs.Entries[len(zs.Entries)-1-rank])
+		} else {
+			entries = append(entries, zs.Entries[rank])
+		}
+	}
+	return entries
+}
+
+// ScoreRange is an interval of scores, each bound optionally exclusive.
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+// aboveMin reports whether score satisfies the lower bound of r.
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinEx {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+// belowMax reports whether score satisfies the upper bound of r.
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxEx {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// scoreBounds returns the ranks [lo, hi) of the entries whose score lies in r.
+func (zs *SortedSet) scoreBounds(r ScoreRange) (lo, hi int) {
+	lo = sort.Search(len(zs.Entries), func(i int) bool {
+		return r.aboveMin(zs.Entries[i].Score)
+	})
+	hi = sort.Search(len(zs.Entries), func(i int) bool {
+		return !r.belowMax(zs.Entries[i].Score)
+	})
+	return lo, max(lo, hi)
+}
+
+// RangeByScore returns the entries whose score lies in r in ascending order,
+// skipping the first offset matches and returning at most count entries; a
+// negative count means no limit.
+func (zs *SortedSet) RangeByScore(r ScoreRange, offset, count int) []ZEntry {
+	lo, hi := zs.scoreBounds(r)
+	lo = min(lo+offset, hi)
+	if count >= 0 {
+		hi = min(hi, lo+count)
+	}
+	return slices.Clone(zs.Entries[lo:hi])
+}
+
+// RevRangeByScore is like RangeByScore but returns the entries in descending
+// order, so offset skips the highest matches.
+func (zs *SortedSet) RevRangeByScore(r ScoreRange, offset, count int) []ZEntry {
+	lo, hi := zs.scoreBounds(r)
+	hi = max(hi-offset, lo)
+	if count >= 0 {
+		lo = max(lo, hi-count)
+	}
+	entries := slices.Clone(zs.Entries[lo:hi])
+	slices.Reverse(entries)
+	return entries
+}
+
+// CountByScore returns the number of entries whose score lies in r.
+func (zs *SortedSet) CountByScore(r ScoreRange) int {
+	lo, hi := zs.scoreBounds(r)
+	return hi - lo
+}
+
+// Rank returns the zero-based rank of member in ascending order and whether
+// the member is in the set.
+func (zs *SortedSet) Rank(member string) (int, bool) {
+	score, ok := zs.Scores[member]
+	if !ok {
+		return 0, false
+	}
+	i, _ := zs.search(ZEntry{Member: member, Score: score})
+	return i, true
+}
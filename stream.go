@@ -0,0 +1,674 @@
+package main
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "xadd", handler: xadd, arity: -5, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "xlen", handler: xlen, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "xrange", handler: xrange, arity: -4, keys: oneKey},
+		&Command{name: "xrevrange", handler: xrevrange, arity: -4, keys: oneKey},
+		&Command{name: "xread", handler: xread, arity: -4},
+		&Command{name: "xsetid", handler: xsetid, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+	)
+}
+
+const errInvalidStreamID = "ERR Invalid stream ID specified as stream command argument"
+
+// StreamID identifies an entry of a stream: the Unix time in milliseconds
+// it was added at and a sequence number telling apart the entries added
+// within the same millisecond.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// String formats id as ms-seq.
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// compareStreamID orders IDs by time, then by sequence number.
+func compareStreamID(a, b StreamID) int {
+	if c := cmp.Compare(a.Ms, b.Ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Seq, b.Seq)
+}
+
+// next returns the smallest ID greater than id. It reports false if id is
+// the greatest possible ID.
+func (id StreamID) next() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{id.Ms, id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{id.Ms + 1, 0}, true
+	default:
+		return id, false
+	}
+}
+
+// prev returns the greatest ID smaller than id. It reports false if id is
+// 0-0.
+func (id StreamID) prev() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{id.Ms, id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{id.Ms - 1, math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+// parseStreamID parses an ID given as ms-seq, or as ms alone, in which case
+// the sequence number is missingSeq.
+func parseStreamID(s string, missingSeq uint64) (StreamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	if !hasSeq {
+		return StreamID{ms, missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	return StreamID{ms, seq}, true
+}
+
+// StreamEntry is an entry of a stream: its ID and its field-value pairs,
+// flattened. The fields of an entry are never modified once it is added, so
+// copies of a stream may share them.
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string
+}
+
+// Stream is the payload of a stream, an append-only log. All fields are
+// exported to support gob encoding for RDB persistence.
+type Stream struct {
+	// Entries holds the entries of the stream in increasing ID order.
+	Entries []StreamEntry
+
+	// LastID is the ID of the last entry added, which the ID of the next
+	// one must be greater than, even once that entry is trimmed.
+	LastID StreamID
+}
+
+// newStreamItem returns a KindStream item holding an empty stream.
+func newStreamItem() *Item {
+	return &Item{Kind: KindStream, Stream: &Stream{}}
+}
+
+// Len returns the number of entries in the stream.
+func (s *Stream) Len() int {
+	return len(s.Entries)
+}
+
+// search returns the index of the first entry whose ID is id or greater.
+func (s *Stream) search(id StreamID) int {
+	i, _ := slices.BinarySearchFunc(s.Entries, id, func(e StreamEntry, id StreamID) int {
+		return compareStreamID(e.ID, id)
+	})
+	return i
+}
+
+// between returns the entries with IDs from start to end, inclusive. The
+// slice shares the entries of the stream.
+func (s *Stream) between(start, end StreamID) []StreamEntry {
+	if compareStreamID(start, end) > 0 {
+		return nil
+	}
+	i := s.search(start)
+	j := len(s.Entries)
+	if next, ok := end.next(); ok {
+		j = s.search(next)
+	}
+	return s.Entries[i:j]
+}
+
+// after returns up to count of the entries with IDs greater than id, all of
+// them if count is 0.
+func (s *Stream) after(id StreamID, count int) []StreamEntry {
+	start, ok := id.next()
+	if !ok {
+		return nil
+	}
+	entries := s.Entries[s.search(start):]
+	if count > 0 && len(entries) > count {
+		entries = entries[:count]
+	}
+	return entries
+}
+
+// streamEntryValue returns the reply for entry: its ID and an array of its
+// fields and values.
+func streamEntryValue(entry StreamEntry) Value {
+	return Value{Type: Array, Array: []Value{
+		{Type: Bulk, Bulk: entry.ID.String()},
+		{Type: Array, Array: bulkValues(entry.Fields)},
+	}}
+}
+
+// streamIDArg is the ID argument of XADD: * to generate the whole ID, ms-*
+// to generate only the sequence number, or an explicit ID.
+type streamIDArg struct {
+	id      StreamID
+	autoMs  bool
+	autoSeq bool
+}
+
+// parseStreamIDArg parses the ID argument of XADD.
+func parseStreamIDArg(arg string) (streamIDArg, *Value) {
+	if arg == "*" {
+		return streamIDArg{autoMs: true, autoSeq: true}, nil
+	}
+	if ms, ok := strings.CutSuffix(arg, "-*"); ok {
+		n, err := strconv.ParseUint(ms, 10, 64)
+		if err != nil {
+			return streamIDArg{}, newError(errInvalidStreamID)
+		}
+		return streamIDArg{id: StreamID{Ms: n}, autoSeq: true}, nil
+	}
+	id, ok := parseStreamID(arg, 0)
+	if !ok {
+		return streamIDArg{}, newError(errInvalidStreamID)
+	}
+	if id == (StreamID{}) {
+		return streamIDArg{}, newError("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	return streamIDArg{id: id}, nil
+}
+
+// nextID returns the ID of an entry added to the stream with the ID argument
+// arg. Generated IDs use the current time unless the last ID is ahead of it,
+// so that they keep increasing.
+func (s *Stream) nextID(arg streamIDArg) (StreamID, *Value) {
+	last := s.LastID
+	switch {
+	case arg.autoMs:
+		if now := uint64(time.Now().UnixMilli()); now > last.Ms {
+			return StreamID{Ms: now}, nil
+		}
+		id, ok := last.next()
+		if !ok {
+			return StreamID{}, newError("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	case arg.autoSeq:
+		if arg.id.Ms > last.Ms {
+			return arg.id, nil
+		}
+		if arg.id.Ms == last.Ms && last.Seq < math.MaxUint64 {
+			return StreamID{last.Ms, last.Seq + 1}, nil
+		}
+	case compareStreamID(arg.id, last) > 0:
+		return arg.id, nil
+	}
+	return StreamID{}, newError("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+}
+
+// streamTrim holds the trimming options of XADD: MAXLEN or MINID, with =
+// for exact trimming or ~ for approximate trimming, and LIMIT. Approximate
+// trimming is done exactly, except that it stops after limit entries.
+type streamTrim struct {
+	maxLen int64 // maxLen is the length to trim to, -1 if not trimming by length
+	minID  *StreamID
+	approx bool
+	limit  int64 // limit caps the entries trimmed, 0 for no limit
+}
+
+// parseStreamTrim parses a MAXLEN or MINID option and its arguments at the
+// start of args into t, returning the number of arguments consumed.
+func parseStreamTrim(args []string, t *streamTrim) (int, *Value) {
+	byMinID := strings.EqualFold(args[0], "MINID")
+	if t.maxLen >= 0 || t.minID != nil {
+		return 0, newError("ERR syntax error, MAXLEN and MINID options at the same time are not compatible")
+	}
+	n := 1
+	if n < len(args) && (args[n] == "=" || args[n] == "~") {
+		t.approx = args[n] == "~"
+		n++
+	}
+	if n >= len(args) {
+		return 0, newError(errSyntax)
+	}
+	if byMinID {
+		id, ok := parseStreamID(args[n], 0)
+		if !ok {
+			return 0, newError(errInvalidStreamID)
+		}
+		t.minID = &id
+	} else {
+		maxLen, err := strconv.ParseInt(args[n], 10, 64)
+		if err != nil {
+			return 0, newError(errNotInt)
+		}
+		if maxLen < 0 {
+			return 0, newError("ERR The MAXLEN argument must be >= 0.")
+		}
+		t.maxLen = maxLen
+	}
+	n++
+	if n < len(args) && strings.EqualFold(args[n], "LIMIT") {
+		if n+1 >= len(args) {
+			return 0, newError(errSyntax)
+		}
+		limit, err := strconv.ParseInt(args[n+1], 10, 64)
+		if err != nil {
+			return 0, newError(errNotInt)
+		}
+		if limit < 0 {
+			return 0, newError("ERR The LIMIT argument must be >= 0.")
+		}
+		if !t.approx {
+			return 0, newError("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		t.limit = limit
+		n += 2
+	}
+	return n, nil
+}
+
+// trim removes the oldest entries of the stream as set by t, returning them.
+func (s *Stream) trim(t streamTrim) []StreamEntry {
+	n := 0
+	switch {
+	case t.minID != nil:
+		n, _ = slices.BinarySearchFunc(s.Entries, *t.minID, func(e StreamEntry, id StreamID) int {
+			return compareStreamID(e.ID, id)
+		})
+	case t.maxLen >= 0 && int64(len(s.Entries)) > t.maxLen:
+		n = len(s.Entries) - int(t.maxLen)
+	}
+	if t.limit > 0 && int64(n) > t.limit {
+		n = int(t.limit)
+	}
+	trimmed := slices.Clone(s.Entries[:n])
+	s.Entries = slices.Delete(s.Entries, 0, n)
+	return trimmed
+}
+
+// xadd implements XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold
+// [LIMIT count]] *|id field value [field value ...], appending an entry to
+// the stream at key, created unless NOMKSTREAM is given, and replying with
+// its ID, or a null if the stream doesn't exist and NOMKSTREAM was given.
+// The stream is then trimmed as requested. Generated IDs are propagated
+// explicitly, so a replay adds the entry under the same ID.
+func xadd(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	args := bulkArgs(v.Array[2:])
+	noMkStream := false
+	trim := streamTrim{maxLen: -1}
+	i := 0
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			n, errv := parseStreamTrim(args[i:], &trim)
+			if errv != nil {
+				return errv
+			}
+			i += n
+		default:
+			break options
+		}
+	}
+	fields := args[min(i+1, len(args)):]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return newError("ERR wrong number of arguments for 'xadd' command")
+	}
+	idArg, errv := parseStreamIDArg(args[i])
+	if errv != nil {
+		return errv
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindStream)
+	if errv != nil {
+		return errv
+	}
+	isNew := item == nil
+	if isNew {
+		if noMkStream {
+			c.propagateNone()
+			return newNull()
+		}
+		item = newStreamItem()
+	}
+	stream := item.Stream
+	id, errv := stream.nextID(idArg)
+	if errv != nil {
+		return errv
+	}
+	if isNew {
+		db.put(key, item)
+	}
+	entry := StreamEntry{ID: id, Fields: slices.Clone(fields)}
+	stream.Entries = append(stream.Entries, entry)
+	stream.LastID = id
+	db.memUsed.Add(streamEntryMemUsage(entry))
+	db.notify(notifyStream, "xadd", key)
+	if trimmed := stream.trim(trim); len(trimmed) > 0 {
+		for _, e := range trimmed {
+			db.subMem(streamEntryMemUsage(e))
+		}
+		db.notify(notifyStream, "xtrim", key)
+	}
+	db.serveBlockedReads(key, item)
+
+	args[i] = id.String()
+	c.propagateAs(append([]string{"xadd", key}, args...)...)
+	return newBulk(id.String())
+}
+
+// xlen implements XLEN key, replying with the number of entries of the
+// stream at key, 0 if it is missing.
+func xlen(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindStream)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(item.Stream.Len()))
+}
+
+// parseRangeID parses an endpoint of XRANGE or XREVRANGE: - or + for the
+// smallest or greatest ID, or an ID, excluded from the range if prefixed
+// with (. A missing sequence number is missingSeq. An excluded endpoint is
+// turned into the next ID inward, start telling which way that is, which
+// fails as in Redis if there is none.
+func parseRangeID(arg string, missingSeq uint64, start bool) (StreamID, *Value) {
+	switch arg {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return StreamID{math.MaxUint64, math.MaxUint64}, nil
+	}
+	s, exclusive := strings.CutPrefix(arg, "(")
+	id, ok := parseStreamID(s, missingSeq)
+	if !ok {
+		return StreamID{}, newError(errInvalidStreamID)
+	}
+	if !exclusive {
+		return id, nil
+	}
+	if start {
+		if id, ok = id.next(); !ok {
+			return StreamID{}, newError("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.prev(); !ok {
+		return StreamID{}, newError("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// xrange implements XRANGE key start end [COUNT count], replying with the
+// entries of the stream at key with IDs from start to end, the oldest first.
+func xrange(c *Client, v *Value, rg *RedisGo) *Value {
+	return rangeGeneric(c, v, rg, false)
+}
+
+// xrevrange implements XREVRANGE key end start [COUNT count], replying with
+// the entries of the stream at key with IDs from start to end, the newest
+// first.
+func xrevrange(c *Client, v *Value, rg *RedisGo) *Value {
+	return rangeGeneric(c, v, rg, true)
+}
+
+// rangeGeneric implements XRANGE and XREVRANGE, the latter taking its
+// endpoints the other way around and replying from the newest entry (rev).
+// A missing stream replies with an empty array, as does a COUNT of 0 or
+// less.
+func rangeGeneric(c *Client, v *Value, rg *RedisGo, rev bool) *Value {
+	startArg, endArg := v.Array[2].Bulk, v.Array[3].Bulk
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, errv := parseRangeID(startArg, 0, true)
+	if errv != nil {
+		return errv
+	}
+	end, errv := parseRangeID(endArg, math.MaxUint64, false)
+	if errv != nil {
+		return errv
+	}
+	count := -1
+	switch len(v.Array) {
+	case 4:
+	case 6:
+		if !strings.EqualFold(v.Array[4].Bulk, "COUNT") {
+			return newError(errSyntax)
+		}
+		n, err := strconv.ParseInt(v.Array[5].Bulk, 10, 64)
+		if err != nil {
+			return newError(errNotInt)
+		}
+		count = int(max(min(n, math.MaxInt32), 0))
+	default:
+		return newError(errSyntax)
+	}
+
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindStream)
+	if errv != nil {
+		return errv
+	}
+	if item == nil || count == 0 {
+		return newArray([]Value{})
+	}
+	entries := item.Stream.between(start, end)
+	if count > 0 && len(entries) > count {
+		if rev {
+			entries = entries[len(entries)-count:]
+		} else {
+			entries = entries[:count]
+		}
+	}
+	vals := make([]Value, len(entries))
+	for i, e := range entries {
+		if rev {
+			i = len(entries) - 1 - i
+		}
+		vals[i] = streamEntryValue(e)
+	}
+	return newArray(vals)
+}
+
+// streamEntries holds entries read from the stream at key.
+type streamEntries struct {
+	key     string
+	entries []StreamEntry
+}
+
+// xreadReply returns the reply to XREAD for the entries read from each
+// stream: a map from key to entries for RESP3 clients, and an array of
+// key-entries pairs for the others.
+func xreadReply(reads []streamEntries, resp3 bool) *Value {
+	vals := make([]Value, 0, 2*len(reads))
+	for _, r := range reads {
+		entries := make([]Value, len(r.entries))
+		for i, e := range r.entries {
+			entries[i] = streamEntryValue(e)
+		}
+		vals = append(vals, Value{Type: Bulk, Bulk: r.key}, Value{Type: Array, Array: entries})
+	}
+	if resp3 {
+		return newMap(vals)
+	}
+	pairs := make([]Value, len(reads))
+	for i := range pairs {
+		pairs[i] = Value{Type: Array, Array: vals[2*i : 2*i+2]}
+	}
+	return newArray(pairs)
+}
+
+// xread implements XREAD [COUNT count] [BLOCK milliseconds] STREAMS key
+// [key ...] id [id ...], replying with up to count entries added to each
+// stream after the matching ID, for the streams that have any, or with a
+// null array if none does. The ID $ stands for the last ID of the stream, so
+// that only entries added from now on are read. With BLOCK the client
+// blocks until an entry is added to one of the streams, or replies with a
+// null array once the timeout elapses; a timeout of 0 blocks forever. Inside
+// a transaction the command never blocks.
+func xread(c *Client, v *Value, rg *RedisGo) *Value {
+	args := bulkArgs(v.Array[1:])
+	count := 0
+	block, hasStreams := false, false
+	var timeout time.Duration
+	i := 0
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return newError(errSyntax)
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return newError(errNotInt)
+			}
+			count = int(max(min(n, math.MaxInt32), 0))
+			i++
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return newError(errSyntax)
+			}
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return newError("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return newError("ERR timeout is negative")
+			}
+			if ms > math.MaxInt64/int64(time.Millisecond) {
+				return newError("ERR timeout is out of range")
+			}
+			block = true
+			timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "STREAMS":
+			hasStreams = true
+			i++
+			break options
+		default:
+			return newError(errSyntax)
+		}
+	}
+	if !hasStreams {
+		return newError(errSyntax)
+	}
+	streams := args[i:]
+	if len(streams) == 0 || len(streams)%2 != 0 {
+		return newError("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	keys, idArgs := streams[:len(streams)/2], streams[len(streams)/2:]
+
+	db := rg.db(c)
+	unlock := db.rlockKeys(keys...)
+	defer unlock()
+
+	after := make(map[string]StreamID, len(keys))
+	items := make([]*Item, len(keys))
+	for j, key := range keys {
+		item, errv := db.peekTyped(key, KindStream)
+		if errv != nil {
+			return errv
+		}
+		items[j] = item
+		if idArgs[j] == "$" {
+			if item != nil {
+				after[key] = item.Stream.LastID
+			}
+			continue
+		}
+		id, ok := parseStreamID(idArgs[j], 0)
+		if !ok {
+			return newError(errInvalidStreamID)
+		}
+		after[key] = id
+	}
+	var reads []streamEntries
+	for j, key := range keys {
+		if items[j] == nil || idArgs[j] == "$" {
+			continue
+		}
+		if entries := items[j].Stream.after(after[key], count); len(entries) > 0 {
+			reads = append(reads, streamEntries{key, entries})
+		}
+	}
+	resp3 := c.writer.proto >= 3
+	if len(reads) > 0 {
+		return xreadReply(reads, resp3)
+	}
+	if !block || c.multi || rg.loading {
+		return newNullArray()
+	}
+	c.blocked = &blockedClient{
+		db:      db,
+		keys:    keys,
+		timeout: timeout,
+		read:    &streamRead{after: after, count: count, resp3: resp3},
+		reply:   make(chan *Value, 1),
+	}
+	db.block(c.blocked)
+	// serve replaces this reply once the client is unblocked.
+	return newNullArray()
+}
+
+// xsetid implements XSETID key last-id, setting the ID the next entry added
+// to the stream at key must be greater than. It can't be set below the ID
+// of the last entry. An AOF rewrite uses it to restore the last ID of a
+// stream whose last entries were trimmed.
+func xsetid(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	id, ok := parseStreamID(v.Array[2].Bulk, 0)
+	if !ok {
+		return newError(errInvalidStreamID)
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindStream)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newError("ERR no such key")
+	}
+	s := item.Stream
+	if n := s.Len(); n > 0 && compareStreamID(id, s.Entries[n-1].ID) < 0 {
+		return newError("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	s.LastID = id
+	db.notify(notifyStream, "xsetid", key)
+	return newOK()
+}
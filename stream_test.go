@@ -0,0 +1,156 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestXAddGeneratesIncreasingIDs(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	var last StreamID
+	for i := range 1000 {
+		reply := do(rg, c, "xadd", "s", "*", "f", "v")
+		if reply.Type != Bulk {
+			t.Fatalf("XADD * = %v", reply)
+		}
+		id, ok := parseStreamID(reply.Bulk, 0)
+		if !ok {
+			t.Fatalf("XADD * replied the invalid ID %q", reply.Bulk)
+		}
+		if i > 0 && compareStreamID(id, last) <= 0 {
+			t.Fatalf("XADD * gave %s after %s", id, last)
+		}
+		last = id
+	}
+	if reply := do(rg, c, "xlen", "s"); reply.Type != Integer || reply.Int != 1000 {
+		t.Errorf("XLEN = %v, want 1000", reply)
+	}
+}
+
+func TestXAddExplicitIDs(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	const tooSmall = "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+	tests := []struct {
+		id   string
+		want string // want is the ID added, or the error
+	}{
+		{"0-0", "ERR The ID specified in XADD must be greater than 0-0"},
+		{"5-1", "5-1"},
+		{"5-1", tooSmall},
+		{"5-0", tooSmall},
+		{"4-9", tooSmall},
+		{"5-*", "5-2"},
+		{"6", "6-0"},
+		{"6-0", tooSmall},
+		{"7-*", "7-0"},
+		{"x-1", errInvalidStreamID},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, "xadd", "s", tt.id, "f", "v")
+		got := reply.Bulk
+		if reply.Type == Error {
+			got = reply.Err
+		}
+		if got != tt.want {
+			t.Errorf("XADD s %s = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+	if reply := do(rg, c, "xlen", "s"); reply.Type != Integer || reply.Int != 4 {
+		t.Errorf("XLEN = %v, want 4", reply)
+	}
+}
+
+// entryIDs returns the IDs of the entries in an XRANGE style reply.
+func entryIDs(reply *Value) []string {
+	ids := []string{}
+	for _, entry := range reply.Array {
+		ids = append(ids, entry.Array[0].Bulk)
+	}
+	return ids
+}
+
+func TestXRangeEndpoints(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	for _, id := range []string{"1-0", "1-1", "2-0", "3-5", "4-0"} {
+		do(rg, c, "xadd", "s", id, "f", "v")
+	}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"xrange", "s", "-", "+"}, []string{"1-0", "1-1", "2-0", "3-5", "4-0"}},
+		{[]string{"xrange", "s", "1-1", "3-5"}, []string{"1-1", "2-0", "3-5"}},
+		{[]string{"xrange", "s", "(1-1", "(3-5"}, []string{"2-0"}},
+		{[]string{"xrange", "s", "1", "1"}, []string{"1-0", "1-1"}},
+		{[]string{"xrange", "s", "3", "+"}, []string{"3-5", "4-0"}},
+		{[]string{"xrange", "s", "-", "+", "count", "2"}, []string{"1-0", "1-1"}},
+		{[]string{"xrange", "s", "5", "+"}, []string{}},
+		{[]string{"xrange", "s", "3", "2"}, []string{}},
+		{[]string{"xrevrange", "s", "+", "-"}, []string{"4-0", "3-5", "2-0", "1-1", "1-0"}},
+		{[]string{"xrevrange", "s", "(4-0", "(1-0", "count", "2"}, []string{"3-5", "2-0"}},
+		{[]string{"xrange", "missing", "-", "+"}, []string{}},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, tt.args...)
+		if reply.Type != Array {
+			t.Errorf("%q = %v, want an array", tt.args, reply)
+			continue
+		}
+		if got := entryIDs(reply); !slices.Equal(got, tt.want) {
+			t.Errorf("%q = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+	for _, args := range [][]string{
+		{"xrange", "s", "(18446744073709551615-18446744073709551615", "+"},
+		{"xrange", "s", "-", "(0-0"},
+	} {
+		if reply := do(rg, c, args...); reply.Type != Error {
+			t.Errorf("%q = %v, want an error", args, reply)
+		}
+	}
+}
+
+func TestXReadBlockWokenByXAdd(t *testing.T) {
+	rg := newTestServer(t)
+	reader, writer := dial(t, rg), dial(t, rg)
+	writer.do("xadd", "s", "1-0", "f", "old")
+
+	reader.send("xread", "block", "0", "streams", "s", "$")
+	// Give the reader the time to block, so that the entry is not read
+	// as one already there.
+	time.Sleep(50 * time.Millisecond)
+	if reply := writer.do("xadd", "s", "2-0", "f", "new"); reply.Bulk != "2-0" {
+		t.Fatalf("XADD = %v", reply)
+	}
+	reply := reader.read(5 * time.Second)
+	if reply.Type != Array || len(reply.Array) != 1 {
+		t.Fatalf("XREAD = %v, want one stream", reply)
+	}
+	stream := reply.Array[0]
+	if stream.Array[0].Bulk != "s" {
+		t.Errorf("XREAD replied stream %q, want s", stream.Array[0].Bulk)
+	}
+	entries := stream.Array[1]
+	if got := entryIDs(&entries); !slices.Equal(got, []string{"2-0"}) {
+		t.Errorf("XREAD replied %v, want [2-0]", got)
+	}
+	if got := entries.Array[0].Array[1].Array[1].Bulk; got != "new" {
+		t.Errorf("XREAD replied value %q, want new", got)
+	}
+}
+
+func TestXReadBlockTimesOut(t *testing.T) {
+	rg := newTestServer(t)
+	reader := dial(t, rg)
+	start := time.Now()
+	if reply := reader.do("xread", "block", "50", "streams", "s", "$"); reply.Type != NullArray {
+		t.Errorf("XREAD timing out = %v, want a null array", reply)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("XREAD returned after %v, before its timeout", elapsed)
+	}
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(
+		&Command{name: "set", handler: set, arity: -3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "setex", handler: setEx, arity: 4, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "psetex", handler: pSetEx, arity: 4, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "setnx", handler: setNX, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "get", handler: get, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "incr", handler: incr, arity: 2, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "decr", handler: decr, arity: 2, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "incrby", handler: incrBy, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "decrby", handler: decrBy, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "incrbyfloat", handler: incrByFloat, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "append", handler: appendCmd, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "strlen", handler: strlen, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "getrange", handler: getRange, arity: 4, keys: oneKey},
+		&Command{name: "substr", handler: getRange, arity: 4, keys: oneKey},
+		&Command{name: "setrange", handler: setRange, arity: 4, keys: oneKey, isWrite: true, denyOOM: true},
+		&Command{name: "mset", handler: mset, arity: -3, keys: keyPairs, isWrite: true, denyOOM: true},
+		&Command{name: "msetnx", handler: msetNX, arity: -3, keys: keyPairs, isWrite: true, denyOOM: true},
+		&Command{name: "mget", handler: mget, arity: -2, keys: allKeys, fast: true},
+		&Command{name: "getset", handler: getSet, arity: 3, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "getdel", handler: getDel, arity: 2, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "getex", handler: getEx, arity: -2, keys: oneKey, isWrite: true, fast: true},
+	)
+}
+
+// setOpts holds the parsed options of a SET command.
+type setOpts struct {
+	nx, xx  bool
+	get     bool
+	keepTTL bool
+
+	// exp is the absolute expiry requested via EX/PX/EXAT/PXAT, zero if none.
+	exp time.Time
+}
+
+// parseSetOpts parses the options following SET key value. Conflicting options
+// such as NX with XX or EX with PX are a syntax error.
+func parseSetOpts(cmd string, args []Value) (setOpts, *Value) {
+	var opts setOpts
+	var hasExp bool
+
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Bulk); opt {
+		case "NX":
+			if opts.xx {
+				return opts, newError(errSyntax)
+			}
+			opts.nx = true
+		case "XX":
+			if opts.nx {
+				return opts, newError(errSyntax)
+			}
+			opts.xx = true
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasExp {
+				return opts, newError(errSyntax)
+			}
+			opts.keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExp || opts.keepTTL || i+1 >= len(args) {
+				return opts, newError(errSyntax)
+			}
+			i++
+			exp, errv := parseExpiry(cmd, opt, args[i].Bulk)
+			if errv != nil {
+				return opts, errv
+			}
+			opts.exp, hasExp = exp, true
+		default:
+			return opts, newError(errSyntax)
+		}
+	}
+	return opts, nil
+}
+
+// parseExpiry converts a TTL argument of the given unit (EX, PX, EXAT or PXAT)
+// into an absolute expiry time. Non-integer or non-positive values return an
+// error reply naming cmd.
+func parseExpiry(cmd, unit, arg string) (time.Time, *Value) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, newError(errNotInt)
+	}
+	if n <= 0 {
+		return time.Time{}, newError("ERR invalid expire time in '%s' command", cmd)
+	}
+	switch unit {
+	case "EX":
+		if n > math.MaxInt64/int64(time.Second) {
+			return time.Time{}, newError("ERR invalid expire time in '%s' command", cmd)
+		}
+		return time.Now().Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		if n > math.MaxInt64/int64(time.Millisecond) {
+			return time.Time{}, newError("ERR invalid expire time in '%s' command", cmd)
+		}
+		return time.Now().Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	default:
+		return time.UnixMilli(n), nil
+	}
+}
+
+// set implements SET key value [NX|XX] [GET] [EX|PX|EXAT|PXAT ttl|KEEPTTL].
+func set(c *Client, v *Value, rg *RedisGo) *Value {
+	key, val := v.Array[1].Bulk, v.Array[2].Bulk
+
+	opts, errv := parseSetOpts("set", v.Array[3:])
+	if errv != nil {
+		return errv
+	}
+	old, stored, errv := setGeneric(c, rg.db(c), key, val, opts)
+	switch {
+	case errv != nil:
+		return errv
+	case opts.get && old != nil:
+		return newBulk(old.Value)
+	case opts.get || !stored:
+		return newNull()
+	default:
+		return newOK()
+	}
+}
+
+// setGeneric stores val at key as directed by opts, the way SET and its
+// variants do. It returns the item previously stored at key and whether val
+// was stored, which NX and XX may prevent.
+func setGeneric(c *Client, db *RedisDb, key, val string, opts setOpts) (*Item, bool, *Value) {
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	old := db.lookup(key)
+	if opts.get && old != nil && old.Kind != KindString {
+		return nil, false, newError(errWrongType)
+	}
+	if (opts.nx && old != nil) || (opts.xx && old == nil) {
+		c.propagateNone()
+		return old, false, nil
+	}
+	item := &Item{Value: val, Expiration: opts.exp}
+	if opts.keepTTL && old != nil {
+		item.Expiration = old.Expiration
+	}
+	db.put(key, item)
+	db.notify(notifyString, "set", key)
+	if item.hasExpiry() {
+		// A relative EX or PX would be counted from the time of the replay.
+		c.propagateAs("set", key, val, "pxat", strconv.FormatInt(item.Expiration.UnixMilli(), 10))
+		if !opts.keepTTL {
+			db.notify(notifyGeneric, "expire", key)
+		}
+	}
+	return old, true, nil
+}
+
+// setEx implements SETEX key seconds value.
+func setEx(c *Client, v *Value, rg *RedisGo) *Value {
+	return setExpiring(c, v, rg, "setex", "EX")
+}
+
+// pSetEx implements PSETEX key milliseconds value.
+func pSetEx(c *Client, v *Value, rg *RedisGo) *Value {
+	return setExpiring(c, v, rg, "psetex", "PX")
+}
+
+// setExpiring stores the value of SETEX or PSETEX v, named cmd, with the TTL
+// given in unit, EX or PX.
+func setExpiring(c *Client, v *Value, rg *RedisGo, cmd, unit string) *Value {
+	exp, errv := parseExpiry(cmd, unit, v.Array[2].Bulk)
+	if errv != nil {
+		return errv
+	}
+	if _, _, errv = setGeneric(c, rg.db(c), v.Array[1].Bulk, v.Array[3].Bulk, setOpts{exp: exp}); errv != nil {
+		return errv
+	}
+	return newOK()
+}
+
+// setNX implements SETNX key value, replying 1 if the key was set and 0 if it
+// existed already.
+func setNX(c *Client, v *Value, rg *RedisGo) *Value {
+	_, stored, errv := setGeneric(c, rg.db(c), v.Array[1].Bulk, v.Array[2].Bulk, setOpts{nx: true})
+	if errv != nil {
+		return errv
+	}
+	if stored {
+		return newInteger(1)
+	}
+	return newInteger(0)
+}
+
+// get implements GET key.
+func get(c *Client, v *Value, rg *RedisGo) *Value {
+	item, ok := rg.db(c).Get(v.Array[1].Bulk)
+	if !ok {
+		return newNull()
+	}
+	if item.Kind != KindString {
+		return newError(errWrongType)
+	}
+	return newBulk(item.Value)
+}
+
+// incr implements INCR key.
+func incr(c *Client, v *Value, rg *RedisGo) *Value {
+	return incrGeneric(rg.db(c), v.Array[1].Bulk, 1)
+}
+
+// decr implements DECR key.
+func decr(c *Client, v *Value, rg *RedisGo) *Value {
+	return incrGeneric(rg.db(c), v.Array[1].Bulk, -1)
+}
+
+// incrBy implements INCRBY key increment.
+func incrBy(c *Client, v *Value, rg *RedisGo) *Value {
+	delta, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	return incrGeneric(rg.db(c), v.Array[1].Bulk, delta)
+}
+
+// decrBy implements DECRBY key decrement.
+func decrBy(c *Client, v *Value, rg *RedisGo) *Value {
+	delta, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		return newError(errNotInt)
+	}
+	return incrGeneric(rg.db(c), v.Array[1].Bulk, -delta)
+}
+
+// incrGeneric adds delta to the integer stored at key, treating a missing key
+// as 0, and replies with the new value. The expiry of the key is preserved.
+func incrGeneric(db *RedisDb, key string, delta int64) *Value {
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	var curr int64
+	item := &Item{}
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if old != nil {
+		n, err := strconv.ParseInt(old.Value, 10, 64)
+		if err != nil {
+			return newError(errNotInt)
+		}
+		curr, item.Expiration = n, old.Expiration
+	}
+	if (delta > 0 && curr > math.MaxInt64-delta) || (delta < 0 && curr < math.MinInt64-delta) {
+		return newError(errNotInt)
+	}
+	curr += delta
+	item.Value = strconv.FormatInt(curr, 10)
+	db.put(key, item)
+	db.notify(notifyString, "incrby", key)
+
+	return newInteger(curr)
+}
+
+// incrByFloat implements INCRBYFLOAT key increment, replying with the new value
+// as a bulk string. The expiry of the key is preserved.
+func incrByFloat(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	delta, err := parseFloat(v.Array[2].Bulk)
+	if err != nil {
+		return newError(errNotFloat)
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	var curr float64
+	item := &Item{}
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if old != nil {
+		f, err := parseFloat(old.Value)
+		if err != nil {
+			return newError(errNotFloat)
+		}
+		curr, item.Expiration = f, old.Expiration
+	}
+	curr += delta
+	if math.IsNaN(curr) || math.IsInf(curr, 0) {
+		return newError("ERR increment would produce NaN or Infinity")
+	}
+	item.Value = formatFloat(curr)
+	db.put(key, item)
+	db.notify(notifyString, "incrbyfloat", key)
+
+	return newBulk(item.Value)
+}
+
+// parseFloat parses str as a float64, rejecting NaN which strconv accepts.
+func parseFloat(str string) (float64, error) {
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) {
+		return 0, strconv.ErrSyntax
+	}
+	return f, nil
+}
+
+// formatFloat formats f the way Redis replies with floats: without exponent or
+// trailing zeros. It rounds to 15 significant digits first so that binary
+// artifacts such as 10.5+0.1 = 10.600000000000001 render as 10.6.
+func formatFloat(f float64) string {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(f, 'g', 15, 64), 64)
+	if err != nil {
+		rounded = f
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// appendCmd implements APPEND key value, replying with the new length of the
+// string. A missing key is created as if it held the empty string.
+func appendCmd(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item := &Item{Value: v.Array[2].Bulk}
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if old != nil {
+		item.Value = old.Value + item.Value
+		item.Expiration = old.Expiration
+	}
+	db.put(key, item)
+	db.notify(notifyString, "append", key)
+	return newInteger(int64(len(item.Value)))
+}
+
+// strlen implements STRLEN key, replying 0 for a missing key.
+func strlen(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindString)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(len(item.Value)))
+}
+
+// normRange converts the inclusive start and end indices, where negative
+// values count back from the end, into a range clamped to a sequence of length
+// n. It reports false if the resulting range is empty.
+func normRange(start, end int64, n int) (int, int, bool) {
+	size := int64(n)
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	start, end = max(start, 0), min(end, size-1)
+	if start > end || size == 0 {
+		return 0, 0, false
+	}
+	return int(start), int(end), true
+}
+
+// getRange implements GETRANGE key start end, and its legacy alias SUBSTR,
+// replying with the substring between the inclusive byte offsets.
+func getRange(c *Client, v *Value, rg *RedisGo) *Value {
+	start, err1 := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	end, err2 := strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+	if err1 != nil || err2 != nil {
+		return newError(errNotInt)
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindString)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newBulk("")
+	}
+	// Both offsets negative and inverted never select anything, even though
+	// clamping would otherwise turn them into a valid range.
+	if start < 0 && end < 0 && start > end {
+		return newBulk("")
+	}
+	// Unlike the ranges of lists, an end still before the start of the
+	// string once counted back selects its first byte, as in Redis.
+	if end < 0 {
+		end = max(end+int64(len(item.Value)), 0)
+	}
+	from, to, ok := normRange(start, end, len(item.Value))
+	if !ok {
+		return newBulk("")
+	}
+	return newBulk(item.Value[from : to+1])
+}
+
+// setRange implements SETRANGE key offset value, overwriting the string from
+// offset and padding it with zero bytes if needed. It replies with the new
+// length of the string.
+func setRange(c *Client, v *Value, rg *RedisGo) *Value {
+	key, val := v.Array[1].Bulk, v.Array[3].Bulk
+	offset, err := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	if err != nil {
+		return newError(errNotInt)
+	}
+	if offset < 0 {
+		return newError("ERR offset is out of range")
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	old, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if len(val) == 0 {
+		if old == nil {
+			return newInteger(0)
+		}
+		return newInteger(int64(len(old.Value)))
+	}
+	// Written this way round, a huge offset can't overflow the sum.
+	if offset > rg.conf.protoLimits().maxBulkLen-int64(len(val)) {
+		return newError("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+	item := &Item{}
+	var buf []byte
+	if old != nil {
+		buf, item.Expiration = []byte(old.Value), old.Expiration
+	}
+	if need := int(offset) + len(val); need > len(buf) {
+		buf = append(buf, make([]byte, need-len(buf))...)
+	}
+	copy(buf[offset:], val)
+
+	item.Value = string(buf)
+	db.put(key, item)
+	db.notify(notifyString, "setrange", key)
+	return newInteger(int64(len(item.Value)))
+}
+
+// bulkArgs returns the bulk strings of args.
+func bulkArgs(args []Value) []string {
+	strs := make([]string, len(args))
+	for i := range args {
+		strs[i] = args[i].Bulk
+	}
+	return strs
+}
+
+// mset implements MSET key value [key value ...].
+func mset(c *Client, v *Value, rg *RedisGo) *Value {
+	if len(v.Array)%2 == 0 {
+		return newError(errSyntax)
+	}
+	rg.db(c).MSet(bulkArgs(v.Array[1:]))
+	return newOK()
+}
+
+// msetNX implements MSETNX key value [key value ...], setting all pairs only if
+// none of the keys exist.
+func msetNX(c *Client, v *Value, rg *RedisGo) *Value {
+	if len(v.Array)%2 == 0 {
+		return newError(errSyntax)
+	}
+	if !rg.db(c).MSetNX(bulkArgs(v.Array[1:])) {
+		return newInteger(0)
+	}
+	return newInteger(1)
+}
+
+// mget implements MGET key [key ...], replying with Null for missing keys.
+func mget(c *Client, v *Value, rg *RedisGo) *Value {
+	items := rg.db(c).MGet(bulkArgs(v.Array[1:]))
+
+	vals := make([]Value, len(items))
+	for i, item := range items {
+		if item == nil || item.Kind != KindString {
+			vals[i] = Value{Type: Null}
+			continue
+		}
+		vals[i] = Value{Type: Bulk, Bulk: item.Value}
+	}
+	return newArray(vals)
+}
+
+// getSet implements GETSET key value, the older form of SET key value GET:
+// it replies with the previous value of key and discards any TTL.
+func getSet(c *Client, v *Value, rg *RedisGo) *Value {
+	old, _, errv := setGeneric(c, rg.db(c), v.Array[1].Bulk, v.Array[2].Bulk, setOpts{get: true})
+	switch {
+	case errv != nil:
+		return errv
+	case old == nil:
+		return newNull()
+	default:
+		return newBulk(old.Value)
+	}
+}
+
+// getDel implements GETDEL key, replying with the value of key and deleting it
+// in the same step.
+func getDel(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	db.remove(key)
+	db.notify(notifyGeneric, "del", key)
+	return newBulk(item.Value)
+}
+
+// getEx implements GETEX key [EX seconds|PX ms|EXAT ts|PXAT ts|PERSIST],
+// replying with the value of key and optionally changing its expiry. Without
+// options the expiry is left untouched.
+func getEx(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+	args := v.Array[2:]
+
+	var exp time.Time
+	var persist, hasExp bool
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i].Bulk); opt {
+		case "PERSIST":
+			if hasExp || persist {
+				return newError(errSyntax)
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExp || persist || i+1 >= len(args) {
+				return newError(errSyntax)
+			}
+			i++
+			var errv *Value
+			if exp, errv = parseExpiry("getex", opt, args[i].Bulk); errv != nil {
+				return errv
+			}
+			hasExp = true
+		default:
+			return newError(errSyntax)
+		}
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindString)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	reply := newBulk(item.Value)
+
+	switch {
+	case persist:
+		if item.hasExpiry() {
+			db.setExpiry(key, item, time.Unix(unixTSEpoch, 0))
+			db.notify(notifyGeneric, "persist", key)
+		}
+		c.propagateAs("persist", key)
+	case hasExp && !exp.After(time.Now()):
+		db.expire(key)
+		c.propagateAs("del", key)
+	case hasExp:
+		db.setExpiry(key, item, exp)
+		db.notify(notifyGeneric, "expire", key)
+		c.propagateAs("pexpireat", key, strconv.FormatInt(exp.UnixMilli(), 10))
+	default:
+		c.propagateNone()
+	}
+	return reply
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestGetRange(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	do(rg, c, "set", "k", "hello")
+	tests := []struct {
+		start, end string
+		want       string
+	}{
+		{"0", "-1", "hello"},
+		{"1", "3", "ell"},
+		{"-3", "-1", "llo"},
+		{"0", "100", "hello"},
+		{"0", "-10", "h"},
+		{"0", "-6", "h"},
+		{"2", "-100", ""},
+		{"-1", "-3", ""},
+		{"-10", "-20", ""},
+		{"5", "10", ""},
+	}
+	for _, tt := range tests {
+		reply := do(rg, c, "getrange", "k", tt.start, tt.end)
+		if reply.Type != Bulk || reply.Bulk != tt.want {
+			t.Errorf("GETRANGE k %s %s = %v, want %q", tt.start, tt.end, reply, tt.want)
+		}
+	}
+}
+
+func TestSetRangeProtoMaxBulkLen(t *testing.T) {
+	rg := newTestServer(t, "proto-max-bulk-len 1mb")
+	c := NewClient(1, nil)
+	if reply := do(rg, c, "setrange", "k", "1048575", "x"); reply.Type != Integer || reply.Int != 1048576 {
+		t.Fatalf("SETRANGE up to the limit = %v, want 1048576", reply)
+	}
+	if reply := do(rg, c, "setrange", "k", "1048575", "xy"); reply.Type != Error {
+		t.Fatalf("SETRANGE past the limit = %v, want an error", reply)
+	}
+	if reply := do(rg, c, "setrange", "k", "9223372036854775807", "a"); reply.Type != Error {
+		t.Fatalf("SETRANGE at the largest offset = %v, want an error", reply)
+	}
+	// An empty value changes nothing, so no offset is too large for it.
+	if reply := do(rg, c, "setrange", "k", "9223372036854775807", ""); reply.Type != Integer || reply.Int != 1048576 {
+		t.Fatalf("SETRANGE of an empty value = %v, want 1048576", reply)
+	}
+	if reply := do(rg, c, "setrange", "missing", "9223372036854775807", ""); reply.Type != Integer || reply.Int != 0 {
+		t.Fatalf("SETRANGE of an empty value on a missing key = %v, want 0", reply)
+	}
+}
+
+// binaryValue holds NUL bytes and bytes that aren't valid UTF-8.
+const binaryValue = "a\x00b\xff\x00\xfe\xc3"
+
+func TestBinarySafeStrings(t *testing.T) {
+	rg := newTestServer(t)
+	c := NewClient(1, nil)
+	wantBulk := func(reply *Value, want string) {
+		t.Helper()
+		if reply.Type != Bulk || reply.Bulk != want {
+			t.Errorf("got %v, want %q", reply, want)
+		}
+	}
+	wantInt := func(reply *Value, want int64) {
+		t.Helper()
+		if reply.Type != Integer || reply.Int != want {
+			t.Errorf("got %v, want %d", reply, want)
+		}
+	}
+
+	do(rg, c, "set", "k", binaryValue)
+	wantBulk(do(rg, c, "get", "k"), binaryValue)
+	wantInt(do(rg, c, "strlen", "k"), int64(len(binaryValue)))
+
+	wantInt(do(rg, c, "append", "k", "\x00\xff"), int64(len(binaryValue))+2)
+	wantBulk(do(rg, c, "get", "k"), binaryValue+"\x00\xff")
+
+	wantBulk(do(rg, c, "getrange", "k", "1", "4"), "\x00b\xff\x00")
+	wantBulk(do(rg, c, "getrange", "k", "-2", "-1"), "\x00\xff")
+	wantBulk(do(rg, c, "substr", "k", "3", "3"), "\xff")
+
+	wantInt(do(rg, c, "setrange", "k", "1", "\xff\x00"), int64(len(binaryValue))+2)
+	wantBulk(do(rg, c, "get", "k"), "a\xff\x00\xff\x00\xfe\xc3\x00\xff")
+
+	// Padding is made of zero bytes.
+	wantInt(do(rg, c, "setrange", "pad", "3", "\xff"), 4)
+	wantBulk(do(rg, c, "get", "pad"), "\x00\x00\x00\xff")
+
+	// A key is binary-safe as well.
+	do(rg, c, "set", "\x00\xff", "v")
+	wantBulk(do(rg, c, "get", "\x00\xff"), "v")
+	if reply := do(rg, c, "get", "\x00"); reply.Type != Null {
+		t.Errorf("GET of a key prefix = %v, want nil", reply)
+	}
+}
+
+func TestBinarySafeStringsOverTheWire(t *testing.T) {
+	rg := newTestServer(t)
+	conn := connect(t, rg)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := respOf(newCommand("set", binaryValue, binaryValue)) +
+		respOf(newCommand("get", binaryValue)) +
+		respOf(newCommand("getrange", binaryValue, "1", "3"))
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	want := "+OK\r\n" +
+		respOf(Value{Type: Bulk, Bulk: binaryValue}) +
+		respOf(Value{Type: Bulk, Bulk: "\x00b\xff"})
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
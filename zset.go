@@ -0,0 +1,567 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(
+		&Command{name: "zadd", handler: zadd, arity: -4, keys: oneKey, isWrite: true, denyOOM: true, fast: true},
+		&Command{name: "zscore", handler: zscore, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "zcard", handler: zcard, arity: 2, keys: oneKey, fast: true},
+		&Command{name: "zrem", handler: zrem, arity: -3, keys: oneKey, isWrite: true, fast: true},
+		&Command{name: "zmpop", handler: zmpop, arity: -4, numKeys: 1, isWrite: true},
+		&Command{name: "zrange", handler: zrange, arity: -4, keys: oneKey},
+		&Command{name: "zrevrange", handler: zrevRange, arity: -4, keys: oneKey},
+		&Command{name: "zrangestore", handler: zrangeStore, arity: -5, keys: keySpec{1, 2, 1}, isWrite: true, denyOOM: true},
+		&Command{name: "zrangebyscore", handler: zrangeByScore, arity: -4, keys: oneKey},
+		&Command{name: "zcount", handler: zcount, arity: 4, keys: oneKey},
+		&Command{name: "zrank", handler: zrank, arity: 3, keys: oneKey, fast: true},
+		&Command{name: "zrevrank", handler: zrevRank, arity: 3, keys: oneKey, fast: true},
+	)
+}
+
+// newZSetItem returns a KindZSet item holding zs.
+func newZSetItem(zs *SortedSet) *Item {
+	return &Item{Kind: KindZSet, ZSet: zs}
+}
+
+// formatScore formats a sorted set score the way Redis replies with it.
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
+}
+
+// zaddOpts holds the parsed flags of a ZADD command.
+type zaddOpts struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+// zadd implements ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member
+// [score member ...]. It replies with the number of members added, or added
+// and updated with CH. With INCR it behaves like ZINCRBY and replies with the
+// new score, or Null if the flags prevented the update.
+func zadd(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	var opts zaddOpts
+	i := 2
+loop:
+	for ; i < len(v.Array); i++ {
+		switch strings.ToUpper(v.Array[i].Bulk) {
+		case "NX":
+			opts.nx = true
+		case "XX":
+			opts.xx = true
+		case "GT":
+			opts.gt = true
+		case "LT":
+			opts.lt = true
+		case "CH":
+			opts.ch = true
+		case "INCR":
+			opts.incr = true
+		default:
+			break loop
+		}
+	}
+	pairs := v.Array[i:]
+	switch {
+	case len(pairs) == 0 || len(pairs)%2 != 0:
+		return newError(errSyntax)
+	case opts.nx && opts.xx:
+		return newError("ERR XX and NX options at the same time are not compatible")
+	case (opts.gt && opts.lt) || (opts.nx && (opts.gt || opts.lt)):
+		return newError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	case opts.incr && len(pairs) > 2:
+		return newError("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, err := parseFloat(pairs[2*j].Bulk)
+		if err != nil {
+			return newError(errNotFloat)
+		}
+		scores[j] = score
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		if opts.xx {
+			if opts.incr {
+				return newNull()
+			}
+			return newInteger(0)
+		}
+		item = newZSetItem(NewSortedSet())
+		db.put(key, item)
+	}
+	var added, changed int64
+	var last *float64
+	for j, score := range scores {
+		member := pairs[2*j+1].Bulk
+		old, exists := item.ZSet.Score(member)
+
+		if opts.incr {
+			if exists {
+				score += old
+			}
+			if math.IsNaN(score) {
+				return newError("ERR resulting score is not a number (NaN)")
+			}
+		}
+		switch {
+		case exists && opts.nx, !exists && opts.xx:
+			continue
+		case exists && opts.gt && score <= old, exists && opts.lt && score >= old:
+			continue
+		}
+		if item.ZSet.Add(member, score) {
+			db.memUsed.Add(zmemberMemUsage(member))
+			added++
+		} else if exists && old != score {
+			changed++
+		}
+		last = &score
+	}
+	switch {
+	case opts.incr && last != nil:
+		db.notify(notifyZSet, "zincr", key)
+	case !opts.incr && added+changed > 0:
+		db.notify(notifyZSet, "zadd", key)
+	}
+	if item.ZSet.Len() == 0 {
+		db.remove(key)
+	}
+	if opts.incr {
+		if last == nil {
+			return newNull()
+		}
+		return newDouble(*last)
+	}
+	if opts.ch {
+		return newInteger(added + changed)
+	}
+	return newInteger(added)
+}
+
+// zscore implements ZSCORE key member.
+func zscore(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	score, ok := item.ZSet.Score(v.Array[2].Bulk)
+	if !ok {
+		return newNull()
+	}
+	return newDouble(score)
+}
+
+// zcard implements ZCARD key.
+func zcard(c *Client, v *Value, rg *RedisGo) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(item.ZSet.Len()))
+}
+
+// zrem implements ZREM key member [member ...], replying with the number of
+// members removed. A sorted set left empty is deleted.
+func zrem(c *Client, v *Value, rg *RedisGo) *Value {
+	key := v.Array[1].Bulk
+
+	db := rg.db(c)
+	unlock := db.lockKeys(key)
+	defer unlock()
+
+	item, errv := db.getTyped(key, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	var removed int64
+	for _, arg := range v.Array[2:] {
+		if item.ZSet.Remove(arg.Bulk) {
+			db.subMem(zmemberMemUsage(arg.Bulk))
+			removed++
+		}
+	}
+	if removed > 0 {
+		db.notify(notifyZSet, "zrem", key)
+	}
+	if item.ZSet.Len() == 0 {
+		db.remove(key)
+		db.notify(notifyGeneric, "del", key)
+	}
+	return newInteger(removed)
+}
+
+// zmpop implements ZMPOP numkeys key [key ...] MIN|MAX [COUNT count],
+// popping up to count members with the lowest or highest scores from the
+// first non-empty sorted set among the keys. It replies with the key and the
+// popped member and score pairs, or a null if every sorted set is empty.
+func zmpop(c *Client, v *Value, rg *RedisGo) *Value {
+	keys, rest, errv := parseNumKeys(v.Array[1:])
+	if errv != nil {
+		return errv
+	}
+	if len(rest) == 0 {
+		return newError(errSyntax)
+	}
+	var rev bool
+	switch strings.ToUpper(rest[0].Bulk) {
+	case "MIN":
+	case "MAX":
+		rev = true
+	default:
+		return newError(errSyntax)
+	}
+	count, errv := parseMPopCount(rest[1:])
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.lockKeys(keys...)
+	defer unlock()
+
+	for _, key := range keys {
+		item, errv := db.getTyped(key, KindZSet)
+		if errv != nil {
+			return errv
+		}
+		if item == nil {
+			continue
+		}
+		popped := item.ZSet.Pop(int(min(count, int64(item.ZSet.Len()))), rev)
+		pairs := make([]Value, len(popped))
+		for i, entry := range popped {
+			db.subMem(zmemberMemUsage(entry.Member))
+			pairs[i] = *newArray([]Value{
+				{Type: Bulk, Bulk: entry.Member},
+				*newDouble(entry.Score),
+			})
+		}
+		if rev {
+			db.notify(notifyZSet, "zpopmax", key)
+		} else {
+			db.notify(notifyZSet, "zpopmin", key)
+		}
+		if item.ZSet.Len() == 0 {
+			db.remove(key)
+			db.notify(notifyGeneric, "del", key)
+		}
+		return newArray([]Value{{Type: Bulk, Bulk: key}, *newArray(pairs)})
+	}
+	return newNullArray()
+}
+
+// zentryValues converts entries into an array of members, interleaved with
+// their scores if withScores is set.
+func zentryValues(entries []ZEntry, withScores bool) []Value {
+	vals := make([]Value, 0, len(entries))
+	for _, entry := range entries {
+		vals = append(vals, Value{Type: Bulk, Bulk: entry.Member})
+		if withScores {
+			vals = append(vals, Value{Type: Bulk, Bulk: formatScore(entry.Score)})
+		}
+	}
+	return vals
+}
+
+// zrange implements ZRANGE key start stop [WITHSCORES].
+func zrange(c *Client, v *Value, rg *RedisGo) *Value {
+	return zrangeGeneric(c, v, rg, false)
+}
+
+// zrevRange implements ZREVRANGE key start stop [WITHSCORES].
+func zrevRange(c *Client, v *Value, rg *RedisGo) *Value {
+	return zrangeGeneric(c, v, rg, true)
+}
+
+// zrangeGeneric replies with the members between the inclusive ranks start
+// and stop, ordered by ascending score or descending with rev. Ties are
+// broken lexically by member.
+func zrangeGeneric(c *Client, v *Value, rg *RedisGo, rev bool) *Value {
+	start, err1 := strconv.ParseInt(v.Array[2].Bulk, 10, 64)
+	stop, err2 := strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+	if err1 != nil || err2 != nil {
+		return newError(errNotInt)
+	}
+	var withScores bool
+	for _, arg := range v.Array[4:] {
+		if !strings.EqualFold(arg.Bulk, "WITHSCORES") {
+			return newError(errSyntax)
+		}
+		withScores = true
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newArray([]Value{})
+	}
+	from, to, ok := normRange(start, stop, item.ZSet.Len())
+	if !ok {
+		return newArray([]Value{})
+	}
+	return newArray(zentryValues(item.ZSet.Range(from, to, rev), withScores))
+}
+
+// parseScoreBound parses a score range bound: a float, -inf/+inf, optionally
+// prefixed with ( to make it exclusive.
+func parseScoreBound(arg string) (score float64, exclusive bool, err error) {
+	if strings.HasPrefix(arg, "(") {
+		arg, exclusive = arg[1:], true
+	}
+	score, err = parseFloat(arg)
+	return score, exclusive, err
+}
+
+// parseScoreRange parses the min and max arguments of a score range command.
+func parseScoreRange(minArg, maxArg string) (ScoreRange, *Value) {
+	var r ScoreRange
+	var err1, err2 error
+	r.Min, r.MinEx, err1 = parseScoreBound(minArg)
+	r.Max, r.MaxEx, err2 = parseScoreBound(maxArg)
+	if err1 != nil || err2 != nil {
+		return r, newError("ERR min or max is not a float")
+	}
+	return r, nil
+}
+
+// zrangeByScore implements ZRANGEBYSCORE key min max [WITHSCORES]
+// [LIMIT offset count].
+func zrangeByScore(c *Client, v *Value, rg *RedisGo) *Value {
+	r, errv := parseScoreRange(v.Array[2].Bulk, v.Array[3].Bulk)
+	if errv != nil {
+		return errv
+	}
+	var withScores bool
+	offset, count := int64(0), int64(-1)
+	args := v.Array[4:]
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return newError(errSyntax)
+			}
+			var err1, err2 error
+			offset, err1 = strconv.ParseInt(args[i+1].Bulk, 10, 64)
+			count, err2 = strconv.ParseInt(args[i+2].Bulk, 10, 64)
+			if err1 != nil || err2 != nil {
+				return newError(errNotInt)
+			}
+			i += 2
+		default:
+			return newError(errSyntax)
+		}
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil || offset < 0 || offset > int64(item.ZSet.Len()) {
+		return newArray([]Value{})
+	}
+	if count > int64(item.ZSet.Len()) {
+		count = -1
+	}
+	entries := item.ZSet.RangeByScore(r, int(offset), int(count))
+	return newArray(zentryValues(entries, withScores))
+}
+
+// zrangeStore implements ZRANGESTORE dst src min max [BYSCORE] [REV]
+// [LIMIT offset count], storing the entries ZRANGE would reply with in dst
+// along with their scores and replying with their number. min and max are
+// ranks, or scores with BYSCORE; REV walks from the highest score, in which
+// case a score range is given as max then min. An empty result deletes dst.
+func zrangeStore(c *Client, v *Value, rg *RedisGo) *Value {
+	dst, src := v.Array[1].Bulk, v.Array[2].Bulk
+
+	var byScore, rev, limited bool
+	offset, count := int64(0), int64(-1)
+	args := v.Array[5:]
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Bulk) {
+		case "BYSCORE":
+			byScore = true
+		case "REV":
+			rev = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return newError(errSyntax)
+			}
+			var err1, err2 error
+			offset, err1 = strconv.ParseInt(args[i+1].Bulk, 10, 64)
+			count, err2 = strconv.ParseInt(args[i+2].Bulk, 10, 64)
+			if err1 != nil || err2 != nil {
+				return newError(errNotInt)
+			}
+			limited = true
+			i += 2
+		default:
+			return newError(errSyntax)
+		}
+	}
+	if limited && !byScore {
+		return newError("ERR syntax error, LIMIT is only supported in combination with BYSCORE")
+	}
+	var r ScoreRange
+	var start, stop int64
+	if byScore {
+		minArg, maxArg := v.Array[3].Bulk, v.Array[4].Bulk
+		if rev {
+			minArg, maxArg = maxArg, minArg
+		}
+		var errv *Value
+		if r, errv = parseScoreRange(minArg, maxArg); errv != nil {
+			return errv
+		}
+	} else {
+		var err1, err2 error
+		start, err1 = strconv.ParseInt(v.Array[3].Bulk, 10, 64)
+		stop, err2 = strconv.ParseInt(v.Array[4].Bulk, 10, 64)
+		if err1 != nil || err2 != nil {
+			return newError(errNotInt)
+		}
+	}
+
+	db := rg.db(c)
+	unlock := db.lockKeys(dst, src)
+	defer unlock()
+
+	item, errv := db.getTyped(src, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	var entries []ZEntry
+	switch {
+	case item == nil:
+	case byScore:
+		if offset < 0 || offset > int64(item.ZSet.Len()) {
+			break
+		}
+		if count > int64(item.ZSet.Len()) {
+			count = -1
+		}
+		if rev {
+			entries = item.ZSet.RevRangeByScore(r, int(offset), int(count))
+		} else {
+			entries = item.ZSet.RangeByScore(r, int(offset), int(count))
+		}
+	default:
+		if from, to, ok := normRange(start, stop, item.ZSet.Len()); ok {
+			entries = item.ZSet.Range(from, to, rev)
+		}
+	}
+	if len(entries) == 0 {
+		if db.remove(dst) {
+			db.notify(notifyGeneric, "del", dst)
+		}
+		return newInteger(0)
+	}
+	zs := NewSortedSet()
+	for _, entry := range entries {
+		zs.Add(entry.Member, entry.Score)
+	}
+	db.put(dst, newZSetItem(zs))
+	db.notify(notifyZSet, "zrangestore", dst)
+	return newInteger(int64(len(entries)))
+}
+
+// zcount implements ZCOUNT key min max.
+func zcount(c *Client, v *Value, rg *RedisGo) *Value {
+	r, errv := parseScoreRange(v.Array[2].Bulk, v.Array[3].Bulk)
+	if errv != nil {
+		return errv
+	}
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newInteger(0)
+	}
+	return newInteger(int64(item.ZSet.CountByScore(r)))
+}
+
+// zrank implements ZRANK key member.
+func zrank(c *Client, v *Value, rg *RedisGo) *Value {
+	return zrankGeneric(c, v, rg, false)
+}
+
+// zrevRank implements ZREVRANK key member.
+func zrevRank(c *Client, v *Value, rg *RedisGo) *Value {
+	return zrankGeneric(c, v, rg, true)
+}
+
+// zrankGeneric replies with the zero-based rank of member ordered by ascending
+// score, or descending with rev, or Null if the member is missing.
+func zrankGeneric(c *Client, v *Value, rg *RedisGo, rev bool) *Value {
+	db := rg.db(c)
+	unlock := db.rlockKeys(v.Array[1].Bulk)
+	defer unlock()
+
+	item, errv := db.peekTyped(v.Array[1].Bulk, KindZSet)
+	if errv != nil {
+		return errv
+	}
+	if item == nil {
+		return newNull()
+	}
+	rank, ok := item.ZSet.Rank(v.Array[2].Bulk)
+	if !ok {
+		return newNull()
+	}
+	if rev {
+		rank = item.ZSet.Len() - 1 - rank
+	}
+	return newInteger(int64(rank))
+}